@@ -32,6 +32,22 @@ function timeSince(date) {
     return 'just now';
 }
 
+// formatFlakyCount returns the number of flaky tests of a run, if there are any.
+function formatFlakyCount(data) {
+    if (!data.flaky) {
+        return '';
+    }
+    return ` <span class="flaky-count text-warning" title="passed after failed attempts">~ ${data.flaky}</span>`;
+}
+
+// formatSkippedCount returns the number of skipped tests of a run, if there are any.
+function formatSkippedCount(data) {
+    if (!data.skipped) {
+        return '';
+    }
+    return ` <span class="skip-count text-secondary" title="skipped">⊘ ${data.skipped}</span>`;
+}
+
 window.sortAllClients = function(sortBy) {
     $('.suite-box').each(function() {
         const clientBoxes = $(this).find('.client-box').get();
@@ -395,9 +411,9 @@ $(document).ready(function () {
                 render: function(data, type, row) {
                     if (data.fails > 0) {
                         let prefix = data.timeout ? 'Timeout' : 'Fail';
-                        return `<span><span class="pass-count">✓ ${data.passes}</span> <span class="fail-count">✗ ${data.fails}</span> <span class="badge bg-danger ms-1">${prefix}</span></span>`;
+                        return `<span><span class="pass-count">✓ ${data.passes}</span> <span class="fail-count">✗ ${data.fails}</span>${formatFlakyCount(data)}${formatSkippedCount(data)} <span class="badge bg-danger ms-1">${prefix}</span></span>`;
                     }
-                    return `<span class="pass-count">✓ ${data.passes} <span class="badge bg-success ms-1">Pass</span></span>`;
+                    return `<span class="pass-count">✓ ${data.passes}${formatFlakyCount(data)}${formatSkippedCount(data)} <span class="badge bg-success ms-1">Pass</span></span>`;
                 },
             },
             {
@@ -704,9 +720,9 @@ function showFileListing(data) {
                 render: function(data, type, row) {
                     if (data.fails > 0) {
                         let prefix = data.timeout ? 'Timeout' : 'Fail';
-                        return `<span><span class="pass-count">✓ ${data.passes}</span> <span class="fail-count">✗ ${data.fails}</span> <span class="badge bg-danger ms-1">${prefix}</span></span>`;
+                        return `<span><span class="pass-count">✓ ${data.passes}</span> <span class="fail-count">✗ ${data.fails}</span>${formatFlakyCount(data)}${formatSkippedCount(data)} <span class="badge bg-danger ms-1">${prefix}</span></span>`;
                     }
-                    return `<span class="pass-count">✓ ${data.passes} <span class="badge bg-success ms-1">Pass</span></span>`;
+                    return `<span class="pass-count">✓ ${data.passes}${formatFlakyCount(data)}${formatSkippedCount(data)} <span class="badge bg-success ms-1">Pass</span></span>`;
                 },
             },
             {
@@ -0,0 +1,125 @@
+import $ from 'jquery';
+
+import * as common from './app-common.js';
+import { encode } from './html.js';
+import { formatDuration } from './utils.js';
+
+// maxFinished is the number of finished tests shown on the page.
+const maxFinished = 200;
+
+// Suite names by suite ID, and tests which are running, by "suite/test" key.
+const suites = new Map();
+const running = new Map();
+const counts = { passed: 0, failed: 0 };
+
+$(document).ready(function () {
+    common.updateHeader();
+
+    // The event stream of hive is relayed by hiveview (see the -events flag).
+    const source = new EventSource('events');
+    source.onopen = function() {
+        setStatus('Connected to the event stream of hive.');
+    };
+    source.onerror = function() {
+        setStatus('Not connected. Is hive running with --events.addr, and hiveview with -events?');
+    };
+    source.addEventListener('simulationStart', function(e) {
+        const ev = JSON.parse(e.data);
+        suites.clear();
+        running.clear();
+        counts.passed = 0;
+        counts.failed = 0;
+        $('#live-simulator').text(ev.simulator);
+        $('#live-finished').empty();
+        update();
+    });
+    source.addEventListener('simulationEnd', function(e) {
+        const ev = JSON.parse(e.data);
+        running.clear();
+        $('#live-simulator').text(ev.simulator + ' (finished)');
+        update();
+    });
+    source.addEventListener('suiteStart', function(e) {
+        const ev = JSON.parse(e.data);
+        suites.set(ev.suite, ev.suiteName);
+    });
+    source.addEventListener('testStart', function(e) {
+        const ev = JSON.parse(e.data);
+        running.set(testKey(ev), { suite: suites.get(ev.suite) || '', test: ev.testName, start: new Date(ev.time), clients: [] });
+        update();
+    });
+    source.addEventListener('testRetry', function(e) {
+        const ev = JSON.parse(e.data);
+        addFinished(ev, 'retrying');
+    });
+    source.addEventListener('testEnd', function(e) {
+        const ev = JSON.parse(e.data);
+        running.delete(testKey(ev));
+        if (ev.result && ev.result.pass) {
+            counts.passed++;
+        } else {
+            counts.failed++;
+        }
+        addFinished(ev, resultText(ev.result));
+        update();
+    });
+    source.addEventListener('clientStart', function(e) {
+        const ev = JSON.parse(e.data);
+        const test = running.get(testKey(ev));
+        if (test) {
+            test.clients.push(ev.clientName);
+            update();
+        }
+    });
+
+    // Refresh the running times.
+    setInterval(update, 1000);
+});
+
+function testKey(ev) {
+    return ev.suite + '/' + ev.test;
+}
+
+function setStatus(text) {
+    $('#live-status').text(text);
+}
+
+function resultText(result) {
+    if (!result) {
+        return 'unknown';
+    }
+    if (result.skipped) {
+        return 'skipped';
+    }
+    if (result.timeout) {
+        return 'timed out';
+    }
+    return result.pass ? 'pass' : 'fail';
+}
+
+// addFinished adds a row to the table of finished tests.
+function addFinished(ev, result) {
+    const resultClass = { 'pass': 'text-success', 'skipped': 'text-secondary', 'retrying': 'text-warning' }[result] || 'text-danger';
+    const row = $('<tr>');
+    row.append($('<td>').text(suites.get(ev.suite) || ''));
+    row.append($('<td>').text(ev.testName));
+    row.append($('<td>').addClass(resultClass).text(result));
+    row.append($('<td>').text(new Date(ev.time).toLocaleTimeString()));
+    $('#live-finished').prepend(row);
+    $('#live-finished tr').slice(maxFinished).remove();
+}
+
+// update renders the running tests and counters.
+function update() {
+    const now = new Date();
+    const rows = [];
+    for (const test of running.values()) {
+        rows.push('<tr><td>' + encode(test.suite) + '</td><td>' + encode(test.test) + '</td>' +
+            '<td>' + encode(test.clients.join(', ')) + '</td>' +
+            '<td>' + formatDuration(now - test.start) + '</td></tr>');
+    }
+    $('#live-running').html(rows.join(''));
+    $('#live-count-running').text(running.size);
+    $('#live-count-passed').text(counts.passed);
+    $('#live-count-failed').text(counts.failed);
+}
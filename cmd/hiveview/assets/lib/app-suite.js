@@ -8,7 +8,7 @@ import * as common from './app-common.js';
 import * as routes from './routes.js';
 import * as html from './html.js';
 import * as testlog from './testlog.js';
-import { formatDuration, queryParam } from './utils.js';
+import { formatBytes, formatDuration, queryParam } from './utils.js';
 
 $(document).ready(function () {
     common.updateHeader();
@@ -118,6 +118,7 @@ function showSuiteData(data, suiteID) {
         tc['duration'] = testCaseDuration(tc);
         cases.push(tc);
     }
+    addSubtestInfo(data.testCases);
     console.log('got ' + cases.length + ' testcases');
 
     // Fill info box.
@@ -131,6 +132,8 @@ function showSuiteData(data, suiteID) {
             <span class="text-success">✓ ${stats.passed}</span> /
             <span class="text-danger">✗ ${stats.failed}</span>
             ${stats.timeouts > 0 ? `/ <span class="text-warning">${stats.timeouts} timeouts</span>` : ''}
+            ${stats.flaky > 0 ? `/ <span class="text-warning">${stats.flaky} flaky</span>` : ''}
+            ${stats.skipped > 0 ? `/ <span class="text-secondary">${stats.skipped} skipped</span>` : ''}
             ${stats.failed > 0
                 ? '<span class="badge bg-danger ms-1">Fail</span>'
                 : '<span class="badge bg-success ms-1">Pass</span>'}
@@ -166,6 +169,7 @@ function showSuiteData(data, suiteID) {
                 className: 'test-name-column',
                 width: '65%',
                 responsivePriority: 0,
+                render: formatTestName,
             },
             // Status: pass or not.
             {
@@ -220,6 +224,44 @@ function showSuiteData(data, suiteID) {
     });
 }
 
+// addSubtestInfo sets the 'ancestors' (list of parent test names, outermost first)
+// and 'subtests' (number of direct subtests) of all test cases.
+function addSubtestInfo(testCases) {
+    for (let k in testCases) {
+        testCases[k].subtests = 0;
+    }
+    for (let k in testCases) {
+        let tc = testCases[k];
+        tc.ancestors = [];
+        let seen = new Set([k]);
+        for (let p = tc.parent; p && testCases[p] && !seen.has(String(p)); p = testCases[p].parent) {
+            seen.add(String(p));
+            tc.ancestors.unshift(testCases[p].name);
+        }
+        if (tc.parent && testCases[tc.parent]) {
+            testCases[tc.parent].subtests++;
+        }
+    }
+}
+
+// formatTestName renders the name column. Subtests are shown with the names of
+// their parent tests, which also makes them match a search for the parent.
+function formatTestName(name, type, row) {
+    let path = row.ancestors.concat([name]);
+    if (type === 'display') {
+        let s = '';
+        if (row.ancestors.length > 0) {
+            s += '<span class="text-secondary">' + html.encode(row.ancestors.join(' › ')) + ' › </span>';
+        }
+        s += html.encode(name);
+        if (row.subtests > 0) {
+            s += ' <span class="badge bg-secondary ms-1">' + row.subtests + ' subtests</span>';
+        }
+        return s;
+    }
+    return path.join(' › ');
+}
+
 // testSuiteTimes computes start/end/duration of a test suite.
 // The duration is returned in milliseconds.
 function testSuiteTimes(cases) {
@@ -340,15 +382,100 @@ function formatClientLogsList(suiteData, testIndex, clientInfo) {
             link.title = `Filtered: bytes ${instanceInfo.logOffsets.begin}-${instanceInfo.logOffsets.end}`;
         }
         links.push(link.outerHTML);
+        if (instanceInfo.rpcTranscript) {
+            let file = routes.resultsRoot + instanceInfo.rpcTranscript;
+            let rpcURL = routes.rpcTranscript(suiteData.suiteID, suiteData.name, testIndex, file);
+            let rpcLink = html.makeLink(rpcURL, 'RPC');
+            rpcLink.classList.add('log-link');
+            rpcLink.title = 'RPC transcript of ' + instanceInfo.name;
+            links.push('(' + rpcLink.outerHTML + ')');
+        }
     }
     return links.join(', ');
 }
 
+// formatArtifactsList turns the artifacts of a test into a list of links.
+function formatArtifactsList(artifacts) {
+    let links = [];
+    for (let artifact of artifacts) {
+        let url = routes.resultsRoot + artifact.file;
+        let link;
+        if (artifact.name) {
+            link = html.makeLink(url, artifact.name);
+            link.title = 'file attached by the test';
+        } else {
+            link = html.makeLink(url, artifact.client + ':' + artifact.path);
+            link.title = 'tar archive of ' + artifact.path + ' in container ' + artifact.clientId;
+        }
+        link.setAttribute('download', '');
+        links.push(link.outerHTML);
+    }
+    return links.join(', ');
+}
+
+// formatMeasurements describes the measurements recorded by a test.
+function formatMeasurements(measurements) {
+    let items = [];
+    for (let m of measurements) {
+        let desc = html.encode(m.name) + ': ' + m.value;
+        if (m.unit) {
+            desc += ' ' + html.encode(m.unit);
+        }
+        items.push(desc);
+    }
+    return items.join(', ');
+}
+
+// formatClientResources describes the resource usage of the clients of a test.
+function formatClientResources(clientInfo) {
+    let items = [];
+    for (let instanceID in clientInfo) {
+        let r = clientInfo[instanceID].resources;
+        if (!r) {
+            continue;
+        }
+        let desc = html.encode(clientInfo[instanceID].name) + ': ';
+        desc += 'peak memory ' + formatBytes(r.peakMemory);
+        desc += ', CPU ' + formatDuration(Math.round(r.cpuTime / 1e6));
+        desc += ', network in ' + formatBytes(r.networkRx) + ' / out ' + formatBytes(r.networkTx);
+        items.push(desc);
+    }
+    return items.join('; ');
+}
+
+// formatClientCrashes describes the clients of a test which have crashed.
+function formatClientCrashes(clientInfo) {
+    let items = [];
+    for (let instanceID in clientInfo) {
+        let exit = clientInfo[instanceID].exit;
+        if (!exit) {
+            continue;
+        }
+        let desc = html.encode(clientInfo[instanceID].name) + ': exit code ' + exit.exitCode;
+        if (exit.oomKilled) {
+            desc += ' (out of memory)';
+        }
+        items.push(desc);
+    }
+    return items.join('; ');
+}
+
 function formatTestStatus(summaryResult) {
+    if (summaryResult.pass && summaryResult.skipped) {
+        return '<span class="text-secondary">&#x2298; <b>Skipped</b></span>';
+    }
+    if (summaryResult.pass && summaryResult.flaky) {
+        return '<span class="text-warning">&#x2713; <b>Flaky</b></span>';
+    }
     if (summaryResult.pass) {
         return '<span class="text-success">&#x2713;</span>';
     }
-    let s = summaryResult.timeout ? 'Timeout' : 'Fail';
+    let s = 'Fail';
+    if (summaryResult.timeout) {
+        s = 'Timeout';
+    } else if (summaryResult.clientCrashed) {
+        s = 'Client crash';
+    }
     return '<span class="text-danger">&#x2715; <b>' + s + '</b></span>';
 }
 
@@ -379,6 +506,28 @@ function formatTestDetails(suiteData, row) {
         p.innerHTML = '<b>Duration:</b> ' + formatDuration(d.duration);
         container.appendChild(p);
     }
+    let usage = formatClientResources(d.clientInfo);
+    if (usage) {
+        let p = document.createElement('p');
+        p.innerHTML = '<b>Resources:</b> ' + usage;
+        container.appendChild(p);
+    }
+    let crashes = formatClientCrashes(d.clientInfo);
+    if (crashes) {
+        let p = document.createElement('p');
+        p.innerHTML = '<b>Crashed clients:</b> ' + crashes;
+        container.appendChild(p);
+    }
+    if (d.artifacts && d.artifacts.length > 0) {
+        let p = document.createElement('p');
+        p.innerHTML = '<b>Artifacts:</b> ' + formatArtifactsList(d.artifacts);
+        container.appendChild(p);
+    }
+    if (d.measurements && d.measurements.length > 0) {
+        let p = document.createElement('p');
+        p.innerHTML = '<b>Measurements:</b> ' + formatMeasurements(d.measurements);
+        container.appendChild(p);
+    }
 
     if (d.description != '') {
         let p = document.createElement('p');
@@ -411,6 +560,10 @@ function formatTestDetails(suiteData, row) {
         container.appendChild(p);
     }
 
+    if (d.attempts && d.attempts.length > 0) {
+        formatTestAttempts(suiteData, d, container);
+    }
+
     if (d.summaryResult.details) {
         // Test output is contained directly in the test, so it can just be displayed.
         // In order to avoid freezing the browser with lots of output, we limit the display to
@@ -446,6 +599,62 @@ function formatTestDetails(suiteData, row) {
     return container;
 }
 
+// formatTestAttempts adds the failed attempts of a retried test to the details box.
+function formatTestAttempts(suiteData, test, container) {
+    let p = document.createElement('p');
+    p.innerHTML = '<b>Failed attempts:</b>';
+    container.appendChild(p);
+
+    test.attempts.forEach(function (attempt, i) {
+        let el = document.createElement('details');
+        el.classList.add('test-attempt');
+        let summary = document.createElement('summary');
+        let duration = Date.parse(attempt.end) - Date.parse(attempt.start);
+        summary.innerHTML = 'Attempt ' + (i + 1) + ': ' + formatTestStatus(attempt.result) +
+            ' (' + formatDuration(duration) + ')';
+        el.appendChild(summary);
+        if (testHasClients(attempt)) {
+            let clients = document.createElement('p');
+            clients.innerHTML = '<b>Clients:</b> ' + formatClientLogsList(suiteData, test.testIndex, attempt.clientInfo);
+            el.appendChild(clients);
+        }
+        if (attempt.subtests) {
+            let items = Object.values(attempt.subtests).map(function (sub) {
+                return html.encode(sub.name) + ' ' + formatTestStatus(sub.summaryResult);
+            });
+            let subtests = document.createElement('p');
+            subtests.innerHTML = '<b>Subtests:</b> ' + items.join(', ');
+            el.appendChild(subtests);
+        }
+
+        // The attempt log is loaded when the attempt is expanded.
+        let loaded = false;
+        el.addEventListener('toggle', function () {
+            if (!el.open || loaded) {
+                return;
+            }
+            loaded = true;
+            if (attempt.result.details) {
+                let log = testlog.splitHeadTail(attempt.result.details, 25);
+                formatTestLog(suiteData, test.testIndex, log, el);
+                return;
+            }
+            if (!attempt.result.log) {
+                $(el).append('<p>Attempt has no log output.</p>');
+                return;
+            }
+            let url = routes.resultsRoot + suiteData.testDetailsLog;
+            let loader = new testlog.Loader(url, attempt.result.log);
+            loader.headAndTailLines(25, 2097152).then(function (log) {
+                formatTestLog(suiteData, test.testIndex, log, el);
+            }).catch(function (error) {
+                console.error(error);
+            });
+        });
+        container.appendChild(el);
+    });
+}
+
 // formatTestLog formats the test output.
 // logData is an object like { head: "...", tail: "...", hiddenLines: 10 }.
 function formatTestLog(suiteData, testIndex, logData, container) {
@@ -507,8 +716,13 @@ function highlightErrorsInTestOutput(content) {
 
 function calculateTestStats(cases) {
     return cases.reduce((stats, test) => {
-        if (test.summaryResult.pass) {
+        if (test.summaryResult.skipped) {
+            stats.skipped++;
+        } else if (test.summaryResult.pass) {
             stats.passed++;
+            if (test.summaryResult.flaky) {
+                stats.flaky++;
+            }
         } else {
             stats.failed++;
             if (test.summaryResult.timeout) {
@@ -516,5 +730,5 @@ function calculateTestStats(cases) {
             }
         }
         return stats;
-    }, { passed: 0, failed: 0, timeouts: 0 });
+    }, { passed: 0, failed: 0, timeouts: 0, flaky: 0, skipped: 0 });
 }
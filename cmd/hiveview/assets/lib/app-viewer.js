@@ -51,6 +51,11 @@ $(document).ready(function () {
 
     // Check for file name.
     let file = queryParam('file');
+    if (file && queryParam('transcript') === '1') {
+        showText('Loading RPC transcript...');
+        fetchTranscript(file, line);
+        return;
+    }
     if (file) {
         $('#fileload').val(file);
         showText('Loading file...');
@@ -235,6 +240,65 @@ function byteRangeToLineNumbers(text, byteRange) {
     return { start: startLine, end: endLine };
 }
 
+// fetchTranscript loads an RPC transcript and displays the recorded exchanges.
+async function fetchTranscript(url, line) {
+    let resultsRE = new RegExp('^' + routes.resultsRoot);
+    let text;
+    try {
+        showRawLink(url);
+        text = await load(url, 'text');
+    } catch (err) {
+        showError(`Failed to load ${url}`, err);
+        return;
+    }
+    showTitle('RPC transcript:', url.replace(resultsRE, ''));
+    showText(formatTranscript(text));
+    setHL(line, true);
+}
+
+// formatTranscript renders the exchanges of an RPC transcript (JSON lines) as text.
+function formatTranscript(text) {
+    let output = [];
+    for (let line of text.split('\n')) {
+        if (line.trim() === '') {
+            continue;
+        }
+        let ex;
+        try {
+            ex = JSON.parse(line);
+        } catch (err) {
+            output.push('!! invalid transcript line: ' + line, '');
+            continue;
+        }
+        let desc = `${ex.time} >> ${ex.method} :${ex.port}${ex.path} (${ex.durationMs} ms`;
+        if (ex.error) {
+            desc += ', error)';
+        } else {
+            desc += `, status ${ex.status})`;
+        }
+        output.push(desc);
+        if (ex.request !== undefined) {
+            output.push(formatTranscriptBody(ex.request));
+        }
+        if (ex.error) {
+            output.push('<< ERROR ' + ex.error);
+        } else if (ex.response !== undefined) {
+            output.push('<<', formatTranscriptBody(ex.response));
+        }
+        output.push('');
+    }
+    return output.join('\n');
+}
+
+// formatTranscriptBody formats a request or response body. Bodies which are not
+// JSON are stored as strings in the transcript.
+function formatTranscriptBody(body) {
+    if (typeof body === 'string') {
+        return body;
+    }
+    return JSON.stringify(body, null, 2);
+}
+
 // fetchTestLog loads the suite file and displays the output of a test.
 async function fetchTestLog(suiteFile, testIndex, line) {
     let data;
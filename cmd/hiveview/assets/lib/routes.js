@@ -34,6 +34,17 @@ export function clientLog(suiteID, suiteName, testIndex, file, logOffsets) {
     return 'viewer.html?' + params.toString();
 }
 
+export function rpcTranscript(suiteID, suiteName, testIndex, file) {
+    let params = new URLSearchParams({
+        'suiteid': suiteID,
+        'suitename': suiteName,
+        'testid': testIndex,
+        'file': file,
+        'transcript': '1',
+    });
+    return 'viewer.html?' + params.toString();
+}
+
 export function suite(suiteID, suiteName) {
     let params = new URLSearchParams({'suiteid': suiteID, 'suitename': suiteName});
     return 'suite.html?' + params.toString();
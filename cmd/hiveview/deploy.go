@@ -17,6 +17,7 @@ import (
 func hiveviewBundler(fsys fs.FS) *bundler {
 	entrypoints := []string{
 		"lib/app-index.js",
+		"lib/app-live.js",
 		"lib/app-suite.js",
 		"lib/app-viewer.js",
 		"lib/app.css",
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// exportResults converts all suite files in the log directory to the given formats.
+// The exported files are written to outputDir, using the name of the suite file.
+func exportResults(logdir, outputDir, formatList string) error {
+	formats, err := libhive.ParseResultFormats(formatList)
+	if err != nil {
+		return err
+	}
+	if len(formats) == 0 {
+		return errors.New("no result format given")
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+	fsys := os.DirFS(logdir)
+	return walkSummaryFiles(fsys, ".", func(suite *libhive.TestSuite, fi fs.FileInfo) error {
+		for _, format := range formats {
+			file := filepath.Join(outputDir, libhive.ExportFileName(fi.Name(), format))
+			if err := exportSuite(file, format, suite, fsys); err != nil {
+				return fmt.Errorf("%s: %v", fi.Name(), err)
+			}
+			fmt.Println("exported", file)
+		}
+		return nil
+	})
+}
+
+func exportSuite(file, format string, suite *libhive.TestSuite, fsys fs.FS) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return libhive.ExportSuite(f, format, suite, fsys)
+}
@@ -32,17 +32,17 @@ func logdirGC(dir string, cutoff time.Time, keepMin int) error {
 			oldest = suiteStart(suite)
 		}
 
-		// Add suite files and client logs.
+		// Add suite files, client logs and artifacts.
 		keptSuites++
 		usedFiles[fi.Name()] = struct{}{}
+		usedFiles[libhive.ExportFileName(fi.Name(), libhive.FormatJUnit)] = struct{}{}
+		usedFiles[libhive.ExportFileName(fi.Name(), libhive.FormatTAP)] = struct{}{}
 		usedFiles[suite.SimulatorLog] = struct{}{}
 		if suite.TestDetailsLog != "" {
 			usedFiles[suite.TestDetailsLog] = struct{}{}
 		}
 		for _, test := range suite.TestCases {
-			for _, client := range test.ClientInfo {
-				usedFiles[client.LogFile] = struct{}{}
-			}
+			addTestFiles(usedFiles, test)
 		}
 		return nil
 	})
@@ -61,6 +61,10 @@ func logdirGC(dir string, cutoff time.Time, keepMin int) error {
 		if d.IsDir() {
 			return nil // Don't delete directories.
 		}
+		// Build reports are kept as long as suites of the same age are kept.
+		if start, ok := libhive.ParseBuildReportFileName(path); ok && !start.Before(oldest) {
+			return nil
+		}
 		if _, used := usedFiles[path]; !used {
 			file := filepath.Join(dir, filepath.FromSlash(path))
 			// fmt.Println("rm", file)
@@ -73,6 +77,25 @@ func logdirGC(dir string, cutoff time.Time, keepMin int) error {
 	})
 }
 
+// addTestFiles adds the client logs and artifacts of a test to the used files,
+// including those of failed attempts and their subtests.
+func addTestFiles(usedFiles map[string]struct{}, test *libhive.TestCase) {
+	for _, client := range test.ClientInfo {
+		usedFiles[client.LogFile] = struct{}{}
+	}
+	for _, attempt := range test.Attempts {
+		for _, client := range attempt.ClientInfo {
+			usedFiles[client.LogFile] = struct{}{}
+		}
+		for _, sub := range attempt.Subtests {
+			addTestFiles(usedFiles, sub)
+		}
+	}
+	for _, artifact := range test.Artifacts {
+		usedFiles[artifact.File] = struct{}{}
+	}
+}
+
 func suiteStart(suite *libhive.TestSuite) time.Time {
 	for _, test := range suite.TestCases {
 		return test.Start
@@ -58,6 +58,8 @@ type listingEntry struct {
 	// Info about this run.
 	Passes   int               `json:"passes"`
 	Fails    int               `json:"fails"`
+	Flaky    int               `json:"flaky,omitempty"`   // passed after failed attempts
+	Skipped  int               `json:"skipped,omitempty"` // not run by the simulator
 	Timeout  bool              `json:"timeout"`
 	Clients  []string          `json:"clients"`  // client names involved in this run
 	Versions map[string]string `json:"versions"` // client versions
@@ -94,9 +96,15 @@ func suiteToEntry(s *libhive.TestSuite, file fs.FileInfo) listingEntry {
 			continue
 		}
 		e.NTests++
-		if test.SummaryResult.Pass {
+		switch {
+		case test.SummaryResult.Skipped:
+			e.Skipped++
+		case test.SummaryResult.Pass:
 			e.Passes++
-		} else {
+			if test.SummaryResult.Flaky {
+				e.Flaky++
+			}
+		default:
 			e.Fails++
 		}
 	}
@@ -160,6 +168,11 @@ func suiteValid(s *libhive.TestSuite) bool {
 	return s.Name != ""
 }
 
+func isBuildReport(f string) bool {
+	_, ok := libhive.ParseBuildReportFileName(f)
+	return ok
+}
+
 func skipFile(f string) bool {
-	return f == "errorReport.json" || f == "containerErrorReport.json" || f == "hive.json" || strings.HasPrefix(f, ".")
+	return f == "errorReport.json" || f == "containerErrorReport.json" || f == "hive.json" || isBuildReport(f) || strings.HasPrefix(f, ".")
 }
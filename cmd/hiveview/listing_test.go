@@ -7,7 +7,7 @@ import (
 	"testing/fstest"
 )
 
-// The suite contains two real tests (one pass, one fail) and a
+// The suite contains three real tests (one pass, one fail, one skipped) and a
 // multi-test context entry that owns shared clients. The context entry
 // must not be counted as a test, but its clients must still be listed.
 const listingTestSuite = `{
@@ -42,6 +42,13 @@ const listingTestSuite = `{
 			"end": "2023-11-03T09:00:03Z",
 			"summaryResult": {"pass": false},
 			"clientInfo": {}
+		},
+		"4": {
+			"name": "test-skip",
+			"start": "2023-11-03T09:00:03Z",
+			"end": "2023-11-03T09:00:03Z",
+			"summaryResult": {"pass": true, "skipped": true},
+			"clientInfo": {}
 		}
 	}
 }`
@@ -60,8 +67,8 @@ func TestGenerateListingSkipsMultiTestContext(t *testing.T) {
 	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
 		t.Fatalf("can't decode listing entry: %v", err)
 	}
-	if entry.NTests != 2 {
-		t.Errorf("wrong NTests: got %d, want 2", entry.NTests)
+	if entry.NTests != 3 {
+		t.Errorf("wrong NTests: got %d, want 3", entry.NTests)
 	}
 	if entry.Passes != 1 {
 		t.Errorf("wrong Passes: got %d, want 1", entry.Passes)
@@ -69,6 +76,9 @@ func TestGenerateListingSkipsMultiTestContext(t *testing.T) {
 	if entry.Fails != 1 {
 		t.Errorf("wrong Fails: got %d, want 1", entry.Fails)
 	}
+	if entry.Skipped != 1 {
+		t.Errorf("wrong Skipped: got %d, want 1", entry.Skipped)
+	}
 	// The context entry's clients must still be reported.
 	if len(entry.Clients) != 1 || entry.Clients[0] != "client-a" {
 		t.Errorf("wrong Clients: got %v, want [client-a]", entry.Clients)
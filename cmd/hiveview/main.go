@@ -4,12 +4,15 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/ethereum/hive/internal/libhive"
 )
 
 const (
@@ -23,6 +26,8 @@ func main() {
 		listing        = flag.Bool("listing", false, "Generates listing JSON to stdout")
 		deploy         = flag.Bool("deploy", false, "Compiles the frontend to a static directory")
 		gc             = flag.Bool("gc", false, "Deletes old log files")
+		export         = flag.String("export", "", "Converts result files to the given `formats` (comma-separated list of junit, tap)")
+		merge          = flag.Bool("merge", false, "Merges the results of sharded runs (arguments: output directory, result directories)")
 		gcKeepInterval = flag.Duration("keep", 5*durationMonth, "Time interval of past log files to keep (for -gc)")
 		gcKeepMin      = flag.Int("keep-min", 10, "Minimum number of suite outputs to keep (for -gc)")
 		config         serverConfig
@@ -33,6 +38,7 @@ func main() {
 	flag.StringVar(&config.logDir, "logdir", "workspace/logs", "Path to hive simulator log directory")
 	flag.StringVar(&config.assetsDir, "assets", "", "Path to static files directory. Serves baked-in assets when not set.")
 	flag.BoolVar(&config.disableBundle, "assets.nobundle", false, "Disables JS/CSS bundling (for development).")
+	flag.StringVar(&config.eventsURL, "events", "", "`URL` of the event stream of a running hive instance, shown on the live page (for -serve)")
 	flag.Parse()
 
 	log.SetFlags(log.LstdFlags)
@@ -47,6 +53,10 @@ func main() {
 		logdirGC(config.logDir, cutoff, *gcKeepMin)
 	case *deploy:
 		doDeploy(&config)
+	case *export != "":
+		doExport(&config, *export)
+	case *merge:
+		doMerge()
 	default:
 		log.Fatalf("Use -serve or -listing to select mode")
 	}
@@ -72,6 +82,49 @@ func doDeploy(config *serverConfig) {
 	}
 }
 
+// doExport converts the results in the log directory. The exported files are written to
+// the directory given as argument, or to the log directory when no argument is given.
+func doExport(config *serverConfig, format string) {
+	outputDir := config.logDir
+	if flag.NArg() > 0 {
+		outputDir = flag.Arg(0)
+	}
+	if err := exportResults(config.logDir, outputDir, format); err != nil {
+		log.Fatalf("-export: %v", err)
+	}
+}
+
+// doMerge combines the results of sharded runs. The first argument is the output
+// directory, followed by the result directories of the shards.
+func doMerge() {
+	if flag.NArg() < 2 {
+		log.Fatalf("-merge requires output directory and result directories as arguments")
+	}
+	outputDir, shardDirs := flag.Arg(0), flag.Args()[1:]
+	for _, dir := range shardDirs {
+		if sameDir(dir, outputDir) {
+			log.Fatalf("-merge: output directory %s is also a result directory", outputDir)
+		}
+	}
+	files, err := libhive.MergeResults(outputDir, shardDirs)
+	if err != nil {
+		log.Fatalf("-merge: %v", err)
+	}
+	for _, file := range files {
+		fmt.Println("merged", filepath.Join(outputDir, file))
+	}
+}
+
+// sameDir reports whether a and b are the same directory.
+func sameDir(a, b string) bool {
+	sa, errA := os.Stat(a)
+	sb, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return os.SameFile(sa, sb)
+}
+
 // copyFS walks the specified root directory on src and copies directories and
 // files to dest filesystem.
 func copyFS(dest string, src fs.FS) error {
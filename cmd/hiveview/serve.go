@@ -7,6 +7,8 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
 	"strings"
 
@@ -21,6 +23,7 @@ type serverConfig struct {
 	logDir        string
 	assetsDir     string
 	disableBundle bool
+	eventsURL     string // event stream of a running hive instance
 }
 
 func (cfg *serverConfig) assetFS() (fs.FS, error) {
@@ -56,6 +59,13 @@ func runServer(config serverConfig) {
 	mux := mux.NewRouter()
 	mux.Handle("/listing.jsonl", listingHandler).Methods("GET")
 	mux.PathPrefix("/results").Handler(http.StripPrefix("/results/", logHandler))
+	if config.eventsURL != "" {
+		target, err := url.Parse(config.eventsURL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			log.Fatalf("-events: invalid URL %q", config.eventsURL)
+		}
+		mux.Handle("/events", eventsProxy(target)).Methods("GET")
+	}
 	mux.PathPrefix("/").Handler(serveFiles{deployFS})
 
 	// Start the server.
@@ -67,6 +77,18 @@ func runServer(config serverConfig) {
 	http.Serve(l, mux)
 }
 
+// eventsProxy relays the event stream of hive (see hive --events.addr) to the live
+// page. The stream goes through hiveview, so the page doesn't need access to hive.
+func eventsProxy(target *url.URL) http.Handler {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL = new(url.URL)
+			*r.Out.URL = *target
+			r.Out.Host = target.Host
+		},
+	}
+}
+
 type serveListing struct{ fsys fs.FS }
 
 func (h serveListing) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// This test checks that the event stream of hive is relayed to the live page.
+func TestEventsProxy(t *testing.T) {
+	feed := libhive.NewEventFeed()
+	hive := httptest.NewServer(feed)
+	defer hive.Close()
+	target, _ := url.Parse(hive.URL + "/events")
+	srv := httptest.NewServer(eventsProxy(target))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("content-type"); ct != "text/event-stream" {
+		t.Fatalf("wrong content type %q", ct)
+	}
+
+	// Wait for the initial comment, so the subscription exists before sending.
+	r := bufio.NewReader(resp.Body)
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(line, ": connected") {
+		t.Fatalf("unexpected first line %q (err %v)", line, err)
+	}
+	feed.Send(libhive.Event{Type: libhive.EventSimulationStart, Simulator: "my-sim"})
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal("stream ended:", err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if !strings.Contains(line, `"simulator":"my-sim"`) {
+				t.Fatalf("wrong event data %q", line)
+			}
+			return
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -34,6 +35,48 @@ func (c *Client) FetchTestLog(detailsLog string, begin, end int64) (string, erro
 	return string(data), nil
 }
 
+// TestPath returns the names of a test case and its parent tests, outermost first.
+func (r *TestSuiteResult) TestPath(id string) []string {
+	var path []string
+	seen := make(map[string]bool)
+	for id != "0" && !seen[id] {
+		tc, ok := r.TestCases[id]
+		if !ok {
+			break
+		}
+		seen[id] = true
+		path = append([]string{tc.Name}, path...)
+		id = strconv.Itoa(tc.Parent)
+	}
+	return path
+}
+
+// ClientMeasurements returns the values of a measurement by client name. When several
+// test cases of a client recorded the measurement, their average is returned. Test
+// cases without a client in their name are ignored.
+func (r *TestSuiteResult) ClientMeasurements(name string) (values map[string]float64, unit string) {
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, tc := range r.TestCases {
+		cl := ExtractClient(tc.Name)
+		if cl == "" {
+			continue
+		}
+		for _, m := range tc.Measurements {
+			if m.Name == name {
+				sums[cl] += m.Value
+				counts[cl]++
+				unit = m.Unit
+			}
+		}
+	}
+	values = make(map[string]float64, len(sums))
+	for cl, sum := range sums {
+		values[cl] = sum / float64(counts[cl])
+	}
+	return values, unit
+}
+
 var clientRegex = regexp.MustCompile(`\(([^)]+)\)$`)
 
 // ExtractClient extracts the client name from a test case name. Test names
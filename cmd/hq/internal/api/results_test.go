@@ -1,6 +1,9 @@
 package api
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestExtractClient(t *testing.T) {
 	tests := []struct {
@@ -78,3 +81,43 @@ func TestCompileGlob(t *testing.T) {
 		})
 	}
 }
+
+func TestTestPath(t *testing.T) {
+	r := &TestSuiteResult{TestCases: map[string]TestCase{
+		"1": {Name: "parent"},
+		"2": {Name: "child", Parent: 1},
+		"3": {Name: "grandchild", Parent: 2},
+		"4": {Name: "orphan", Parent: 9},
+	}}
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"1", "parent"},
+		{"2", "parent/child"},
+		{"3", "parent/child/grandchild"},
+		{"4", "orphan"},
+		{"5", ""},
+	}
+	for _, tc := range tests {
+		if got := strings.Join(r.TestPath(tc.id), "/"); got != tc.want {
+			t.Errorf("TestPath(%s) = %q, want %q", tc.id, got, tc.want)
+		}
+	}
+}
+
+func TestClientMeasurements(t *testing.T) {
+	r := &TestSuiteResult{TestCases: map[string]TestCase{
+		"1": {Name: "sync (geth)", Measurements: []Measurement{{Name: "time", Value: 10, Unit: "s"}}},
+		"2": {Name: "sync again (geth)", Measurements: []Measurement{{Name: "time", Value: 20, Unit: "s"}}},
+		"3": {Name: "sync (besu)", Measurements: []Measurement{{Name: "time", Value: 5, Unit: "s"}, {Name: "peers", Value: 2}}},
+		"4": {Name: "no client", Measurements: []Measurement{{Name: "time", Value: 1, Unit: "s"}}},
+	}}
+	values, unit := r.ClientMeasurements("time")
+	if unit != "s" {
+		t.Errorf("wrong unit %q", unit)
+	}
+	if len(values) != 2 || values["geth"] != 15 || values["besu"] != 5 {
+		t.Errorf("wrong values %v", values)
+	}
+}
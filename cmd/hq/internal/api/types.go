@@ -20,6 +20,8 @@ type ListingEntry struct {
 	NTests   int               `json:"ntests"`
 	Passes   int               `json:"passes"`
 	Fails    int               `json:"fails"`
+	Flaky    int               `json:"flaky"`
+	Skipped  int               `json:"skipped"`
 	Timeout  bool              `json:"timeout"`
 	Clients  []string          `json:"clients"`
 	Versions map[string]string `json:"versions"`
@@ -49,12 +51,23 @@ type TestCase struct {
 	End           time.Time             `json:"end"`
 	SummaryResult SummaryResult         `json:"summaryResult"`
 	ClientInfo    map[string]ClientInfo `json:"clientInfo"`
+	Parent        int                   `json:"parent"` // case ID of the parent test, zero if none
+	Measurements  []Measurement         `json:"measurements"`
+}
+
+// Measurement is a numeric value recorded by a test case.
+type Measurement struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
 }
 
 // SummaryResult is the pass/fail outcome of a test case, plus the byte range
 // into the suite's details log that holds the case's log output.
 type SummaryResult struct {
 	Pass    bool   `json:"pass"`
+	Flaky   bool   `json:"flaky"`   // passed after failed attempts
+	Skipped bool   `json:"skipped"` // not run by the simulator
 	Details string `json:"details"`
 	Log     struct {
 		Begin int64 `json:"begin"`
@@ -0,0 +1,32 @@
+package display
+
+import (
+	"math"
+	"strings"
+)
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline renders the values as a line of bar characters scaled between the
+// minimum and maximum value. NaN values are shown as a space.
+func Sparkline(values []float64) string {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		switch {
+		case math.IsNaN(v):
+			b.WriteRune(' ')
+		case hi == lo:
+			b.WriteRune(sparkBars[len(sparkBars)/2])
+		default:
+			i := int((v - lo) / (hi - lo) * float64(len(sparkBars)-1))
+			b.WriteRune(sparkBars[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,26 @@
+package display
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"rising", []float64{0, 1, 2, 3, 4, 5, 6, 7}, "▁▂▃▄▅▆▇█"},
+		{"constant", []float64{3, 3, 3}, "▅▅▅"},
+		{"missing", []float64{1, math.NaN(), 2}, "▁ █"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Sparkline(tc.values); got != tc.want {
+				t.Errorf("Sparkline(%v) = %q, want %q", tc.values, got, tc.want)
+			}
+		})
+	}
+}
@@ -208,6 +208,16 @@ func PassFail(pass bool) string {
 	return Red.Sprint("FAIL")
 }
 
+// Flaky returns a colored flaky status string.
+func Flaky() string {
+	return Yellow.Sprint("FLAKY")
+}
+
+// Skipped returns a colored skipped status string.
+func Skipped() string {
+	return Cyan.Sprint("SKIP")
+}
+
 // PassFailCount returns a colored string like "10/12".
 func PassFailCount(passes, total int) string {
 	if passes == total {
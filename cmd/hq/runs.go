@@ -43,7 +43,7 @@ func runsCommand(args []string) {
 		entries = entries[:*limit]
 	}
 
-	t := display.NewTable([]string{"Name", "Clients", "Tests", "Pass", "Fail", "When", "File"})
+	t := display.NewTable([]string{"Name", "Clients", "Tests", "Pass", "Fail", "Skip", "When", "File"})
 	for _, e := range entries {
 		t.Append([]string{
 			e.Name,
@@ -51,6 +51,7 @@ func runsCommand(args []string) {
 			fmt.Sprintf("%d", e.NTests),
 			fmt.Sprintf("%d", e.Passes),
 			fmt.Sprintf("%d", e.Fails),
+			fmt.Sprintf("%d", e.Skipped),
 			api.FormatTime(e.Start),
 			e.FileName,
 		})
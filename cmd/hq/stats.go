@@ -3,7 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"maps"
+	"math"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/ethereum/hive/cmd/hq/internal/api"
@@ -16,7 +20,9 @@ func statsCommand(args []string) {
 		fmt.Fprintln(fs.Output(), "Usage: hq stats -sim <name> [flags]")
 		fmt.Fprintln(fs.Output(), "\nAggregate pass/fail rates across runs. Without -client, shows a row per")
 		fmt.Fprintln(fs.Output(), "client across the last -last runs. With -client, shows a row per run for")
-		fmt.Fprintln(fs.Output(), "that client.")
+		fmt.Fprintln(fs.Output(), "that client. Skipped tests are counted separately and don't affect the rate.")
+		fmt.Fprintln(fs.Output(), "\nWith -measure, shows the value of a test measurement per run and client")
+		fmt.Fprintln(fs.Output(), "instead, followed by a chart of each client's values over time.")
 		fs.PrintDefaults()
 	}
 	addGlobalFlags(fs)
@@ -24,6 +30,7 @@ func statsCommand(args []string) {
 		sim      = fs.String("sim", "", "Simulator name (required)")
 		clientFl = fs.String("client", "", "Filter by client name")
 		last     = fs.Int("last", 10, "Number of recent runs to analyze")
+		measure  = fs.String("measure", "", "Show values of the named measurement")
 	)
 	fs.Parse(args)
 	applyGlobals()
@@ -51,9 +58,14 @@ func statsCommand(args []string) {
 		entries = entries[:*last]
 	}
 
+	if *measure != "" {
+		measurementStats(client, entries, *measure, *clientFl)
+		return
+	}
+
 	if *clientFl != "" {
 		// Per-run stats for a specific client.
-		t := display.NewTable([]string{"Run", "Tests", "Pass", "Fail", "Rate", "When"})
+		t := display.NewTable([]string{"Run", "Tests", "Pass", "Fail", "Skip", "Rate", "When"})
 		for _, e := range entries {
 			result, err := client.FetchResult(e.FileName)
 			if err != nil {
@@ -61,7 +73,7 @@ func statsCommand(args []string) {
 				continue
 			}
 
-			passes, fails := countForClient(result, *clientFl)
+			passes, fails, skipped := countForClient(result, *clientFl)
 			total := passes + fails
 			rate := "N/A"
 			if total > 0 {
@@ -69,9 +81,10 @@ func statsCommand(args []string) {
 			}
 			t.Append([]string{
 				e.FileName,
-				fmt.Sprintf("%d", total),
+				fmt.Sprintf("%d", total+skipped),
 				fmt.Sprintf("%d", passes),
 				fmt.Sprintf("%d", fails),
+				fmt.Sprintf("%d", skipped),
 				rate,
 				api.FormatTime(e.Start),
 			})
@@ -82,9 +95,10 @@ func statsCommand(args []string) {
 
 	// Aggregate stats per client across runs.
 	type clientStats struct {
-		passes int
-		fails  int
-		runs   int
+		passes  int
+		fails   int
+		skipped int
+		runs    int
 	}
 	stats := make(map[string]*clientStats)
 
@@ -95,16 +109,19 @@ func statsCommand(args []string) {
 			continue
 		}
 
-		clientCounts := make(map[string][2]int) // [passes, fails]
+		clientCounts := make(map[string][3]int) // [passes, fails, skipped]
 		for _, tc := range result.TestCases {
 			cl := api.ExtractClient(tc.Name)
 			if cl == "" {
 				continue
 			}
 			counts := clientCounts[cl]
-			if tc.SummaryResult.Pass {
+			switch {
+			case tc.SummaryResult.Skipped:
+				counts[2]++
+			case tc.SummaryResult.Pass:
 				counts[0]++
-			} else {
+			default:
 				counts[1]++
 			}
 			clientCounts[cl] = counts
@@ -118,11 +135,12 @@ func statsCommand(args []string) {
 			}
 			s.passes += counts[0]
 			s.fails += counts[1]
+			s.skipped += counts[2]
 			s.runs++
 		}
 	}
 
-	t := display.NewTable([]string{"Client", "Runs", "Total Tests", "Pass", "Fail", "Rate"})
+	t := display.NewTable([]string{"Client", "Runs", "Total Tests", "Pass", "Fail", "Skip", "Rate"})
 	for cl, s := range stats {
 		total := s.passes + s.fails
 		rate := "N/A"
@@ -132,26 +150,110 @@ func statsCommand(args []string) {
 		t.Append([]string{
 			cl,
 			fmt.Sprintf("%d", s.runs),
-			fmt.Sprintf("%d", total),
+			fmt.Sprintf("%d", total+s.skipped),
 			fmt.Sprintf("%d", s.passes),
 			fmt.Sprintf("%d", s.fails),
+			fmt.Sprintf("%d", s.skipped),
 			rate,
 		})
 	}
 	t.Render()
 }
 
-func countForClient(result *api.TestSuiteResult, clientName string) (passes, fails int) {
+func countForClient(result *api.TestSuiteResult, clientName string) (passes, fails, skipped int) {
 	for _, tc := range result.TestCases {
 		cl := api.ExtractClient(tc.Name)
 		if !strings.Contains(strings.ToLower(cl), strings.ToLower(clientName)) {
 			continue
 		}
-		if tc.SummaryResult.Pass {
+		switch {
+		case tc.SummaryResult.Skipped:
+			skipped++
+		case tc.SummaryResult.Pass:
 			passes++
-		} else {
+		default:
 			fails++
 		}
 	}
 	return
 }
+
+// measurementStats shows the values of a measurement across runs, oldest run first.
+func measurementStats(client *api.Client, entries []api.ListingEntry, name, clientFilter string) {
+	var (
+		runs    []api.ListingEntry
+		values  []map[string]float64
+		clients = make(map[string]bool)
+		unit    string
+	)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		result, err := client.FetchResult(e.FileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: skipping %s: %v\n", e.FileName, err)
+			continue
+		}
+		v, u := result.ClientMeasurements(name)
+		for cl := range v {
+			if clientFilter != "" && !strings.Contains(strings.ToLower(cl), strings.ToLower(clientFilter)) {
+				delete(v, cl)
+				continue
+			}
+			clients[cl] = true
+		}
+		if len(v) == 0 {
+			continue
+		}
+		if u != "" {
+			unit = u
+		}
+		runs = append(runs, e)
+		values = append(values, v)
+	}
+	if len(runs) == 0 {
+		fmt.Printf("No runs with measurement %q found.\n", name)
+		return
+	}
+
+	names := slices.Sorted(maps.Keys(clients))
+	t := display.NewTable(append([]string{"Run", "When"}, names...))
+	for i, e := range runs {
+		row := []string{e.FileName, api.FormatTime(e.Start)}
+		for _, cl := range names {
+			cell := "-"
+			if v, ok := values[i][cl]; ok {
+				cell = strconv.FormatFloat(v, 'g', 6, 64)
+			}
+			row = append(row, cell)
+		}
+		t.Append(row)
+	}
+	t.Render()
+
+	fmt.Printf("\n%s", name)
+	if unit != "" {
+		fmt.Printf(" (%s)", unit)
+	}
+	fmt.Println(", oldest run first:")
+	chart := display.NewTable([]string{"Client", "Min", "Max", "Trend"})
+	for _, cl := range names {
+		series := make([]float64, len(runs))
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for i := range runs {
+			v, ok := values[i][cl]
+			if !ok {
+				series[i] = math.NaN()
+				continue
+			}
+			series[i] = v
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+		chart.Append([]string{
+			cl,
+			strconv.FormatFloat(lo, 'g', 6, 64),
+			strconv.FormatFloat(hi, 'g', 6, 64),
+			display.Sparkline(series),
+		})
+	}
+	chart.Render()
+}
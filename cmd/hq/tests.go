@@ -3,7 +3,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"regexp"
+	"slices"
 	"sort"
+	"strings"
 
 	"github.com/ethereum/hive/cmd/hq/internal/api"
 	"github.com/ethereum/hive/cmd/hq/internal/display"
@@ -15,15 +18,19 @@ func testsCommand(args []string) {
 		fmt.Fprintln(fs.Output(), "Usage: hq tests [flags] [run-file]")
 		fmt.Fprintln(fs.Output(), "\nList test cases in a run with pass/fail status. If no run-file is given,")
 		fmt.Fprintln(fs.Output(), "uses the most recent run matching -sim and -client. With -failed, only")
-		fmt.Fprintln(fs.Output(), "failing tests are shown together with their error details.")
+		fmt.Fprintln(fs.Output(), "failing tests are shown together with their error details. With -flaky,")
+		fmt.Fprintln(fs.Output(), "only tests which passed after failed attempts are shown. Subtests are listed")
+		fmt.Fprintln(fs.Output(), "below their parent test; with -parent, only subtests of matching tests are shown.")
 		fs.PrintDefaults()
 	}
 	addGlobalFlags(fs)
 	var (
-		sim      = fs.String("sim", "", "Filter runs by simulator name")
-		clientFl = fs.String("client", "", "Filter by client name")
-		testPat  = fs.String("test", "", "Filter by test name (glob pattern)")
-		onlyFail = fs.Bool("failed", false, "Only show failing tests (with error details)")
+		sim       = fs.String("sim", "", "Filter runs by simulator name")
+		clientFl  = fs.String("client", "", "Filter by client name")
+		testPat   = fs.String("test", "", "Filter by test name (glob pattern)")
+		parentPat = fs.String("parent", "", "Only show subtests of tests matching this name (glob pattern)")
+		onlyFail  = fs.Bool("failed", false, "Only show failing tests (with error details)")
+		onlyFlaky = fs.Bool("flaky", false, "Only show flaky tests")
 	)
 	fs.Parse(args)
 	applyGlobals()
@@ -33,6 +40,10 @@ func testsCommand(args []string) {
 	if err != nil {
 		fatalf("invalid -test pattern: %v", err)
 	}
+	parentRE, err := api.CompileGlob(*parentPat)
+	if err != nil {
+		fatalf("invalid -parent pattern: %v", err)
+	}
 
 	client, err := newClient()
 	if err != nil {
@@ -62,21 +73,34 @@ func testsCommand(args []string) {
 
 	type entry struct {
 		name    string
+		path    []string // names of the parent tests and the test itself
 		pass    bool
+		flaky   bool
+		skipped bool
 		details string
 	}
 
 	var entries []entry
-	for _, tc := range result.TestCases {
+	for id, tc := range result.TestCases {
 		if *onlyFail && tc.SummaryResult.Pass {
 			continue
 		}
+		if *onlyFlaky && !tc.SummaryResult.Flaky {
+			continue
+		}
 		if _, ok := matchTestCase(tc, *clientFl, testRE); !ok {
 			continue
 		}
+		path := result.TestPath(id)
+		if parentRE != nil && !matchAny(parentRE, path[:len(path)-1]) {
+			continue
+		}
 		entries = append(entries, entry{
 			name:    tc.Name,
+			path:    path,
 			pass:    tc.SummaryResult.Pass,
+			flaky:   tc.SummaryResult.Flaky,
+			skipped: tc.SummaryResult.Skipped,
 			details: tc.SummaryResult.Details,
 		})
 	}
@@ -84,14 +108,17 @@ func testsCommand(args []string) {
 	if len(entries) == 0 {
 		if *onlyFail {
 			fmt.Println("No failures found.")
+		} else if *onlyFlaky {
+			fmt.Println("No flaky tests found.")
 		} else {
 			fmt.Println("No matching tests found.")
 		}
 		return
 	}
 
+	// Sorting by path lists subtests after their parent.
 	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].name < entries[j].name
+		return slices.Compare(entries[i].path, entries[j].path) < 0
 	})
 
 	if *onlyFail {
@@ -103,20 +130,43 @@ func testsCommand(args []string) {
 			if len(details) > 80 {
 				details = details[:77] + "..."
 			}
-			t.Append([]string{e.name, details})
+			t.Append([]string{strings.Join(e.path, " / "), details})
 		}
 		t.Render()
 		return
 	}
 
-	passes := 0
+	passes, skipped := 0, 0
 	t := display.NewTable([]string{"Test", "Status"})
 	for _, e := range entries {
-		t.Append([]string{e.name, display.PassFail(e.pass)})
-		if e.pass {
+		status := display.PassFail(e.pass)
+		switch {
+		case e.skipped:
+			status = display.Skipped()
+			skipped++
+		case e.flaky:
+			status = display.Flaky()
+		}
+		name := strings.Repeat("  ", len(e.path)-1) + e.name
+		t.Append([]string{name, status})
+		if e.pass && !e.skipped {
 			passes++
 		}
 	}
 	t.Render()
-	fmt.Printf("\n%s passing\n", display.PassFailCount(passes, len(entries)))
+	fmt.Printf("\n%s passing", display.PassFailCount(passes, len(entries)-skipped))
+	if skipped > 0 {
+		fmt.Printf(", %d skipped", skipped)
+	}
+	fmt.Println()
+}
+
+// matchAny reports whether any of the names matches re.
+func matchAny(re *regexp.Regexp, names []string) bool {
+	for _, name := range names {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
 }
@@ -1,20 +1,31 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/hive/internal/libdocker"
 	"github.com/ethereum/hive/internal/libhive"
+	"github.com/ethereum/hive/internal/libk8s"
+	"github.com/ethereum/hive/internal/libpodman"
+	"github.com/ethereum/hive/internal/simapi"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/lmittmann/tint"
 )
@@ -43,6 +54,10 @@ func (args *buildArgs) Set(value string) error {
 func main() {
 	var (
 		testResultsRoot = flag.String("results-root", "workspace/logs", "Target `directory` for results files and logs.")
+		resultsFormat   = flag.String("results.format", "", "Comma separated `list` of additional result formats (junit, tap).")
+		eventsAddr      = flag.String("events.addr", "", "Listening `address` of the event stream endpoint. Serves progress events at /events.")
+		resumeDir       = flag.String("resume", "", "Results `directory` of a previous run. Tests which passed in that run are skipped.")
+		replayFile      = flag.String("replay", "", "Reruns the images and settings recorded in the hive.json `file` of a previous run.")
 		loglevelFlag    = flag.Int("loglevel", 3, "Log `level` for system events. Supports values 0-5.")
 		dockerAuth      = flag.Bool("docker.auth", false, `Enable docker authentication from system config files. The following files are checked in the order listed:
 If the environment variable DOCKER_CONFIG is set to a non-empty string:
@@ -52,28 +67,44 @@ Otherwise, it looks for files in the $HOME directory:
 - $HOME/.docker/plaintext-passwords.json
 - $HOME/.docker/config.json
 - $HOME/.dockercfg`)
+		backend               = flag.String("backend", "docker", "Container `engine` used to run containers (docker, podman, kubernetes).")
 		dockerEndpoint        = flag.String("docker.endpoint", "", "Endpoint of the local Docker daemon.")
+		podmanEndpoint        = flag.String("podman.endpoint", "", "Endpoint of the local Podman service. Defaults to the rootless user socket.")
+		k8sKubeconfig         = flag.String("k8s.kubeconfig", "", "Kubeconfig `file` of the cluster. Defaults to $KUBECONFIG or ~/.kube/config.")
+		k8sContext            = flag.String("k8s.context", "", "Kubeconfig `context` to use. Defaults to the current context.")
+		k8sNamespace          = flag.String("k8s.namespace", "", "Kubernetes `namespace` in which pods are created.")
+		k8sRegistry           = flag.String("k8s.registry", "", "Image registry `address` used by the cluster. Built images are pushed there.")
 		dockerNoCache         = flag.String("docker.nocache", "", "Regular `expression` selecting the docker images to forcibly rebuild.")
 		dockerPull            = flag.Bool("docker.pull", false, "Refresh base images when building images.")
 		dockerOutput          = flag.Bool("docker.output", false, "Relay all docker output to stderr.")
 		dockerBuildOutput     = flag.Bool("docker.buildoutput", false, "Relay only docker build output to stderr.")
+		buildConcurrency      = flag.Int("build.concurrency", 1, "Max `number` of client images built at the same time.")
+		buildStrict           = flag.Bool("build.strict", false, "Fail the run if any client image fails to build.")
 		simPattern            = flag.String("sim", "", "Regular `expression` selecting the simulators to run.")
 		simTestPattern        = flag.String("sim.limit", "", "Regular `expression` selecting tests/suites (interpreted by simulators).")
 		simTestExact          = flag.Bool("sim.limit.exact", false, "Exact `expression` match for tests/suites (interpreted by simulators).")
+		simShard              = flag.String("sim.shard", "", "Runs only the `i/n`th part of the tests, for splitting a run across machines (interpreted by simulators).")
 		simParallelism        = flag.Int("sim.parallelism", 1, "Max `number` of parallel clients/containers (interpreted by simulators).")
-		simRandomSeed         = flag.Int("sim.randomseed", 0, "Randomness seed number (interpreted by simulators).")
+		simRetries            = flag.Int("sim.retries", 0, "Max `number` of times a failed test is run again (interpreted by simulators).")
+		simConcurrency        = flag.Int("sim.concurrency", 1, "Max `number` of simulators running at the same time.")
+		simRandomSeed         = flag.Int("sim.randomseed", 0, "Randomness seed number (interpreted by simulators). A random seed is chosen when unset.")
 		simTestLimit          = flag.Int("sim.testlimit", 0, "[DEPRECATED] Max `number` of tests to execute per client (interpreted by simulators).")
 		simTimeLimit          = flag.Duration("sim.timelimit", 0, "Simulation `timeout`. Hive aborts the simulator if it exceeds this time.")
+		simTestTimeout        = flag.Duration("sim.testtimeout", 0, "Default `timeout` of a single test. Hive ends tests which exceed this time.")
+		simRecordRPC          = flag.Bool("sim.record-rpc", false, "Record the client RPC traffic of all tests (interpreted by simulators).")
 		simLogLevel           = flag.Int("sim.loglevel", 3, "Selects log `level` of client instances. Supports values 0-5.")
+		simKeepFailed         = flag.Bool("sim.keep-failed", false, "Keep the client containers of failed tests running until hive is interrupted.")
+		simPauseOnFailure     = flag.Bool("sim.pause-on-failure", false, "Pause the simulation when a test fails, until enter is pressed.")
+		simListTests          = flag.Bool("list-tests", false, "Print the suites and tests of the simulators as JSON, without running any tests.")
 		simDevMode            = flag.Bool("dev", false, "Only starts the simulator API endpoint (listening at 127.0.0.1:3000 by default) without starting any simulators.")
 		simDevModeAPIEndpoint = flag.String("dev.addr", "127.0.0.1:3000", "Endpoint that the simulator API listens on")
 		useCredHelper         = flag.Bool("docker.cred-helper", false, "(DEPRECATED) Use --docker.auth instead.")
 
 		// Cleanup flags
-		cleanupContainers = flag.Bool("cleanup", false, "Clean up Hive containers instead of running simulations")
+		cleanupContainers = flag.Bool("cleanup", false, "Clean up Hive containers and snapshot images instead of running simulations")
 		cleanupDryRun     = flag.Bool("cleanup.dry-run", false, "Show what containers would be cleaned up without actually removing them")
 		cleanupInstance   = flag.String("cleanup.instance", "", "Clean up containers from specific Hive instance ID only")
-		cleanupType       = flag.String("cleanup.type", "", "Clean up specific container type only (client, simulator, proxy)")
+		cleanupType       = flag.String("cleanup.type", "", "Clean up specific container type only (client, simulator, proxy, snapshot)")
 		cleanupOlderThan  = flag.Duration("cleanup.older-than", 0, "Clean up containers older than specified duration (e.g., 1h, 24h)")
 		listContainers    = flag.Bool("list", false, "List Hive containers instead of running simulations")
 
@@ -89,6 +120,8 @@ Otherwise, it looks for files in the $HOME directory:
 			"If a very long chain is imported, this timeout may need to be quite large.\n"+
 			"A lower value means that hive won't wait as long in case the node crashes and\n"+
 			"never opens the RPC port.")
+		clientLimit = flag.Int("client.limit", 0, "Max `number` of client containers running at the same time, across all simulators.\n"+
+			"Zero means there is no limit.")
 	)
 
 	// Add the sim.buildarg flag multiple times to allow multiple build arguments.
@@ -127,6 +160,17 @@ Otherwise, it looks for files in the $HOME directory:
 		slog.Warn("--sim is ignored when using --dev mode")
 		simList = nil
 	}
+	var replay *libhive.ReplayManifest
+	if *replayFile != "" {
+		if *backend == "kubernetes" {
+			fatal("--replay is not supported with the kubernetes backend")
+		}
+		replay, err = libhive.LoadReplayManifest(*replayFile)
+		if err != nil {
+			fatal("--replay:", err)
+		}
+		simList = replay.SimulatorList()
+	}
 	if *simTestExact && *simTestPattern != "" {
 		pattern := "^" + regexp.QuoteMeta(*simTestPattern) + "$"
 		simTestPattern = &pattern
@@ -151,7 +195,23 @@ Otherwise, it looks for files in the $HOME directory:
 	} else if *dockerBuildOutput {
 		dockerConfig.BuildOutput = os.Stderr
 	}
-	builder, cb, err := libdocker.Connect(*dockerEndpoint, dockerConfig)
+	var (
+		builder libhive.Builder
+		cb      libhive.ContainerBackend
+	)
+	switch *backend {
+	case "docker":
+		builder, cb, err = libdocker.Connect(*dockerEndpoint, dockerConfig)
+	case "podman":
+		builder, cb, err = libpodman.Connect(*podmanEndpoint, dockerConfig)
+	case "kubernetes":
+		builder, cb, err = connectKubernetes(*dockerEndpoint, dockerConfig, *k8sKubeconfig, *k8sContext, &libk8s.Config{
+			Namespace: *k8sNamespace,
+			Registry:  *k8sRegistry,
+		})
+	default:
+		fatal("unknown --backend", *backend)
+	}
 	if err != nil {
 		fatal(err)
 	}
@@ -205,17 +265,63 @@ Otherwise, it looks for files in the $HOME directory:
 		LogDir:             *testResultsRoot,
 		SimLogLevel:        *simLogLevel,
 		SimTestPattern:     *simTestPattern,
+		SimShard:           *simShard,
 		SimParallelism:     *simParallelism,
 		SimRandomSeed:      *simRandomSeed,
+		SimRetries:         *simRetries,
 		SimDurationLimit:   *simTimeLimit,
+		SimTestTimeout:     *simTestTimeout,
+		SimRecordRPC:       *simRecordRPC,
 		ClientStartTimeout: *clientTimeout,
+		SimConcurrency:     *simConcurrency,
+		ClientLimit:        *clientLimit,
+		KeepFailed:         *simKeepFailed,
+		ListTests:          *simListTests,
+	}
+	if err := checkShard(env.SimShard); err != nil {
+		fatal("--sim.shard:", err)
+	}
+	if *simKeepFailed && *clientLimit > 0 {
+		// Kept clients would never release their slot.
+		fatal("--sim.keep-failed can't be used with --client.limit")
+	}
+	if *simPauseOnFailure {
+		env.PauseOnFailure = pauseOnFailure
+	}
+	if replay != nil {
+		replay.ApplyEnv(&env)
+	} else if env.SimRandomSeed == 0 {
+		// Choose the seed here, so it is recorded in hive.json.
+		env.SimRandomSeed = rand.Intn(math.MaxInt32) + 1
+		slog.Info("using random seed", "seed", env.SimRandomSeed)
+	}
+	env.ResultFormats, err = libhive.ParseResultFormats(*resultsFormat)
+	if err != nil {
+		fatal("--results.format:", err)
+	}
+	if *resumeDir != "" {
+		if sameDir(*resumeDir, *testResultsRoot) {
+			fatal("--resume: directory must be different from --results-root")
+		}
+		env.Resume, err = libhive.LoadResumeState(*resumeDir)
+		if err != nil {
+			fatal("--resume:", err)
+		}
+	}
+	if *eventsAddr != "" {
+		env.Events = libhive.NewEventFeed()
+		if err := serveEvents(*eventsAddr, env.Events); err != nil {
+			fatal("--events.addr:", err)
+		}
 	}
 	runner := libhive.NewRunner(inv, builder, cb)
 
 	// Parse the client list.
 	// It can be supplied as a comma-separated list, or as a YAML file.
 	var clientList []libhive.ClientDesignator
-	if *clientsFile == "" {
+	if replay != nil {
+		clientList = replay.ClientList()
+	} else if *clientsFile == "" {
 		clientList, err = libhive.ParseClientList(&inv, *clients)
 		if err != nil {
 			fatal("-client:", err)
@@ -238,23 +344,48 @@ Otherwise, it looks for files in the $HOME directory:
 	}
 
 	// Build clients and simulators.
-	if err := runner.Build(ctx, clientList, simList, simBuildArgs); err != nil {
-		fatal(err)
+	buildOpts := libhive.BuildOptions{
+		Concurrency:      *buildConcurrency,
+		Strict:           *buildStrict,
+		SkipClientImages: *simListTests,
+	}
+	var buildErr error
+	if replay != nil {
+		buildErr = runner.Replay(ctx, replay)
+	} else {
+		buildErr = runner.Build(ctx, clientList, simList, simBuildArgs, buildOpts)
+	}
+	buildReport := runner.BuildReport()
+	if len(buildReport.Clients) > 0 {
+		if err := buildReport.WriteFile(*testResultsRoot); err != nil {
+			slog.Warn("can't write build report", "err", err)
+		}
+	}
+	if buildErr != nil {
+		buildReport.Print(os.Stderr)
+		fatal(buildErr)
 	}
 	if *simDevMode {
+		buildReport.Print(os.Stderr)
 		runner.RunDevMode(ctx, env, *simDevModeAPIEndpoint, hiveInfo)
+		waitKeptClients(runner)
 		return
 	}
 
 	// Run simulators.
+	results, err := runner.RunAll(ctx, simList, env, hiveInfo)
+	buildReport.Print(os.Stderr)
+	waitKeptClients(runner)
+	if err != nil {
+		fatal(err)
+	}
+	if *simListTests {
+		printTestCatalogs(results)
+		return
+	}
 	var failCount int
-	for _, sim := range simList {
-		result, err := runner.Run(ctx, sim, env, hiveInfo)
-		if err != nil {
-			fatal(err)
-		}
+	for _, result := range results {
 		failCount += result.TestsFailed
-		slog.Info(fmt.Sprintf("simulation %s finished", sim), "suites", result.Suites, "tests", result.Tests, "failed", result.TestsFailed)
 	}
 
 	switch failCount {
@@ -266,6 +397,85 @@ Otherwise, it looks for files in the $HOME directory:
 	}
 }
 
+// checkShard validates the --sim.shard flag value.
+func checkShard(s string) error {
+	if s == "" {
+		return nil
+	}
+	var i, n int
+	if _, err := fmt.Sscanf(s, "%d/%d", &i, &n); err != nil || i < 1 || i > n || fmt.Sprintf("%d/%d", i, n) != s {
+		return fmt.Errorf("invalid shard %q, want i/n with 1 <= i <= n", s)
+	}
+	return nil
+}
+
+// printTestCatalogs writes the test catalogs of all simulators to stdout.
+func printTestCatalogs(results []libhive.SimResult) {
+	catalogs := make([]*simapi.TestCatalog, len(results))
+	for i, result := range results {
+		catalogs[i] = result.Catalog
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(catalogs); err != nil {
+		fatal(err)
+	}
+}
+
+// connectKubernetes creates the Kubernetes container backend. Images are
+// built by the local Docker daemon.
+func connectKubernetes(dockerEndpoint string, dockerConfig *libdocker.Config, kubeconfig, kubecontext string, cfg *libk8s.Config) (libhive.Builder, libhive.ContainerBackend, error) {
+	dockerBuilder, _, err := libdocker.Connect(dockerEndpoint, dockerConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	cluster, err := libk8s.LoadCluster(kubeconfig, kubecontext)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.ContainerOutput = dockerConfig.ContainerOutput
+	cb, err := libk8s.Connect(context.Background(), cluster, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Registry == "" {
+		return dockerBuilder, cb, nil
+	}
+	return libk8s.NewBuilder(dockerBuilder, dockerBuilder, cfg.Registry), cb, nil
+}
+
+// pauseMu ensures only one failed test is paused at a time.
+var pauseMu sync.Mutex
+
+// pauseOnFailure prints the clients of a failed test and waits until enter is pressed.
+func pauseOnFailure(clients []*libhive.FailedClient) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+
+	fmt.Fprintf(os.Stderr, "test %q failed, its clients are still running:\n", clients[0].Test)
+	libhive.PrintFailedClients(os.Stderr, clients)
+	fmt.Fprintln(os.Stderr, "press enter to continue the simulation")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+}
+
+// waitKeptClients prints the clients kept by --sim.keep-failed and removes them
+// after an interrupt signal.
+func waitKeptClients(runner *libhive.Runner) {
+	clients := runner.KeptClients()
+	if len(clients) == 0 {
+		return
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+
+	fmt.Fprintf(os.Stderr, "keeping %d clients of failed tests:\n", len(clients))
+	libhive.PrintFailedClients(os.Stderr, clients)
+	fmt.Fprintln(os.Stderr, "press Ctrl-C to remove them (if hive is killed instead, use 'hive --cleanup')")
+	<-sig
+	runner.RemoveKeptClients()
+}
+
 func fatal(args ...interface{}) {
 	fmt.Fprintln(os.Stderr, args...)
 	os.Exit(1)
@@ -280,6 +490,29 @@ func parseClientsFile(inv *libhive.Inventory, file string) ([]libhive.ClientDesi
 	return libhive.ParseClientListYAML(inv, f)
 }
 
+// sameDir reports whether a and b refer to the same directory.
+func sameDir(a, b string) bool {
+	sa, errA := os.Stat(a)
+	sb, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return os.SameFile(sa, sb)
+}
+
+// serveEvents starts the HTTP server of the event stream.
+func serveEvents(addr string, feed *libhive.EventFeed) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/events", feed)
+	slog.Info("serving events", "url", "http://"+l.Addr().String()+"/events")
+	go http.Serve(l, mux)
+	return nil
+}
+
 func flagIsSet(name string) bool {
 	var found bool
 	flag.Visit(func(f *flag.Flag) {
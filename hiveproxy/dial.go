@@ -0,0 +1,117 @@
+package hiveproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+// dialTimeout is the time limit for connecting to a dial destination.
+const dialTimeout = 10 * time.Second
+
+// Dial instructs the proxy frontend to open a TCP connection to the given network
+// address. The returned connection is relayed through the frontend.
+//
+// This can only be called on the proxy side created by RunBackend.
+func (p *Proxy) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	if p.isFront {
+		return nil, errors.New("Dial called on proxy frontend")
+	}
+	stream, err := p.mux.Open()
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	// The frontend responds with an empty line when the connection is established,
+	// or with the error message.
+	if _, err := io.WriteString(stream, addr+"\n"); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	msg, err := readLine(stream)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+	if msg != "" {
+		stream.Close()
+		return nil, errors.New(msg)
+	}
+	stream.SetDeadline(time.Time{})
+	return stream, nil
+}
+
+// serveDial accepts dial requests of the backend.
+func serveDial(mux *yamux.Session) {
+	for {
+		stream, err := mux.Accept()
+		if err != nil {
+			return
+		}
+		go handleDial(stream)
+	}
+}
+
+func handleDial(stream net.Conn) {
+	defer stream.Close()
+
+	addr, err := readLine(stream)
+	if err != nil {
+		return
+	}
+	var conn net.Conn
+	if host, _, splitErr := net.SplitHostPort(addr); splitErr != nil {
+		err = splitErr
+	} else if net.ParseIP(host) == nil {
+		err = errors.New("invalid IP")
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	if err != nil {
+		log.Println("dial failed:", err)
+		io.WriteString(stream, strings.ReplaceAll(err.Error(), "\n", " ")+"\n")
+		return
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(stream, "\n"); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(conn, stream)
+		conn.(*net.TCPConn).CloseWrite()
+		close(done)
+	}()
+	io.Copy(stream, conn)
+	stream.Close()
+	<-done
+}
+
+// readLine reads a line from r. It reads one byte at a time to avoid consuming
+// data beyond the line.
+func readLine(r io.Reader) (string, error) {
+	var (
+		line []byte
+		b    = make([]byte, 1)
+	)
+	for len(line) < 1024 {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(line), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", errors.New("line too long")
+}
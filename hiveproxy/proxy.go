@@ -8,7 +8,8 @@
 //
 // The frontend also has auxiliary functions which can be triggered by the backend via
 // RPC. Specifically, it can run TCP endpoint probes, which are used by hive to confirm
-// that the client container has started.
+// that the client container has started. The backend can also open TCP connections to
+// containers through the frontend.
 package hiveproxy
 
 import (
@@ -42,6 +43,7 @@ func init() {
 type Proxy struct {
 	httpsrv    http.Server
 	rpc        *rpc.Client
+	mux        *yamux.Session
 	waitCh     <-chan struct{}
 	serverDown chan struct{}
 	closeOnce  sync.Once
@@ -130,6 +132,7 @@ func RunFrontend(r io.Reader, w io.WriteCloser, listener net.Listener) (*Proxy,
 		return nil, err
 	}
 	p := newProxy(true, mux.CloseChan())
+	p.mux = mux
 
 	// Launch RPC handler.
 	rpcConn, err := mux.Accept()
@@ -140,6 +143,9 @@ func RunFrontend(r io.Reader, w io.WriteCloser, listener net.Listener) (*Proxy,
 	p.launchRPC(rpcConn)
 	p.rpc.RegisterName("proxy", new(proxyFunctions))
 
+	// All further streams opened by the backend are dial requests.
+	go serveDial(mux)
+
 	// Launch reverse proxy server.
 	transport := &http.Transport{
 		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -169,6 +175,7 @@ func RunBackend(r io.Reader, w io.WriteCloser, h http.Handler) (*Proxy, error) {
 	}
 
 	p := newProxy(false, mux.CloseChan())
+	p.mux = mux
 
 	// Start RPC client.
 	rpcConn, err := mux.Open()
@@ -158,3 +158,39 @@ func (tl *testListener) acceptLoop() {
 		c.Close()
 	}
 }
+
+func TestProxyDial(t *testing.T) {
+	p := runProxyPair(t, nil)
+	defer p.close()
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	})}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	// Send a request through a connection dialed by the frontend.
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return p.back.Dial(ctx, addr)
+		},
+	}}
+	resp, err := client.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatal("request failed:", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Fatalf("wrong response body %q", body)
+	}
+
+	// Dialing a closed port fails.
+	if _, err := p.back.Dial(context.Background(), "127.0.0.1:1"); err == nil {
+		t.Fatal("Dial to closed port did not fail")
+	}
+}
@@ -0,0 +1,71 @@
+package hivesim
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractDir writes the content of a directory archive to dest. The archive contains
+// the directory itself as the top-level entry, which is stripped.
+func extractDir(archive io.Reader, dest string) error {
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Strip the directory name.
+		name := strings.TrimSuffix(hdr.Name, "/")
+		_, name, found := strings.Cut(name, "/")
+		if !found {
+			if hdr.Typeflag != tar.TypeDir {
+				return fmt.Errorf("%s is not a directory", hdr.Name)
+			}
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid file name %q in archive", hdr.Name)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			// Links and special files are skipped.
+		}
+	}
+}
+
+func writeFile(file string, content io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fd, content)
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,6 +1,12 @@
 package hivesim
 
-import "slices"
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/hive/internal/simapi"
+)
 
 // SuiteID identifies a test suite context.
 type SuiteID uint32
@@ -11,6 +17,8 @@ type TestID uint32
 // TestResult describes the outcome of a test.
 type TestResult struct {
 	Pass    bool   `json:"pass"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Timeout bool   `json:"timeout,omitempty"`
 	Details string `json:"details"`
 }
 
@@ -21,6 +29,20 @@ type TestStartInfo struct {
 	Location    string `json:"location"`
 	Category    string `json:"category"`
 	Description string `json:"description"`
+
+	// Timeout is the time limit of the test in milliseconds. If zero, the default
+	// limit of the run applies. If negative, hive does not end the test.
+	Timeout int64 `json:"timeout,omitempty"`
+
+	// Parent is the test which runs this test as a subtest.
+	Parent TestID `json:"parent,omitempty"`
+
+	// Role is the client role required by the test. It is listed in test catalogs.
+	Role string `json:"role,omitempty"`
+
+	// Capabilities are the client capabilities required by the test. They are listed
+	// in test catalogs.
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 // ExecInfo is the result of running a command in a client container.
@@ -32,17 +54,124 @@ type ExecInfo struct {
 
 // ClientMetadata is part of the ClientDefinition and lists metadata
 type ClientMetadata struct {
-	Roles []string `yaml:"roles" json:"roles"`
+	Roles        []string           `yaml:"roles" json:"roles"`
+	Capabilities ClientCapabilities `yaml:"capabilities" json:"capabilities"`
+}
+
+// ClientCapabilities lists the features supported by a client, as declared in its
+// hive.yaml file. API namespaces and protocols are given as "name" or "name/version",
+// e.g. "engine/v3" or "snap/1".
+type ClientCapabilities struct {
+	Forks     []string `yaml:"forks" json:"forks,omitempty"`
+	APIs      []string `yaml:"apis" json:"apis,omitempty"`
+	Protocols []string `yaml:"protocols" json:"protocols,omitempty"`
 }
 
 // ClientDefinition is served by the /clients API endpoint to list the available clients
 type ClientDefinition struct {
-	Name    string         `json:"name"`
-	Version string         `json:"version"`
-	Meta    ClientMetadata `json:"meta"`
+	Name      string         `json:"name"`
+	Version   string         `json:"version"`
+	Meta      ClientMetadata `json:"meta"`
+	Resources *Resources     `json:"resources,omitempty"` // default resource limits
 }
 
 // HasRole reports whether the client has the given role.
 func (m *ClientDefinition) HasRole(role string) bool {
 	return slices.Contains(m.Meta.Roles, role)
 }
+
+// SupportsFork reports whether the client supports the given fork.
+// Fork names are compared case-insensitively.
+func (m *ClientDefinition) SupportsFork(fork string) bool {
+	return slices.ContainsFunc(m.Meta.Capabilities.Forks, func(f string) bool {
+		return strings.EqualFold(f, fork)
+	})
+}
+
+// SupportsAPI reports whether the client serves the given API namespace. If api has
+// no version, e.g. "engine", any version of the namespace matches.
+func (m *ClientDefinition) SupportsAPI(api string) bool {
+	return slices.ContainsFunc(m.Meta.Capabilities.APIs, func(a string) bool {
+		return capabilityMatch(a, api)
+	})
+}
+
+// SupportsProtocol reports whether the client implements the given protocol. If proto
+// has no version, e.g. "snap", any version of the protocol matches.
+func (m *ClientDefinition) SupportsProtocol(proto string) bool {
+	return slices.ContainsFunc(m.Meta.Capabilities.Protocols, func(p string) bool {
+		return capabilityMatch(p, proto)
+	})
+}
+
+// HasCapability reports whether the client has the given capability. Capabilities are
+// written as "fork:<name>", "api:<namespace>" or "protocol:<name>", for example
+// "fork:Cancun", "api:engine/v3" or "protocol:snap".
+func (m *ClientDefinition) HasCapability(capability string) bool {
+	kind, name, _ := strings.Cut(capability, ":")
+	switch kind {
+	case "fork":
+		return m.SupportsFork(name)
+	case "api":
+		return m.SupportsAPI(name)
+	case "protocol":
+		return m.SupportsProtocol(name)
+	default:
+		return false
+	}
+}
+
+// HasCapabilities reports whether the client has all of the given capabilities.
+func (m *ClientDefinition) HasCapabilities(capabilities []string) bool {
+	for _, c := range capabilities {
+		if !m.HasCapability(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// capabilityMatch reports whether a declared "name/version" capability matches
+// the wanted one. A wanted capability without version matches all versions.
+func capabilityMatch(declared, want string) bool {
+	if declared == want {
+		return true
+	}
+	name, _, _ := strings.Cut(declared, "/")
+	return !strings.Contains(want, "/") && name == want
+}
+
+// checkCapability verifies the syntax of a capability in ClientTestSpec.
+func checkCapability(capability string) error {
+	kind, name, found := strings.Cut(capability, ":")
+	switch {
+	case !found || name == "":
+		return fmt.Errorf("invalid client capability %q, want <kind>:<name>", capability)
+	case kind != "fork" && kind != "api" && kind != "protocol":
+		return fmt.Errorf("unknown kind %q in client capability %q", kind, capability)
+	}
+	return nil
+}
+
+// NetworkConditions configures faults of the network traffic sent by a client.
+type NetworkConditions = simapi.NetworkConditions
+
+// PeerConditions configures faults of the traffic sent to another node.
+type PeerConditions = simapi.PeerConditions
+
+// LinkConditions are the properties of a network link: latency, jitter,
+// packet loss and bandwidth.
+type LinkConditions = simapi.LinkConditions
+
+// Measurement is a numeric value recorded by a test.
+type Measurement = simapi.Measurement
+
+// ClientStatus is the state of a client container.
+type ClientStatus = simapi.NodeResponse
+
+// Client states, see ClientStatus.
+const (
+	ClientRunning = simapi.NodeRunning // the client is running
+	ClientExited  = simapi.NodeExited  // the client has crashed
+	ClientStopped = simapi.NodeStopped // the client was stopped by hive
+)
@@ -85,6 +85,20 @@ of the client, and `RPC()`, which returns an RPC client connected to the client'
 `T` can also run a test against a client using any of the `Run__()` methods. It can also pipe logs and test
 failures through to the simulation log file, among other methods.
 
+When a test sets `RecordRPC` in its spec, or hive is run with `--sim.record-rpc`, the clients returned by
+`RPC()` and `EngineAPI()` send their requests through a proxy in hive, which records them in a transcript of the
+test. For other protocols, `Client.URL()` returns the address of a client port behind the proxy.
+
+A test can record numeric measurements, such as the time a client took to sync, using `t.Measure()`. The values
+are stored in the test result, so they can be compared across runs to find performance regressions.
+
+Tests started by the `Run__()` methods are reported as subtests of the calling test. When a subtest fails, its
+parent test fails as well.
+
+A test can call `t.Parallel()` to run in parallel with the other parallel tests of its suite or parent test. As
+with the testing package, parallel tests start when the sequential tests of the suite, or the parent test
+function, have finished. At most `HIVE_PARALLELISM` parallel tests run at the same time.
+
 The `Sim` field (which is a pointer to an instance of `Simulation`) in the `T` object is especially useful as it
 provides several methods for communicating with the hive simulation API, such as:
 
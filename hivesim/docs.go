@@ -230,11 +230,12 @@ func (s *markdownSuite) toMarkdownFile(fw FileWriter, simName string) error {
 
 // Docs collector object:
 // - Collects the test cases and test suites.
-// - Generates markdown files.
+// - Generates markdown files, or sends the test catalog to hive.
 type docsCollector struct {
-	simName   string
-	outputDir string
-	suites    map[SuiteID]*markdownSuite
+	simName    string
+	outputDir  string
+	catalogURL string // hive API URL, set in catalog mode
+	suites     map[SuiteID]*markdownSuite
 }
 
 // Returns the simulator name from the path of the currently running binary.
@@ -330,11 +331,20 @@ func (docs *docsCollector) EndSuite(testSuite SuiteID) error {
 		return fmt.Errorf("test suite %d does not exist", testSuite)
 	}
 	suite.running = false
-	if !docs.AnyRunning() {
-		// Generate markdown files when all suites are done.
-		if err := docs.genSimulatorMarkdownFiles(NewFileWriter(docs.outputDir)); err != nil {
-			slog.Error("can't generate markdown files", "err", err)
+	if docs.AnyRunning() {
+		return nil
+	}
+	if docs.catalogURL != "" {
+		// Send the catalog when all suites are done. If the simulator runs
+		// another suite afterwards, it is sent again.
+		if err := post(docs.catalogURL+"/catalog", docs.catalog(), nil); err != nil {
+			slog.Error("can't send test catalog", "err", err)
 		}
+		return nil
+	}
+	// Generate markdown files when all suites are done.
+	if err := docs.genSimulatorMarkdownFiles(NewFileWriter(docs.outputDir)); err != nil {
+		slog.Error("can't generate markdown files", "err", err)
 	}
 	return nil
 }
@@ -348,8 +358,8 @@ func (docs *docsCollector) StartTest(testSuite SuiteID, test TestStartInfo) (Tes
 	if _, ok := docs.suites[testSuite]; !ok {
 		return 0, fmt.Errorf("test suite %d does not exist", testSuite)
 	}
-	// Next test id
-	testID := TestID(len(docs.suites[testSuite].tests))
+	// Next test id. IDs start at one because zero means 'no parent'.
+	testID := TestID(len(docs.suites[testSuite].tests) + 1)
 	// Add the test to the map.
 	docs.suites[testSuite].tests[testID] = &markdownTest
 	// Return the test ID.
@@ -369,6 +379,38 @@ func (docs *docsCollector) EndTest(testSuite SuiteID, test TestID, testResult Te
 	return nil
 }
 
+// catalog returns the collected suites and tests.
+func (docs *docsCollector) catalog() *simapi.TestCatalog {
+	catalog := &simapi.TestCatalog{Simulator: docs.simName, Suites: []simapi.CatalogSuite{}}
+	for _, sID := range docs.suiteIDs() {
+		s := docs.suites[sID]
+		suite := simapi.CatalogSuite{
+			Name:        s.Name,
+			DisplayName: s.DisplayName,
+			Category:    s.Category,
+			Description: s.Description,
+			Tests:       []simapi.CatalogTest{},
+		}
+		for _, tID := range s.testIDs() {
+			tc := s.tests[tID]
+			test := simapi.CatalogTest{
+				Name:         tc.Name,
+				DisplayName:  tc.DisplayName,
+				Category:     tc.Category,
+				Description:  tc.Description,
+				Role:         tc.Role,
+				Capabilities: tc.Capabilities,
+			}
+			if parent, ok := s.tests[tc.Parent]; ok {
+				test.Parent = parent.Name
+			}
+			suite.Tests = append(suite.Tests, test)
+		}
+		catalog.Suites = append(catalog.Suites, suite)
+	}
+	return catalog
+}
+
 // Return a generic "Client" client type.
 func (docs *docsCollector) ClientTypes() ([]*ClientDefinition, error) {
 	return []*ClientDefinition{
@@ -3,18 +3,23 @@ package hivesim
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"mime/multipart"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/hive/internal/simapi"
@@ -22,30 +27,44 @@ import (
 
 // Simulation wraps the simulation HTTP API provided by hive.
 type Simulation struct {
-	url  string
-	m    testMatcher
-	docs *docsCollector
-	ll   int
+	url     string
+	m       testMatcher
+	shard   testShard
+	docs    *docsCollector
+	ll      int
+	retries int
+
+	testTimeout time.Duration
+	recordRPC   bool
+	parallelism int
+	slotsOnce   sync.Once
+	slots       chan struct{} // limits the number of running parallel tests
+
+	completedOnce sync.Once
+	completed     map[string]map[string]bool
 }
 
 // New looks up the hive host URI using the HIVE_SIMULATOR environment variable
 // and connects to it. It will panic if HIVE_SIMULATOR is not set.
 // If HIVE_DOCS_MODE is set to "true", it will inhibit most of the functionality
-// in order to simplify execution for documentation generation.
+// in order to simplify execution for documentation generation. If it is set to
+// "catalog", tests are collected in the same way and sent to hive as a test catalog.
 func New() *Simulation {
 	var (
 		docs *docsCollector
 		url  string
 	)
-	if cc := os.Getenv("HIVE_DOCS_MODE"); cc == "true" {
+	switch os.Getenv("HIVE_DOCS_MODE") {
+	case "true":
 		docs = NewDocsCollector()
-	} else {
-		var isSet bool
-		if url, isSet = os.LookupEnv("HIVE_SIMULATOR"); !isSet {
-			panic("HIVE_SIMULATOR environment variable not set")
-		} else if url == "" {
-			panic("HIVE_SIMULATOR environment variable is empty")
-		}
+	case "catalog":
+		// In catalog mode, the simulator is launched by 'hive --list-tests'. The
+		// collected tests are sent to hive, which also provides the client list.
+		url = simulatorURL()
+		docs = NewDocsCollector()
+		docs.catalogURL = url
+	default:
+		url = simulatorURL()
 	}
 	sim := &Simulation{url: url, docs: docs}
 	if p := os.Getenv("HIVE_TEST_PATTERN"); p != "" {
@@ -55,9 +74,28 @@ func New() *Simulation {
 		}
 		sim.m = m
 	}
+	if s := os.Getenv("HIVE_SHARD"); s != "" {
+		shard, err := parseTestShard(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: ignoring invalid test shard: "+err.Error())
+		}
+		sim.shard = shard
+	}
 	if ll := os.Getenv("HIVE_LOGLEVEL"); ll != "" {
 		sim.ll, _ = strconv.Atoi(ll)
 	}
+	if r := os.Getenv("HIVE_RETRIES"); r != "" {
+		sim.retries, _ = strconv.Atoi(r)
+	}
+	if p := os.Getenv("HIVE_PARALLELISM"); p != "" {
+		sim.parallelism, _ = strconv.Atoi(p)
+	}
+	if t := os.Getenv("HIVE_TEST_TIMEOUT"); t != "" {
+		sim.testTimeout, _ = time.ParseDuration(t)
+	}
+	if r := os.Getenv("HIVE_RECORD_RPC"); r != "" {
+		sim.recordRPC, _ = strconv.ParseBool(r)
+	}
 	return sim
 }
 
@@ -78,6 +116,64 @@ func (sim *Simulation) SetTestPattern(p string) {
 	sim.m = m
 }
 
+// SetShard restricts the simulation to one shard of its tests, given as "i/n". This
+// method is provided for use in unit tests. For simulator runs launched by hive, the
+// shard is set automatically in New().
+func (sim *Simulation) SetShard(s string) {
+	shard, err := parseTestShard(s)
+	if err != nil {
+		panic(err)
+	}
+	sim.shard = shard
+}
+
+// SetRetries sets how often failed tests are run again. This method is provided for
+// use in unit tests. For simulator runs launched by hive, the number of retries is set
+// automatically in New().
+func (sim *Simulation) SetRetries(n int) {
+	sim.retries = n
+}
+
+// SetParallelism sets the max number of parallel tests running at the same time. This
+// method is provided for use in unit tests. For simulator runs launched by hive, the
+// parallelism is set automatically in New().
+func (sim *Simulation) SetParallelism(n int) {
+	sim.parallelism = n
+}
+
+// simulatorURL returns the API URL from the HIVE_SIMULATOR environment variable.
+func simulatorURL() string {
+	url, isSet := os.LookupEnv("HIVE_SIMULATOR")
+	if !isSet {
+		panic("HIVE_SIMULATOR environment variable not set")
+	} else if url == "" {
+		panic("HIVE_SIMULATOR environment variable is empty")
+	}
+	return url
+}
+
+// SetTestTimeout sets the default time limit of tests. This method is provided for use
+// in unit tests. For simulator runs launched by hive, the timeout is set automatically
+// in New().
+func (sim *Simulation) SetTestTimeout(d time.Duration) {
+	sim.testTimeout = d
+}
+
+// SetRecordRPC enables recording of client RPC requests for all tests. This method is
+// provided for use in unit tests. For simulator runs launched by hive, recording is
+// configured automatically in New().
+func (sim *Simulation) SetRecordRPC(enabled bool) {
+	sim.recordRPC = enabled
+}
+
+// parallelSlots returns the channel which limits the number of running parallel tests.
+func (sim *Simulation) parallelSlots() chan struct{} {
+	sim.slotsOnce.Do(func() {
+		sim.slots = make(chan struct{}, max(sim.parallelism, 1))
+	})
+	return sim.slots
+}
+
 // TestPattern returns the regular expressions used to enable/skip suite and test names.
 func (sim *Simulation) TestPattern() (suiteExpr string, testNameExpr string) {
 	se := ""
@@ -96,6 +192,38 @@ func (sim *Simulation) CollectTestsOnly() bool {
 	return sim.docs != nil
 }
 
+// CompletedTests returns the names of tests which passed in a previous run, by suite
+// name. When hive resumes a run, these tests are skipped.
+func (sim *Simulation) CompletedTests() (map[string][]string, error) {
+	if sim.docs != nil {
+		return nil, nil
+	}
+	var resp struct {
+		CompletedTests map[string][]string `json:"completedTests"`
+	}
+	err := get(sim.url+"/hive", &resp)
+	return resp.CompletedTests, err
+}
+
+// isCompleted reports whether a test passed in the resumed run.
+func (sim *Simulation) isCompleted(suite, test string) bool {
+	sim.completedOnce.Do(func() {
+		completed, err := sim.CompletedTests()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: can't get completed tests:", err)
+			return
+		}
+		sim.completed = make(map[string]map[string]bool, len(completed))
+		for suite, tests := range completed {
+			sim.completed[suite] = make(map[string]bool, len(tests))
+			for _, name := range tests {
+				sim.completed[suite][name] = true
+			}
+		}
+	})
+	return sim.completed[suite][test]
+}
+
 // EndTest finishes the test case, cleaning up everything, logging results, and returning
 // an error if the process could not be completed.
 func (sim *Simulation) EndTest(testSuite SuiteID, test TestID, testResult TestResult) error {
@@ -106,6 +234,29 @@ func (sim *Simulation) EndTest(testSuite SuiteID, test TestID, testResult TestRe
 	return post(url, &testResult, nil)
 }
 
+// RetryTest ends a failed attempt of a test case. The clients started by the attempt
+// are stopped, and the test can be run again using the same test ID.
+func (sim *Simulation) RetryTest(testSuite SuiteID, test TestID, testResult TestResult) error {
+	if sim.docs != nil {
+		return nil
+	}
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/retry", sim.url, testSuite, test)
+	return post(url, &testResult, nil)
+}
+
+// RecordMeasurement adds a measurement to a running test. Measurements are stored in
+// the test result, and can be compared across runs.
+func (sim *Simulation) RecordMeasurement(testSuite SuiteID, test TestID, m Measurement) error {
+	if sim.docs != nil {
+		return nil
+	}
+	if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+		return fmt.Errorf("invalid value %v", m.Value)
+	}
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/measurement", sim.url, testSuite, test)
+	return post(url, &m, nil)
+}
+
 // StartSuite signals the start of a test suite.
 func (sim *Simulation) StartSuite(suite *simapi.TestRequest, simlog string) (SuiteID, error) {
 	if sim.docs != nil {
@@ -146,7 +297,7 @@ func (sim *Simulation) StartTest(testSuite SuiteID, test TestStartInfo) (TestID,
 // ClientTypes returns all client types available to this simulator run. This depends on
 // both the available client set and the command line filters.
 func (sim *Simulation) ClientTypes() ([]*ClientDefinition, error) {
-	if sim.docs != nil {
+	if sim.docs != nil && sim.url == "" {
 		return sim.docs.ClientTypes()
 	}
 	var (
@@ -261,6 +412,160 @@ func (sim *Simulation) UnpauseClient(testSuite SuiteID, test TestID, nodeid stri
 	return err
 }
 
+// SnapshotClient saves the state of a running client. The returned snapshot ID can be
+// used with WithSnapshot to start new clients from the saved state. Snapshots are
+// removed when the test suite ends.
+func (sim *Simulation) SnapshotClient(testSuite SuiteID, test TestID, nodeid string) (string, error) {
+	if sim.docs != nil {
+		return "", errors.New("SnapshotClient is not supported in docs mode")
+	}
+	var (
+		url  = fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/snapshot", sim.url, testSuite, test, nodeid)
+		resp simapi.SnapshotResponse
+	)
+	err := post(url, nil, &resp)
+	return resp.ID, err
+}
+
+// ClientStatus returns the state of a client.
+func (sim *Simulation) ClientStatus(testSuite SuiteID, test TestID, nodeid string) (*ClientStatus, error) {
+	if sim.docs != nil {
+		return nil, errors.New("ClientStatus is not supported in docs mode")
+	}
+	var (
+		url  = fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s", sim.url, testSuite, test, nodeid)
+		resp ClientStatus
+	)
+	err := get(url, &resp)
+	return &resp, err
+}
+
+// WaitClientExit waits until a client has stopped, either because it crashed or because
+// it was stopped by hive. The returned status tells which one happened.
+func (sim *Simulation) WaitClientExit(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) (*ClientStatus, error) {
+	if sim.docs != nil {
+		return nil, errors.New("WaitClientExit is not supported in docs mode")
+	}
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/exit", sim.url, testSuite, test, nodeid)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp ClientStatus
+	err = request(httpReq, &resp)
+	return &resp, err
+}
+
+// ClientLog returns the log output of a client, starting at the given byte offset.
+// It also returns the offset at which the returned output ends, which can be used to
+// fetch only new output in the next call.
+func (sim *Simulation) ClientLog(testSuite SuiteID, test TestID, nodeid string, offset int64) ([]byte, int64, error) {
+	if sim.docs != nil {
+		return nil, 0, errors.New("ClientLog is not supported in docs mode")
+	}
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/log?offset=%d", sim.url, testSuite, test, nodeid, offset)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if err := responseError(resp); err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, offset + int64(len(data)), nil
+}
+
+// FollowClientLog streams the log output of a client, starting at the given byte offset.
+// The stream ends when the client stops or ctx is canceled. The caller must close the
+// returned reader.
+func (sim *Simulation) FollowClientLog(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, offset int64) (io.ReadCloser, error) {
+	if sim.docs != nil {
+		return nil, errors.New("FollowClientLog is not supported in docs mode")
+	}
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/log?offset=%d&follow=true", sim.url, testSuite, test, nodeid, offset)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if err := responseError(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ClientFile returns the content of a file in a client container.
+func (sim *Simulation) ClientFile(testSuite SuiteID, test TestID, nodeid string, path string) ([]byte, error) {
+	if sim.docs != nil {
+		return nil, errors.New("ClientFile is not supported in docs mode")
+	}
+	body, err := sim.getStream(fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/file?path=%s", sim.url, testSuite, test, nodeid, url.QueryEscape(path)))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// ClientArchive returns a tar archive of a file or directory in a client container.
+// The caller must close the returned reader.
+func (sim *Simulation) ClientArchive(testSuite SuiteID, test TestID, nodeid string, path string) (io.ReadCloser, error) {
+	if sim.docs != nil {
+		return nil, errors.New("ClientArchive is not supported in docs mode")
+	}
+	return sim.getStream(fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/archive?path=%s", sim.url, testSuite, test, nodeid, url.QueryEscape(path)))
+}
+
+// AttachClientFiles stores a file or directory of a client container in the hive
+// results, as an artifact of the test.
+func (sim *Simulation) AttachClientFiles(testSuite SuiteID, test TestID, nodeid string, path string) error {
+	if sim.docs != nil {
+		return errors.New("AttachClientFiles is not supported in docs mode")
+	}
+	return post(fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/artifact?path=%s", sim.url, testSuite, test, nodeid, url.QueryEscape(path)), nil, nil)
+}
+
+// AttachTestFile stores data as an artifact of a running test. The name identifies
+// the artifact in the test result.
+func (sim *Simulation) AttachTestFile(testSuite SuiteID, test TestID, name string, data io.Reader) error {
+	if sim.docs != nil {
+		return nil
+	}
+	reqURL := fmt.Sprintf("%s/testsuite/%d/test/%d/artifact?name=%s", sim.url, testSuite, test, url.QueryEscape(name))
+	httpReq, err := http.NewRequest("POST", reqURL, data)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("content-type", "application/octet-stream")
+	return request(httpReq, nil)
+}
+
+// clientProxyURL returns the URL of the recording proxy for a port of a client.
+func (sim *Simulation) clientProxyURL(testSuite SuiteID, test TestID, nodeid string, port int) string {
+	return fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/proxy/%d", sim.url, testSuite, test, nodeid, port)
+}
+
+// getStream performs a GET request and returns the response body.
+func (sim *Simulation) getStream(reqURL string) (io.ReadCloser, error) {
+	resp, err := http.Get(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := responseError(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
 // ClientEnodeURL returns the enode URL of a running client.
 func (sim *Simulation) ClientEnodeURL(testSuite SuiteID, test TestID, node string) (string, error) {
 	if sim.docs != nil {
@@ -363,6 +668,27 @@ func (sim *Simulation) DisconnectContainer(testSuite SuiteID, network, container
 	return requestDelete(url)
 }
 
+// SetNetworkConditions sends a request to the hive server to apply network conditions
+// to the traffic sent by the given container. The conditions replace any conditions
+// set previously. This is not supported on Kubernetes.
+func (sim *Simulation) SetNetworkConditions(testSuite SuiteID, containerID string, cond NetworkConditions) error {
+	if sim.docs != nil {
+		return errors.New("SetNetworkConditions is not supported in docs mode")
+	}
+	url := fmt.Sprintf("%s/testsuite/%d/network/conditions/%s", sim.url, testSuite, containerID)
+	return post(url, &cond, nil)
+}
+
+// ClearNetworkConditions sends a request to the hive server to remove the network
+// conditions of the given container.
+func (sim *Simulation) ClearNetworkConditions(testSuite SuiteID, containerID string) error {
+	if sim.docs != nil {
+		return errors.New("ClearNetworkConditions is not supported in docs mode")
+	}
+	url := fmt.Sprintf("%s/testsuite/%d/network/conditions/%s", sim.url, testSuite, containerID)
+	return requestDelete(url)
+}
+
 // ContainerNetworkIP returns the IP address of a container on the given network. If the
 // container ID is "simulation", it returns the IP address of the simulator container.
 func (sim *Simulation) ContainerNetworkIP(testSuite SuiteID, network, containerID string) (string, error) {
@@ -483,15 +809,27 @@ func request(httpReq *http.Request, result interface{}) error {
 		return err
 	}
 	defer resp.Body.Close()
-	dec := json.NewDecoder(resp.Body)
+	if err := responseError(resp); err != nil {
+		return err
+	}
+	// Request was successful.
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("invalid response (status %d): %v", resp.StatusCode, err)
+		}
+	}
+	return nil
+}
 
+// responseError returns the error of an unsuccessful API response.
+func responseError(resp *http.Response) error {
 	switch {
 	case resp.StatusCode >= 400:
 		// It's an error response.
 		switch resp.Header.Get("content-type") {
 		case "application/json":
 			var errobj simapi.Error
-			if err := dec.Decode(&errobj); err != nil {
+			if err := json.NewDecoder(resp.Body).Decode(&errobj); err != nil {
 				return fmt.Errorf("request failed (status %d) and can't decode error message: %v", resp.StatusCode, err)
 			}
 			return errors.New(errobj.Error)
@@ -503,12 +841,6 @@ func request(httpReq *http.Request, result interface{}) error {
 			return fmt.Errorf("request failed (status %d): %s", resp.StatusCode, respBody)
 		}
 	case resp.StatusCode >= 200 && resp.StatusCode < 300:
-		// Request was successful.
-		if result != nil {
-			if err := dec.Decode(result); err != nil {
-				return fmt.Errorf("invalid response (status %d): %v", resp.StatusCode, err)
-			}
-		}
 		return nil
 	default:
 		// 1xx and 3xx should never happen.
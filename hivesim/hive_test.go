@@ -1,16 +1,28 @@
 package hivesim
 
 import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http/httptest"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/hive/internal/fakes"
 	"github.com/ethereum/hive/internal/libhive"
 	"github.com/ethereum/hive/internal/simapi"
@@ -31,12 +43,20 @@ func TestClientTypes(t *testing.T) {
 		{
 			Name:    "client-1",
 			Version: "client-1-version",
-			Meta:    ClientMetadata{Roles: []string{"eth1"}},
+			Meta: ClientMetadata{
+				Roles: []string{"eth1"},
+				Capabilities: ClientCapabilities{
+					Forks:     []string{"Cancun", "Prague"},
+					APIs:      []string{"eth", "engine/v3"},
+					Protocols: []string{"eth/68", "snap/1"},
+				},
+			},
 		},
 		{
-			Name:    "client-2",
-			Version: "client-2-version",
-			Meta:    ClientMetadata{Roles: []string{"beacon"}},
+			Name:      "client-2",
+			Version:   "client-2-version",
+			Meta:      ClientMetadata{Roles: []string{"beacon"}},
+			Resources: &Resources{Memory: 1 << 30, Pids: 100},
 		},
 	}
 	if !reflect.DeepEqual(ctypes, wantClients) {
@@ -44,6 +64,43 @@ func TestClientTypes(t *testing.T) {
 	}
 }
 
+func TestHasCapability(t *testing.T) {
+	def := &ClientDefinition{
+		Meta: ClientMetadata{
+			Capabilities: ClientCapabilities{
+				Forks:     []string{"Cancun"},
+				APIs:      []string{"eth", "engine/v3"},
+				Protocols: []string{"snap/1", "discv5"},
+			},
+		},
+	}
+	tests := []struct {
+		capability string
+		want       bool
+	}{
+		{"fork:Cancun", true},
+		{"fork:cancun", true},
+		{"fork:Prague", false},
+		{"api:eth", true},
+		{"api:engine", true},
+		{"api:engine/v3", true},
+		{"api:engine/v4", false},
+		{"api:graphql", false},
+		{"protocol:snap", true},
+		{"protocol:snap/1", true},
+		{"protocol:snap/2", false},
+		{"protocol:discv5", true},
+		{"protocol:discv5/1", false},
+		{"Cancun", false},
+		{"role:eth1", false},
+	}
+	for _, test := range tests {
+		if got := def.HasCapability(test.capability); got != test.want {
+			t.Errorf("HasCapability(%q) = %v, want %v", test.capability, got, test.want)
+		}
+	}
+}
+
 // This checks that the simulator replaces the IP in enode.sh output with the container IP.
 func TestEnodeReplaceIP(t *testing.T) {
 	// Set up the backend to return enode:// URL containing the
@@ -173,6 +230,19 @@ func TestStartClientStartOptions(t *testing.T) {
 		}
 	})
 
+	t.Run("resources_options", func(t *testing.T) {
+		// Request limits override the client defaults.
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-2",
+			WithResources(Resources{CPUs: 2, Memory: 1 << 20}))
+		if err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		want := simapi.Resources{CPUs: 2, Memory: 1 << 20, Pids: 100}
+		if lastOptions.Resources != want {
+			t.Fatalf("wrong resources: %+v", lastOptions.Resources)
+		}
+	})
+
 	t.Run("files_options", func(t *testing.T) {
 		file1, err := os.CreateTemp("", "hivesim_test")
 		if err != nil {
@@ -243,6 +313,509 @@ func TestStartClientStartOptions(t *testing.T) {
 	})
 }
 
+// This test checks that the resource usage of clients is stored in the test results.
+func TestClientResourceUsage(t *testing.T) {
+	usage := libhive.ResourceUsage{PeakMemory: 1000, CPUTime: 2000, NetworkRx: 3, NetworkTx: 4}
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			return &libhive.ContainerInfo{
+				ID:    containerID,
+				Wait:  func() {},
+				Usage: func() libhive.ResourceUsage { return usage },
+			}, nil
+		},
+	})
+	defer srv.Close()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{Name: "test", Run: func(t *T) {
+		t.StartClient("client-1")
+	}})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	test := tm.Results()[0].TestCases[1]
+	if len(test.ClientInfo) != 1 {
+		t.Fatalf("wrong number of clients: %d", len(test.ClientInfo))
+	}
+	for _, client := range test.ClientInfo {
+		if client.Resources == nil || *client.Resources != usage {
+			t.Fatalf("wrong resource usage: %+v", client.Resources)
+		}
+	}
+}
+
+// This test checks that network conditions are applied through the backend.
+func TestClientPartition(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		scripts = make(map[string][]string)
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		NetworkNameToID: func(name string) (string, error) {
+			return name, nil
+		},
+		ContainerIP: func(containerID, networkID string) (net.IP, error) {
+			if networkID == "bridge" && containerID == "00000002" {
+				return net.IPv4(192, 0, 2, 2), nil
+			}
+			return nil, errors.New("not connected")
+		},
+		RunNetworkScript: func(containerID, script string) (*libhive.ExecInfo, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			scripts[containerID] = append(scripts[containerID], script)
+			return &libhive.ExecInfo{}, nil
+		},
+	})
+	defer srv.Close()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{Name: "test", Run: func(t *T) {
+		c1 := t.StartClient("client-1")
+		c2 := t.StartClient("client-1")
+		if err := c1.Partition(c2); err != nil {
+			t.Fatal("partition failed:", err)
+		}
+		// Containers which aren't clients of the suite can't be changed.
+		err := t.Sim.SetNetworkConditions(t.SuiteID, "foreign", NetworkConditions{})
+		if err == nil || !strings.Contains(err.Error(), "no such node") {
+			t.Fatal("wrong error for unknown container:", err)
+		}
+		if err := t.Sim.ClearNetworkConditions(t.SuiteID, "foreign"); err == nil {
+			t.Fatal("no error clearing conditions of unknown container")
+		}
+	}})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	if !tm.Results()[0].TestCases[1].SummaryResult.Pass {
+		t.Fatal("test failed:", tm.Results()[0].TestCases[1].SummaryResult.Details)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(scripts["foreign"]) > 0 {
+		t.Fatal("script was run in unknown container")
+	}
+	// The first script applies the partition, the second one is the cleanup at the end
+	// of the suite.
+	s := scripts["00000001"]
+	if len(s) != 2 {
+		t.Fatalf("wrong number of scripts run: %d", len(s))
+	}
+	if !strings.Contains(s[0], "loss 100%") || !strings.Contains(s[0], "match ip dst 192.0.2.2/32") {
+		t.Fatalf("wrong partition script:\n%s", s[0])
+	}
+	if strings.Contains(s[1], "tc qdisc add") {
+		t.Fatalf("cleanup script adds qdisc:\n%s", s[1])
+	}
+}
+
+// This test checks that clients can be started from a snapshot.
+func TestClientSnapshot(t *testing.T) {
+	var (
+		mu             sync.Mutex
+		images         []string
+		deleted        []string
+		snapshotLabels map[string]string
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateContainer: func(image string, opt libhive.ContainerOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			images = append(images, image)
+			return fmt.Sprintf("%08x", len(images)), nil
+		},
+		SnapshotContainer: func(containerID, name string, labels map[string]string) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			snapshotLabels = labels
+			return "snapshot-of-" + containerID, nil
+		},
+		DeleteSnapshot: func(image string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, image)
+			return nil
+		},
+	})
+	defer srv.Close()
+
+	var snapshot string
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{Name: "setup", Run: func(t *T) {
+		c := t.StartClient("client-1")
+		id, err := c.Snapshot()
+		if err != nil {
+			t.Fatal("snapshot failed:", err)
+		}
+		snapshot = id
+	}})
+	suite.Add(TestSpec{Name: "restore", Run: func(t *T) {
+		t.StartClient("client-1", WithSnapshot(snapshot))
+		_, _, err := t.Sim.StartClientWithOptions(t.SuiteID, t.TestID, "client-2", WithSnapshot(snapshot))
+		if err == nil {
+			t.Error("no error for snapshot of wrong client type")
+		}
+		_, _, err = t.Sim.StartClientWithOptions(t.SuiteID, t.TestID, "client-1", WithSnapshot("unknown"))
+		if err == nil {
+			t.Error("no error for unknown snapshot")
+		}
+	}})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	for _, test := range tm.Results()[0].TestCases {
+		if !test.SummaryResult.Pass {
+			t.Fatalf("test %q failed: %s", test.Name, test.SummaryResult.Details)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	wantImages := []string{"/ignored/in/api", "snapshot-of-00000001"}
+	if !reflect.DeepEqual(images, wantImages) {
+		t.Fatalf("wrong images used: %q", images)
+	}
+	if !reflect.DeepEqual(deleted, wantImages[1:]) {
+		t.Fatalf("wrong snapshots deleted: %q", deleted)
+	}
+	if snapshotLabels[libhive.LabelHiveType] != libhive.ContainerTypeSnapshot || snapshotLabels[libhive.LabelHiveClientName] != "client-1" {
+		t.Fatalf("wrong snapshot labels: %v", snapshotLabels)
+	}
+	if _, ok := snapshotLabels[libhive.LabelHiveInstance]; !ok {
+		t.Fatalf("snapshot has no instance label: %v", snapshotLabels)
+	}
+}
+
+// This test checks that client crashes are reported to the test and stored in the results.
+func TestClientCrash(t *testing.T) {
+	var (
+		crash   = make(chan struct{})
+		release = make(chan struct{})
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			return &libhive.ContainerInfo{
+				ID:   containerID,
+				Wait: func() { <-crash },
+				ExitState: func() *libhive.ContainerExit {
+					return &libhive.ContainerExit{ExitCode: 137, OOMKilled: true}
+				},
+			}, nil
+		},
+	})
+	defer srv.Close()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{Name: "test", Run: func(t *T) {
+		c := t.StartClient("client-1")
+		status, err := c.Status()
+		if err != nil {
+			t.Fatal("can't get status:", err)
+		}
+		if status.State != ClientRunning {
+			t.Fatalf("wrong state before crash: %q", status.State)
+		}
+		t.FailOnCrash(c)
+		close(crash)
+		// The test function is not stopped when the client crashes.
+		<-release
+	}})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	close(release)
+	tm.Terminate()
+
+	var test *libhive.TestCase
+	for _, tc := range tm.Results()[0].TestCases {
+		test = tc
+	}
+	result := test.SummaryResult
+	if result.Pass {
+		t.Fatal("test passed")
+	}
+	if !result.ClientCrashed {
+		t.Fatal("crash not recorded in result")
+	}
+	if !strings.Contains(result.Details, "crashed with exit code 137 (out of memory)") {
+		t.Fatalf("crash not logged in details: %q", result.Details)
+	}
+	for _, client := range test.ClientInfo {
+		if client.Exit == nil || client.Exit.ExitCode != 137 || !client.Exit.OOMKilled {
+			t.Fatalf("wrong exit state: %+v", client.Exit)
+		}
+	}
+}
+
+// This test checks reading and following client logs.
+func TestClientLogs(t *testing.T) {
+	var logFile = make(chan string, 1)
+	tm, srv := newFakeAPIWithEnv(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			if err := os.MkdirAll(filepath.Dir(opt.LogFile), 0755); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(opt.LogFile, []byte("starting client\n"), 0644); err != nil {
+				return nil, err
+			}
+			logFile <- opt.LogFile
+			return &libhive.ContainerInfo{}, nil
+		},
+	}, libhive.SimEnv{LogDir: t.TempDir()})
+	defer srv.Close()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{Name: "test", Run: func(t *T) {
+		c := t.StartClient("client-1")
+		output, err := c.Logs()
+		if err != nil {
+			t.Fatal("can't get logs:", err)
+		}
+		if output != "starting client\n" {
+			t.Fatalf("wrong log output: %q", output)
+		}
+
+		// Append to the log while waiting.
+		file := <-logFile
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			fd, _ := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+			fd.WriteString("Imported new chain segment number=1\n")
+			fd.Close()
+		}()
+		line, err := c.WaitForLog(regexp.MustCompile("Imported new chain segment"), 5*time.Second)
+		if err != nil {
+			t.Fatal("WaitForLog failed:", err)
+		}
+		if line != "Imported new chain segment number=1" {
+			t.Fatalf("wrong line returned: %q", line)
+		}
+
+		// Check offsets.
+		data, end, err := t.Sim.ClientLog(t.SuiteID, t.TestID, c.Container, 16)
+		if err != nil {
+			t.Fatal("can't get logs:", err)
+		}
+		if string(data) != "Imported new chain segment number=1\n" || end != 52 {
+			t.Fatalf("wrong log output at offset: %q (end %d)", data, end)
+		}
+
+		// Check timeout.
+		if _, err := c.WaitForLog(regexp.MustCompile("never printed"), 200*time.Millisecond); err == nil {
+			t.Fatal("no error for missing log line")
+		}
+	}})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	for _, test := range tm.Results()[0].TestCases {
+		if !test.SummaryResult.Pass {
+			t.Fatalf("test %q failed: %s", test.Name, test.SummaryResult.Details)
+		}
+	}
+}
+
+// This test checks copying files out of client containers.
+func TestClientFiles(t *testing.T) {
+	logdir := t.TempDir()
+	tm, srv := newFakeAPIWithEnv(&fakes.BackendHooks{
+		DownloadFiles: func(containerID, path string) (io.ReadCloser, error) {
+			switch path {
+			case "/data/file.txt":
+				return makeTar(t, map[string]string{"file.txt": "file content"}), nil
+			case "/data/dir":
+				return makeTar(t, map[string]string{"dir/": "", "dir/a.txt": "a", "dir/sub/b.txt": "b"}), nil
+			default:
+				return nil, fmt.Errorf("no such file: %s", path)
+			}
+		},
+	}, libhive.SimEnv{LogDir: logdir})
+	defer srv.Close()
+
+	dest := t.TempDir()
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{Name: "test", Run: func(t *T) {
+		c := t.StartClient("client-1")
+		content, err := c.ReadFile("/data/file.txt")
+		if err != nil {
+			t.Fatal("ReadFile failed:", err)
+		}
+		if string(content) != "file content" {
+			t.Fatalf("wrong file content: %q", content)
+		}
+		if _, err := c.ReadFile("/data/dir"); err == nil {
+			t.Error("no error reading directory as file")
+		}
+		if _, err := c.ReadFile("/data/missing"); err == nil {
+			t.Error("no error reading missing file")
+		}
+		if err := c.CopyDir("/data/dir", dest); err != nil {
+			t.Fatal("CopyDir failed:", err)
+		}
+		if err := c.AttachFiles("/data/dir"); err != nil {
+			t.Fatal("AttachFiles failed:", err)
+		}
+	}})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	for _, test := range tm.Results()[0].TestCases {
+		if !test.SummaryResult.Pass {
+			t.Fatalf("test %q failed: %s", test.Name, test.SummaryResult.Details)
+		}
+		if len(test.Artifacts) != 1 {
+			t.Fatalf("wrong number of artifacts: %d", len(test.Artifacts))
+		}
+		a := test.Artifacts[0]
+		if a.Path != "/data/dir" || a.Client != "client-1" {
+			t.Fatalf("wrong artifact: %+v", a)
+		}
+		if _, err := os.Stat(filepath.Join(logdir, filepath.FromSlash(a.File))); err != nil {
+			t.Fatal("artifact file not stored:", err)
+		}
+	}
+	for file, want := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		content, err := os.ReadFile(filepath.Join(dest, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Fatalf("wrong content of %s: %q", file, content)
+		}
+	}
+}
+
+// This test checks that files attached by a test are stored with the result.
+func TestAttach(t *testing.T) {
+	logdir := t.TempDir()
+	tm, srv := newFakeAPIWithEnv(nil, libhive.SimEnv{LogDir: logdir})
+	defer srv.Close()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{Name: "test", Run: func(t *T) {
+		t.Attach("trace.txt", strings.NewReader("trace"))
+		t.AttachJSON("payload.json", map[string]int{"number": 1})
+	}})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	test := tm.Results()[0].TestCases[1]
+	if !test.SummaryResult.Pass {
+		t.Fatal("test failed:", test.SummaryResult.Details)
+	}
+	if len(test.Artifacts) != 2 {
+		t.Fatalf("wrong number of artifacts: %d", len(test.Artifacts))
+	}
+	want := map[string]string{
+		"trace.txt":    "trace",
+		"payload.json": "{\n  \"number\": 1\n}",
+	}
+	for _, a := range test.Artifacts {
+		if a.Client != "" || path.Ext(a.File) != path.Ext(a.Name) {
+			t.Errorf("wrong artifact: %+v", a)
+		}
+		content, err := os.ReadFile(filepath.Join(logdir, filepath.FromSlash(a.File)))
+		if err != nil {
+			t.Fatal("artifact file not stored:", err)
+		}
+		if string(content) != want[a.Name] {
+			t.Errorf("wrong content of %s: %q", a.Name, content)
+		}
+	}
+}
+
+// This test checks that files can be copied out of a stopped client, and that the
+// container of the client is removed when the test ends.
+func TestStoppedClientFiles(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, containerID)
+			return nil
+		},
+		DownloadFiles: func(containerID, path string) (io.ReadCloser, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if slices.Contains(deleted, containerID) {
+				return nil, fmt.Errorf("no such container: %s", containerID)
+			}
+			return makeTar(t, map[string]string{"file.txt": "file content"}), nil
+		},
+	})
+	defer srv.Close()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{Name: "test", Run: func(t *T) {
+		c := t.StartClient("client-1")
+		if err := t.Sim.StopClient(t.SuiteID, t.TestID, c.Container); err != nil {
+			t.Fatal("StopClient failed:", err)
+		}
+		content, err := c.ReadFile("/data/file.txt")
+		if err != nil {
+			t.Fatal("ReadFile failed after stopping client:", err)
+		}
+		if string(content) != "file content" {
+			t.Fatalf("wrong file content: %q", content)
+		}
+	}})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	test := tm.Results()[0].TestCases[1]
+	if !test.SummaryResult.Pass {
+		t.Fatal("test failed:", test.SummaryResult.Details)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(deleted) != 1 {
+		t.Fatalf("stopped client container not removed at end of test: %v", deleted)
+	}
+}
+
+func makeTar(t *testing.T, files map[string]string) io.ReadCloser {
+	var (
+		buf bytes.Buffer
+		tw  = tar.NewWriter(&buf)
+	)
+	names := slices.Sorted(maps.Keys(files))
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(name, "/") {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return io.NopCloser(&buf)
+}
+
 // This checks running scripts in a client container.
 func TestRunProgram(t *testing.T) {
 	hooks := &fakes.BackendHooks{
@@ -401,11 +974,21 @@ func TestStartClientInitialNetworks(t *testing.T) {
 }
 
 func newFakeAPI(hooks *fakes.BackendHooks) (*libhive.TestManager, *httptest.Server) {
+	return newFakeAPIWithEnv(hooks, libhive.SimEnv{})
+}
+
+func newFakeAPIWithEnv(hooks *fakes.BackendHooks, env libhive.SimEnv) (*libhive.TestManager, *httptest.Server) {
 	defs := []*libhive.ClientDefinition{
-		{Name: "client-1", Image: "/ignored/in/api", Version: "client-1-version", Meta: libhive.ClientMetadata{Roles: []string{"eth1"}}},
-		{Name: "client-2", Image: "/not/exposed/", Version: "client-2-version", Meta: libhive.ClientMetadata{Roles: []string{"beacon"}}},
+		{Name: "client-1", Image: "/ignored/in/api", Version: "client-1-version", Meta: libhive.ClientMetadata{
+			Roles: []string{"eth1"},
+			Capabilities: libhive.ClientCapabilities{
+				Forks:     []string{"Cancun", "Prague"},
+				APIs:      []string{"eth", "engine/v3"},
+				Protocols: []string{"eth/68", "snap/1"},
+			},
+		}},
+		{Name: "client-2", Image: "/not/exposed/", Version: "client-2-version", Meta: libhive.ClientMetadata{Roles: []string{"beacon"}}, Resources: &simapi.Resources{Memory: 1 << 30, Pids: 100}},
 	}
-	env := libhive.SimEnv{}
 	backend := fakes.NewContainerBackend(hooks)
 	hiveInfo := libhive.HiveInfo{
 		Command: []string{"/hive"},
@@ -414,3 +997,77 @@ func newFakeAPI(hooks *fakes.BackendHooks) (*libhive.TestManager, *httptest.Serv
 	srv := httptest.NewServer(tm.API())
 	return tm, srv
 }
+
+type web3API struct{}
+
+func (web3API) ClientVersion() string { return "fake/v1.0.0" }
+
+// This test checks that client RPC requests are recorded when RecordRPC is set.
+func TestRecordRPC(t *testing.T) {
+	rpcsrv := rpc.NewServer()
+	rpcsrv.RegisterName("web3", web3API{})
+	httpsrv := httptest.NewServer(rpcsrv)
+	defer httpsrv.Close()
+
+	var dialed []string
+	logdir := t.TempDir()
+	tm, srv := newFakeAPIWithEnv(&fakes.BackendHooks{
+		DialContainer: func(addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return net.Dial("tcp", httpsrv.Listener.Addr().String())
+		},
+	}, libhive.SimEnv{LogDir: logdir})
+	defer srv.Close()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(TestSpec{Name: "test", RecordRPC: true, Run: func(t *T) {
+		c := t.StartClient("client-1")
+		var version string
+		if err := c.RPC().Call(&version, "web3_clientVersion"); err != nil {
+			t.Fatal("RPC call failed:", err)
+		}
+		if version != "fake/v1.0.0" {
+			t.Fatalf("wrong client version %q", version)
+		}
+	}})
+	if err := RunSuite(NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	if len(dialed) == 0 || !strings.HasSuffix(dialed[0], ":8545") {
+		t.Fatalf("wrong dialed addresses %q", dialed)
+	}
+	test := tm.Results()[0].TestCases[1]
+	if !test.SummaryResult.Pass {
+		t.Fatal("test failed:", test.SummaryResult.Details)
+	}
+	var transcript string
+	for _, info := range test.ClientInfo {
+		transcript = info.RPCTranscript
+	}
+	if transcript == "" {
+		t.Fatal("no RPC transcript in client info")
+	}
+	content, err := os.ReadFile(filepath.Join(logdir, filepath.FromSlash(transcript)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("wrong number of recorded exchanges %d", len(lines))
+	}
+	var ex libhive.RPCExchange
+	if err := json.Unmarshal([]byte(lines[0]), &ex); err != nil {
+		t.Fatal("invalid transcript:", err)
+	}
+	if ex.Port != 8545 || ex.Method != "POST" || ex.Path != "/" || ex.Status != 200 {
+		t.Errorf("wrong exchange: port %d, %s %s, status %d", ex.Port, ex.Method, ex.Path, ex.Status)
+	}
+	if !strings.Contains(string(ex.Request), `"method":"web3_clientVersion"`) {
+		t.Errorf("wrong recorded request %s", ex.Request)
+	}
+	if !strings.Contains(string(ex.Response), `"result":"fake/v1.0.0"`) {
+		t.Errorf("wrong recorded response %s", ex.Response)
+	}
+}
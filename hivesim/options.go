@@ -37,6 +37,26 @@ func WithInitialNetworks(networks []string) StartOption {
 	})
 }
 
+// Resources contains resource limits of a client container.
+// Zero values mean there is no limit.
+type Resources = simapi.Resources
+
+// WithResources sets the resource limits of the client container. Limits set here
+// override the defaults configured for the client in the hive client file.
+func WithResources(r Resources) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.config.Resources = &r
+	})
+}
+
+// WithSnapshot starts the client from a snapshot of another client. The snapshot must
+// have been created in the same test suite, from a client of the same type.
+func WithSnapshot(id string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.config.Snapshot = id
+	})
+}
+
 // WithStaticFiles adds files from the local filesystem to the client. Map: destination file path -> source file path.
 func WithStaticFiles(initFiles map[string]string) StartOption {
 	return optionFunc(func(setup *clientSetup) {
@@ -1,18 +1,28 @@
 package hivesim
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/hive/internal/simapi"
 )
 
+// maxLogLine is the max length of client log lines matched by Client.WaitForLog.
+const maxLogLine = 1024 * 1024
+
 // Suite is the description of a test suite.
 type Suite struct {
 	Name        string // Name is the unique identifier for the suite [Mandatory]
@@ -41,7 +51,7 @@ func (s *Suite) Add(test AnyTest) *Suite {
 
 // AnyTest is a TestSpec or ClientTestSpec.
 type AnyTest interface {
-	runTest(*Simulation, SuiteID, *Suite) error
+	runTest(*Simulation, SuiteID, *Suite, *testGroup) error
 }
 
 // Run executes all given test suites.
@@ -77,12 +87,14 @@ func RunSuite(host *Simulation, suite Suite) error {
 	}
 	defer host.EndSuite(suiteID)
 
+	group := newTestGroup(0)
 	for _, test := range suite.Tests {
-		if err := test.runTest(host, suiteID, &suite); err != nil {
+		if err := test.runTest(host, suiteID, &suite, group); err != nil {
+			group.wait()
 			return err
 		}
 	}
-	return nil
+	return group.wait()
 }
 
 // MustRunSuite runs the given suite, exiting the process if there is a problem reaching
@@ -118,6 +130,14 @@ type TestSpec struct {
 	// then perform further tests against it.
 	AlwaysRun bool
 
+	// Timeout is the time limit of the test. If zero, the default limit of the run is
+	// used (see --sim.testtimeout). Time spent in subtests doesn't count.
+	Timeout time.Duration
+
+	// If RecordRPC is true, HTTP requests sent to the clients of the test are recorded
+	// by hive, like with --sim.record-rpc.
+	RecordRPC bool
+
 	// The Run function is invoked when the test executes.
 	Run func(*T)
 }
@@ -126,7 +146,8 @@ type TestSpec struct {
 // directly, or launch it using RunClient or RunAllClients from another test.
 //
 // When used as a test in a suite, the test runs against all available client types,
-// with the specified Role. If no Role is specified, the test runs with all available clients.
+// with the specified Role and Capabilities. If neither is specified, the test runs with all
+// available clients.
 //
 // If the Name of the test includes "CLIENT", it is replaced by the client name being tested.
 type ClientTestSpec struct {
@@ -146,6 +167,20 @@ type ClientTestSpec struct {
 	// If no role is specified, the test runs for all available client types.
 	Role string
 
+	// This filters client types by the capabilities declared in their hive.yaml.
+	// Capabilities are written as "fork:<name>", "api:<namespace>" or "protocol:<name>",
+	// e.g. "fork:Cancun", "api:engine/v3" or "protocol:snap/1". The test runs only for
+	// clients having all listed capabilities.
+	Capabilities []string
+
+	// Timeout is the time limit of the test. If zero, the default limit of the run is
+	// used (see --sim.testtimeout). Time spent in subtests doesn't count.
+	Timeout time.Duration
+
+	// If RecordRPC is true, HTTP requests sent to the clients of the test are recorded
+	// by hive, like with --sim.record-rpc.
+	RecordRPC bool
+
 	// Parameters and Files are launch options for client instances.
 	Parameters Params
 	Files      map[string]string
@@ -164,6 +199,10 @@ type Client struct {
 	rpc       *rpc.Client
 	enginerpc *rpc.Client
 	test      *T
+
+	crashOnce sync.Once
+	crashed   chan struct{}
+	exit      *ClientStatus
 }
 
 // EnodeURL returns the default peer-to-peer endpoint of the client.
@@ -176,12 +215,22 @@ func (c *Client) EnodeURLNetwork(network string) (string, error) {
 	return c.test.Sim.ClientEnodeURLNetwork(c.test.SuiteID, c.test.TestID, c.Container, network)
 }
 
+// URL returns the base URL of an HTTP server of the client. When RPC recording is
+// enabled for the test, the URL points to the recording proxy of hive, which relays
+// requests to the client.
+func (c *Client) URL(port int) string {
+	if c.test.recordRPC {
+		return c.test.Sim.clientProxyURL(c.test.SuiteID, c.test.TestID, c.Container, port)
+	}
+	return fmt.Sprintf("http://%v", net.JoinHostPort(c.IP.String(), strconv.Itoa(port)))
+}
+
 // RPC returns an RPC client connected to the client's RPC server.
 func (c *Client) RPC() *rpc.Client {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.rpc == nil {
-		c.rpc, _ = rpc.DialHTTP(fmt.Sprintf("http://%v:8545", c.IP))
+		c.rpc, _ = rpc.DialHTTP(c.URL(8545))
 	}
 	return c.rpc
 }
@@ -195,8 +244,7 @@ func (c *Client) EngineAPI() *rpc.Client {
 		return c.enginerpc
 	}
 	auth := rpc.WithHTTPAuth(jwtAuth(ENGINEAPI_JWT_SECRET))
-	url := fmt.Sprintf("http://%v:8551", c.IP)
-	c.enginerpc, _ = rpc.DialOptions(context.Background(), url, auth)
+	c.enginerpc, _ = rpc.DialOptions(context.Background(), c.URL(8551), auth)
 	return c.enginerpc
 }
 
@@ -215,6 +263,115 @@ func (c *Client) Unpause() error {
 	return c.test.Sim.UnpauseClient(c.test.SuiteID, c.test.TestID, c.Container)
 }
 
+// Snapshot saves the state of the client. Use WithSnapshot to start new clients from
+// the snapshot. This is useful for reusing an expensive client setup across the tests
+// of a suite.
+func (c *Client) Snapshot() (string, error) {
+	return c.test.Sim.SnapshotClient(c.test.SuiteID, c.test.TestID, c.Container)
+}
+
+// Status returns the current state of the client.
+func (c *Client) Status() (*ClientStatus, error) {
+	return c.test.Sim.ClientStatus(c.test.SuiteID, c.test.TestID, c.Container)
+}
+
+// Crashed returns a channel which is closed when the client exits by itself while
+// the test is running. The channel is never closed if the client is stopped by hive.
+func (c *Client) Crashed() <-chan struct{} {
+	c.crashOnce.Do(func() {
+		c.crashed = make(chan struct{})
+		go func() {
+			status, err := c.test.Sim.WaitClientExit(context.Background(), c.test.SuiteID, c.test.TestID, c.Container)
+			if err != nil || status.State != ClientExited {
+				return
+			}
+			c.mu.Lock()
+			c.exit = status
+			c.mu.Unlock()
+			close(c.crashed)
+		}()
+	})
+	return c.crashed
+}
+
+// Logs returns the log output of the client.
+func (c *Client) Logs() (string, error) {
+	data, _, err := c.test.Sim.ClientLog(c.test.SuiteID, c.test.TestID, c.Container, 0)
+	return string(data), err
+}
+
+// WaitForLog waits until the client log contains a line matching the given regular
+// expression, and returns the line. Lines printed before the call are also matched.
+// An error is returned when the timeout expires or the client stops before a
+// matching line appears.
+func (c *Client) WaitForLog(re *regexp.Regexp, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stream, err := c.test.Sim.FollowClientLog(ctx, c.test.SuiteID, c.test.TestID, c.Container, 0)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(nil, maxLogLine)
+	for scanner.Scan() {
+		if line := scanner.Text(); re.MatchString(line) {
+			return line, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("no log line matching %q within %v", re, timeout)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("client stopped without log line matching %q", re)
+}
+
+// ReadFile returns the content of a file in the client container.
+func (c *Client) ReadFile(path string) ([]byte, error) {
+	return c.test.Sim.ClientFile(c.test.SuiteID, c.test.TestID, c.Container, path)
+}
+
+// CopyDir copies a directory out of the client container. The content of the
+// directory is written to dest, which is created if it doesn't exist.
+func (c *Client) CopyDir(path, dest string) error {
+	archive, err := c.test.Sim.ClientArchive(c.test.SuiteID, c.test.TestID, c.Container, path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	return extractDir(archive, dest)
+}
+
+// AttachFiles stores a file or directory of the client container in the
+// hive results, where it can be found next to the test.
+func (c *Client) AttachFiles(path string) error {
+	return c.test.Sim.AttachClientFiles(c.test.SuiteID, c.test.TestID, c.Container, path)
+}
+
+// SetNetworkConditions applies network conditions to the traffic sent by the client.
+// The conditions replace any conditions set previously.
+func (c *Client) SetNetworkConditions(cond NetworkConditions) error {
+	return c.test.Sim.SetNetworkConditions(c.test.SuiteID, c.Container, cond)
+}
+
+// ClearNetworkConditions removes the network conditions of the client.
+func (c *Client) ClearNetworkConditions() error {
+	return c.test.Sim.ClearNetworkConditions(c.test.SuiteID, c.Container)
+}
+
+// Partition drops all traffic sent by the client to the given clients. Traffic in the
+// other direction is not affected. This replaces any network conditions of the client.
+func (c *Client) Partition(peers ...*Client) error {
+	var cond NetworkConditions
+	for _, peer := range peers {
+		cond.Peers = append(cond.Peers, PeerConditions{Node: peer.Container, Partition: true})
+	}
+	return c.SetNetworkConditions(cond)
+}
+
 // T is a running test. This is a lot like testing.T, but has some additional methods for
 // launching clients.
 //
@@ -227,10 +384,26 @@ type T struct {
 	suite   *Suite
 	mu      sync.Mutex
 	result  TestResult
+
+	attemptEnd chan struct{} // closed when the current attempt ends
+	abort      func()        // ends the current attempt early
+	ended      bool          // true when the attempt is over
+
+	group      *testGroup    // the suite or parent test
+	sub        *testGroup    // subtests started by the current attempt
+	timer      *testTimer    // time limit of the current attempt
+	parallel   chan struct{} // closed when Parallel is called
+	isParallel bool
+	holdsSlot  bool // true while the test holds a parallel test slot
+	recordRPC  bool // client requests go through the recording proxy
 }
 
 // StartClient starts a client instance. If the client cannot by started, the test fails immediately.
 func (t *T) StartClient(clientType string, option ...StartOption) *Client {
+	if t.attemptEnded() {
+		// The test timed out or was aborted, don't start clients for it anymore.
+		runtime.Goexit()
+	}
 	container, ip, err := t.Sim.StartClientWithOptions(t.SuiteID, t.TestID, clientType, option...)
 	if err != nil {
 		t.Fatalf("can't launch node (type %s): %v", clientType, err)
@@ -238,6 +411,33 @@ func (t *T) StartClient(clientType string, option ...StartOption) *Client {
 	return &Client{Type: clientType, Container: container, IP: ip, test: t}
 }
 
+// FailOnCrash makes the test fail immediately when one of the given clients crashes.
+// The test function is not stopped, but hive ends the test and stops its clients,
+// so the function should return soon after.
+func (t *T) FailOnCrash(clients ...*Client) {
+	t.mu.Lock()
+	end, abort := t.attemptEnd, t.abort
+	t.mu.Unlock()
+
+	for _, c := range clients {
+		go func() {
+			select {
+			case <-c.Crashed():
+				c.mu.Lock()
+				exit := c.exit
+				c.mu.Unlock()
+				if exit.OOMKilled {
+					t.Errorf("client %s (%s) crashed with exit code %d (out of memory)", c.Type, c.Container, exit.ExitCode)
+				} else {
+					t.Errorf("client %s (%s) crashed with exit code %d", c.Type, c.Container, exit.ExitCode)
+				}
+				abort()
+			case <-end:
+			}
+		}()
+	}
+}
+
 // RunClient runs the given client test against a single client type.
 // It waits for the subtest to complete.
 func (t *T) RunClient(clientType string, spec ClientTestSpec) {
@@ -249,8 +449,13 @@ func (t *T) RunClient(clientType string, spec ClientTestSpec) {
 		category:    spec.Category,
 		desc:        spec.Description,
 		alwaysRun:   spec.AlwaysRun,
+		timeout:     spec.Timeout,
+		recordRPC:   spec.RecordRPC,
+		role:        spec.Role,
+		caps:        spec.Capabilities,
 	}
-	runTest(t.Sim, test, func(t *T) {
+	defer t.pauseTimeout()()
+	runTest(t.Sim, t.subtests(), test, func(t *T) {
 		client := t.StartClient(clientType, spec.Parameters, WithStaticFiles(spec.Files))
 		spec.Run(t, client)
 	})
@@ -259,14 +464,97 @@ func (t *T) RunClient(clientType string, spec ClientTestSpec) {
 // RunAllClients runs the given client test against all available client types.
 // It waits for all subtests to complete.
 func (t *T) RunAllClients(spec ClientTestSpec) {
-	spec.runTest(t.Sim, t.SuiteID, t.suite)
+	defer t.pauseTimeout()()
+	spec.runTest(t.Sim, t.SuiteID, t.suite, t.subtests())
 }
 
 // Run runs a subtest of this test. It waits for the subtest to complete before continuing.
 // It is safe to call this from multiple goroutines concurrently, just be sure to wait for
 // all your tests to finish until returning from the parent test.
+//
+// If the subtest calls t.Parallel, Run returns immediately. The parallel subtest
+// starts when the parent test function has returned, and the parent test ends when all
+// its parallel subtests have finished.
 func (t *T) Run(spec TestSpec) {
-	spec.runTest(t.Sim, t.SuiteID, t.suite)
+	defer t.pauseTimeout()()
+	spec.runTest(t.Sim, t.SuiteID, t.suite, t.subtests())
+}
+
+// subtests returns the group of subtests of the current attempt.
+func (t *T) subtests() *testGroup {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sub
+}
+
+// pauseTimeout stops the timer of the current attempt while a subtest runs. It returns
+// a function which starts the timer again.
+func (t *T) pauseTimeout() func() {
+	t.mu.Lock()
+	timer := t.timer
+	t.mu.Unlock()
+	timer.pause()
+	return timer.resume
+}
+
+// Parallel signals that the test may run in parallel with other parallel tests of the
+// same suite or parent test. Like testing.T.Parallel, it pauses the test until the
+// sequential tests of the suite, or the parent test function, have finished. At most
+// HIVE_PARALLELISM parallel tests run at the same time.
+//
+// Parallel should be called at the start of the test function, before any clients
+// are launched. As with testing.T.Parallel, this must be called from the main test
+// goroutine.
+func (t *T) Parallel() {
+	t.mu.Lock()
+	if t.ended {
+		t.mu.Unlock()
+		runtime.Goexit()
+	}
+	if t.isParallel {
+		// The test is being retried, and the slot was taken when the attempt started.
+		t.mu.Unlock()
+		return
+	}
+	t.isParallel = true
+	end := t.attemptEnd
+	close(t.parallel)
+	t.mu.Unlock()
+
+	// Waiting doesn't count towards the time limit of the test.
+	defer t.pauseTimeout()()
+
+	select {
+	case <-t.group.barrier:
+	case <-end:
+		runtime.Goexit()
+	}
+	slots := t.Sim.parallelSlots()
+	select {
+	case slots <- struct{}{}:
+	case <-end:
+		runtime.Goexit()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-end:
+		// The attempt was aborted while waiting.
+		<-slots
+		runtime.Goexit()
+	default:
+		t.holdsSlot = true
+	}
+}
+
+// releaseSlot gives up the parallel test slot held by the test.
+func (t *T) releaseSlot() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.holdsSlot {
+		<-t.Sim.parallelSlots()
+		t.holdsSlot = false
+	}
 }
 
 // Error is like testing.T.Error.
@@ -297,6 +585,9 @@ func (t *T) Fatalf(format string, values ...interface{}) {
 func (t *T) Logf(format string, values ...interface{}) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	if t.ended {
+		return
+	}
 	if !strings.HasSuffix(format, "\n") {
 		format = format + "\n"
 	}
@@ -308,10 +599,46 @@ func (t *T) Logf(format string, values ...interface{}) {
 func (t *T) Log(values ...interface{}) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	if t.ended {
+		return
+	}
 	fmt.Println(values...)
 	t.result.Details += fmt.Sprintln(values...)
 }
 
+// Measure records a numeric measurement of the test, such as the time taken to sync.
+// The unit is optional. Recording a measurement again replaces the previous value.
+func (t *T) Measure(name string, value float64, unit string) {
+	if t.attemptEnded() {
+		return
+	}
+	m := Measurement{Name: name, Value: value, Unit: unit}
+	if err := t.Sim.RecordMeasurement(t.SuiteID, t.TestID, m); err != nil {
+		t.Errorf("can't record measurement %s: %v", name, err)
+	}
+}
+
+// Attach stores the content of r with the test result, e.g. a payload dump or a trace.
+// The name identifies the file in the result, and its extension is kept.
+func (t *T) Attach(name string, r io.Reader) {
+	if t.attemptEnded() {
+		return
+	}
+	if err := t.Sim.AttachTestFile(t.SuiteID, t.TestID, name, r); err != nil {
+		t.Errorf("can't attach %s: %v", name, err)
+	}
+}
+
+// AttachJSON stores the JSON encoding of v with the test result.
+func (t *T) AttachJSON(name string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Errorf("can't encode %s: %v", name, err)
+		return
+	}
+	t.Attach(name, bytes.NewReader(data))
+}
+
 // Failed reports whether the test has already failed.
 func (t *T) Failed() bool {
 	t.mu.Lock()
@@ -323,7 +650,9 @@ func (t *T) Failed() bool {
 func (t *T) Fail() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	t.result.Pass = false
+	if !t.ended {
+		t.result.Pass = false
+	}
 }
 
 // FailNow signals that the test has failed and exits the test immediately.
@@ -333,6 +662,66 @@ func (t *T) FailNow() {
 	runtime.Goexit()
 }
 
+// Skip is like testing.T.Skip. It logs the arguments and marks the test as skipped.
+func (t *T) Skip(values ...interface{}) {
+	t.Log(values...)
+	t.SkipNow()
+}
+
+// Skipf is like testing.T.Skipf. It logs the message and marks the test as skipped.
+func (t *T) Skipf(format string, values ...interface{}) {
+	t.Logf(format, values...)
+	t.SkipNow()
+}
+
+// SkipNow marks the test as skipped and exits the test immediately. Skipped tests are
+// reported separately from passing tests. A test which has failed before it is skipped
+// is still reported as failed.
+// As with testing.T.SkipNow(), this should only be called from the main test goroutine.
+func (t *T) SkipNow() {
+	t.mu.Lock()
+	if !t.ended {
+		t.result.Skipped = true
+	}
+	t.mu.Unlock()
+	runtime.Goexit()
+}
+
+// attemptEnded reports whether the attempt of the test has ended. Once the attempt has
+// ended, the methods of T no longer affect the test result. A retry of the test runs with
+// a new T.
+func (t *T) attemptEnded() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ended
+}
+
+// nextAttempt returns the T of the next attempt of a test. Each attempt has its own T,
+// so a test function which is still running after its attempt has timed out can't
+// modify the result or subtests of the next attempt.
+func (t *T) nextAttempt() *T {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &T{
+		Sim:        t.Sim,
+		TestID:     t.TestID,
+		SuiteID:    t.SuiteID,
+		suite:      t.suite,
+		result:     TestResult{Pass: true},
+		group:      t.group,
+		parallel:   t.parallel,
+		isParallel: t.isParallel,
+		recordRPC:  t.recordRPC,
+	}
+}
+
+// Skipped reports whether the test was skipped.
+func (t *T) Skipped() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.result.Skipped
+}
+
 type testSpec struct {
 	suiteID     SuiteID
 	suite       *Suite
@@ -341,44 +730,291 @@ type testSpec struct {
 	category    string
 	desc        string
 	alwaysRun   bool
+	timeout     time.Duration
+	recordRPC   bool
+	role        string
+	caps        []string
 }
 
 func (spec testSpec) request() TestStartInfo {
 	return TestStartInfo{
-		Name:        spec.name,
-		DisplayName: spec.displayName,
-		Category:    spec.category,
-		Description: spec.desc,
+		Name:         spec.name,
+		DisplayName:  spec.displayName,
+		Category:     spec.category,
+		Description:  spec.desc,
+		Role:         spec.role,
+		Capabilities: spec.caps,
+		Timeout:      -1, // the time limit is enforced by runAttempt
+	}
+}
+
+// testTimer is the time limit of a test attempt. It can be paused while the test
+// waits for subtests.
+type testTimer struct {
+	mu        sync.Mutex
+	timer     *time.Timer
+	remaining time.Duration
+	started   time.Time
+	paused    int
+	stopped   bool // true while the timer is paused
+	fired     chan struct{}
+}
+
+func newTestTimer(d time.Duration) *testTimer {
+	tt := &testTimer{remaining: d, started: time.Now(), fired: make(chan struct{})}
+	tt.timer = time.AfterFunc(d, func() { close(tt.fired) })
+	return tt
+}
+
+// expired returns a channel which is closed when the time limit is exceeded.
+// For a nil timer, the channel is nil.
+func (tt *testTimer) expired() <-chan struct{} {
+	if tt == nil {
+		return nil
+	}
+	return tt.fired
+}
+
+func (tt *testTimer) pause() {
+	if tt == nil {
+		return
+	}
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.paused++
+	if tt.paused == 1 && tt.timer.Stop() {
+		tt.remaining -= time.Since(tt.started)
+		tt.stopped = true
+	}
+}
+
+func (tt *testTimer) resume() {
+	if tt == nil {
+		return
+	}
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.paused--
+	if tt.paused == 0 && tt.stopped {
+		tt.stopped = false
+		tt.started = time.Now()
+		tt.timer.Reset(tt.remaining)
+	}
+}
+
+func (tt *testTimer) stop() {
+	if tt == nil {
+		return
+	}
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.timer.Stop()
+	tt.stopped = false
+}
+
+// testGroup tracks the tests of a suite or the subtests of a test. Parallel tests of the
+// group wait until the barrier is closed.
+type testGroup struct {
+	parent    TestID // zero for the tests of a suite
+	inShard   bool   // true if the parent test was selected by sharding
+	wg        sync.WaitGroup
+	barrier   chan struct{} // closed when the sequential tests of the group have finished
+	aborted   chan struct{} // closed when the attempt of the parent test ended early
+	abortOnce sync.Once
+	errOnce   sync.Once
+	err       error
+
+	mu     sync.Mutex
+	closed bool // true when no more tests can be added
+}
+
+func newTestGroup(parent TestID) *testGroup {
+	return &testGroup{parent: parent, barrier: make(chan struct{}), aborted: make(chan struct{})}
+}
+
+// add registers a test of the group. It returns false if the group is already
+// waiting for its tests to finish.
+func (g *testGroup) add() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// wait starts the parallel tests of the group and waits for all tests to finish. It
+// returns the first error of a parallel test.
+func (g *testGroup) wait() error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+	close(g.barrier)
+	g.wg.Wait()
+	return g.err
+}
+
+// abort ends the running tests of the group.
+func (g *testGroup) abort() {
+	g.abortOnce.Do(func() { close(g.aborted) })
+}
+
+func (g *testGroup) isAborted() bool {
+	select {
+	case <-g.aborted:
+		return true
+	default:
+		return false
 	}
 }
 
-func runTest(host *Simulation, test testSpec, runit func(t *T)) error {
+func (g *testGroup) setErr(err error) {
+	if err != nil {
+		g.errOnce.Do(func() { g.err = err })
+	}
+}
+
+func runTest(host *Simulation, group *testGroup, test testSpec, runit func(t *T)) error {
 	if !test.alwaysRun && !host.m.match(test.suite.Name, test.name) {
 		if host.ll > 3 { // hive log level > 3
 			fmt.Fprintf(os.Stderr, "skipping test %q because it doesn't match test pattern %s\n", test.name, host.m.pattern)
 		}
 		return nil
 	}
+	// Tests are sharded at the first level which is subject to the test pattern.
+	// Subtests of a selected test run in the same shard.
+	if !test.alwaysRun && !group.inShard && !host.shard.match(test.suite.Name, test.name) {
+		if host.ll > 3 { // hive log level > 3
+			fmt.Fprintf(os.Stderr, "skipping test %q because it isn't in shard %s\n", test.name, host.shard.spec)
+		}
+		return nil
+	}
+	if !test.alwaysRun && host.isCompleted(test.suite.Name, test.name) {
+		if host.ll > 3 { // hive log level > 3
+			fmt.Fprintf(os.Stderr, "skipping test %q because it passed in the resumed run\n", test.name)
+		}
+		return nil
+	}
+
+	// Tests can't be added to the group once the attempt of the parent test has
+	// ended. This happens when a timed out test function keeps running.
+	if !group.add() {
+		return nil
+	}
 
 	// Register test on simulation server and initialize the T.
 	t := &T{
-		Sim:     host,
-		SuiteID: test.suiteID,
-		suite:   test.suite,
+		Sim:       host,
+		SuiteID:   test.suiteID,
+		suite:     test.suite,
+		result:    TestResult{Pass: true},
+		group:     group,
+		parallel:  make(chan struct{}),
+		recordRPC: test.recordRPC || host.recordRPC,
+	}
+	if test.timeout == 0 {
+		test.timeout = host.testTimeout
 	}
-	testID, err := host.StartTest(test.suiteID, test.request())
+	req := test.request()
+	req.Parent = group.parent
+	testID, err := host.StartTest(test.suiteID, req)
 	if err != nil {
+		group.wg.Done()
 		return err
 	}
 	t.TestID = testID
-	t.result.Pass = true
+
+	// The test runs in its own goroutine, so the caller can continue with the next test
+	// when the test calls t.Parallel.
+	done := make(chan error, 1)
+	go func() {
+		defer group.wg.Done()
+		err := runAttempts(host, test, t, runit)
+		group.setErr(err)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-t.parallel:
+		return nil
+	}
+}
+
+// runAttempts runs the test function and reports the result.
+func runAttempts(host *Simulation, test testSpec, t *T, runit func(t *T)) error {
+	testID := t.TestID
 	defer func() {
 		t.mu.Lock()
 		defer t.mu.Unlock()
 		host.EndTest(test.suiteID, testID, t.result)
 	}()
 
-	// Run the test function.
+	// Run the test function. Failed tests are run again if retries are enabled, unless
+	// they were aborted because the parent test ended.
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			t = t.nextAttempt()
+		}
+		runAttempt(host, test, t, runit)
+		if !t.Failed() || attempt >= host.retries || t.group.isAborted() {
+			return nil
+		}
+		t.mu.Lock()
+		err := host.RetryTest(test.suiteID, testID, t.result)
+		t.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// runAttempt runs the test function once. When the function has returned, it waits for
+// the parallel subtests started by the function.
+func runAttempt(host *Simulation, test testSpec, t *T, runit func(t *T)) {
+	var (
+		end       = make(chan struct{})
+		abort     = make(chan struct{})
+		abortOnce sync.Once
+		sub       = newTestGroup(t.TestID)
+	)
+	sub.inShard = t.group.inShard || !test.alwaysRun
+	t.mu.Lock()
+	t.attemptEnd = end
+	t.abort = func() { abortOnce.Do(func() { close(abort) }) }
+	t.sub = sub
+	retryParallel := t.isParallel
+	t.mu.Unlock()
+	if retryParallel {
+		host.parallelSlots() <- struct{}{}
+		t.mu.Lock()
+		t.holdsSlot = true
+		t.mu.Unlock()
+	}
+	var timer *testTimer
+	if test.timeout > 0 {
+		timer = newTestTimer(test.timeout)
+		t.mu.Lock()
+		t.timer = timer
+		t.mu.Unlock()
+	}
+	finished := false
+	defer func() {
+		timer.stop()
+		t.mu.Lock()
+		t.ended = true
+		t.mu.Unlock()
+		close(end)
+		t.releaseSlot()
+		if !finished {
+			// The test function may still be running. Its subtests are ended, so
+			// waiting for them doesn't block.
+			sub.abort()
+		}
+		sub.wait()
+	}()
+
 	done := make(chan struct{})
 	go func() {
 		defer func() {
@@ -396,11 +1032,26 @@ func runTest(host *Simulation, test testSpec, runit func(t *T)) error {
 		}
 		runit(t)
 	}()
-	<-done
-	return nil
+	select {
+	case <-done:
+		finished = true
+	case <-abort:
+	case <-t.group.aborted:
+		t.Errorf("test aborted because the parent test ended")
+	case <-timer.expired():
+		t.Errorf("test timed out after %v", test.timeout)
+		t.mu.Lock()
+		t.result.Timeout = true
+		t.mu.Unlock()
+	}
 }
 
-func (spec ClientTestSpec) runTest(host *Simulation, suiteID SuiteID, suite *Suite) error {
+func (spec ClientTestSpec) runTest(host *Simulation, suiteID SuiteID, suite *Suite, group *testGroup) error {
+	for _, c := range spec.Capabilities {
+		if err := checkCapability(c); err != nil {
+			return err
+		}
+	}
 	clients, err := host.ClientTypes()
 	if err != nil {
 		return err
@@ -411,6 +1062,9 @@ func (spec ClientTestSpec) runTest(host *Simulation, suiteID SuiteID, suite *Sui
 		if spec.Role != "" && !clientDef.HasRole(spec.Role) {
 			continue
 		}
+		if !clientDef.HasCapabilities(spec.Capabilities) {
+			continue
+		}
 		test := testSpec{
 			suiteID:     suiteID,
 			suite:       suite,
@@ -419,8 +1073,12 @@ func (spec ClientTestSpec) runTest(host *Simulation, suiteID SuiteID, suite *Sui
 			category:    spec.Category,
 			desc:        spec.Description,
 			alwaysRun:   spec.AlwaysRun,
+			timeout:     spec.Timeout,
+			recordRPC:   spec.RecordRPC,
+			role:        spec.Role,
+			caps:        spec.Capabilities,
 		}
-		err := runTest(host, test, func(t *T) {
+		err := runTest(host, group, test, func(t *T) {
 			client := t.StartClient(clientDef.Name, spec.Parameters, WithStaticFiles(spec.Files))
 			spec.Run(t, client)
 		})
@@ -442,7 +1100,7 @@ func clientTestName(name, clientType string) string {
 	return name + " (" + clientType + ")"
 }
 
-func (spec TestSpec) runTest(host *Simulation, suiteID SuiteID, suite *Suite) error {
+func (spec TestSpec) runTest(host *Simulation, suiteID SuiteID, suite *Suite, group *testGroup) error {
 	test := testSpec{
 		suiteID:     suiteID,
 		suite:       suite,
@@ -451,6 +1109,8 @@ func (spec TestSpec) runTest(host *Simulation, suiteID SuiteID, suite *Suite) er
 		category:    spec.Category,
 		desc:        spec.Description,
 		alwaysRun:   spec.AlwaysRun,
+		timeout:     spec.Timeout,
+		recordRPC:   spec.RecordRPC,
 	}
-	return runTest(host, test, spec.Run)
+	return runTest(host, group, test, spec.Run)
 }
@@ -1,13 +1,18 @@
 package hivesim
 
 import (
+	"fmt"
+	"math"
 	"reflect"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/hive/internal/libhive"
+	"github.com/ethereum/hive/internal/simapi"
 )
 
 // This test verifies that test errors are reported correctly through the API.
@@ -83,10 +88,611 @@ func removeTimestamps(result map[libhive.TestSuiteID]*libhive.TestSuite) {
 		for _, test := range suite.TestCases {
 			test.Start = time.Time{}
 			test.End = time.Time{}
+			for _, attempt := range test.Attempts {
+				attempt.Start = time.Time{}
+				attempt.End = time.Time{}
+			}
 		}
 	}
 }
 
+// This test verifies that failed tests are run again when retries are enabled.
+func TestRetries(t *testing.T) {
+	var flakyRuns int
+	suite := Suite{Name: "retries"}
+	suite.Add(TestSpec{
+		Name: "flaky test",
+		Run: func(t *T) {
+			flakyRuns++
+			if flakyRuns == 1 {
+				t.Fatal("first attempt failed")
+			}
+		},
+	})
+	suite.Add(TestSpec{
+		Name: "failing test",
+		Run: func(t *T) {
+			t.Fatal("failed")
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetRetries(2)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+
+	tm.Terminate()
+	results := tm.Results()
+	removeTimestamps(results)
+
+	wantResults := map[libhive.TestSuiteID]*libhive.TestSuite{
+		0: {
+			ID:             0,
+			Name:           suite.Name,
+			ClientVersions: make(map[string]string),
+			TestCases: map[libhive.TestID]*libhive.TestCase{
+				1: {
+					Name:          "flaky test",
+					SummaryResult: libhive.TestResult{Pass: true, Flaky: true},
+					Attempts: []*libhive.TestAttempt{
+						{Result: libhive.TestResult{Details: "first attempt failed\n"}},
+					},
+				},
+				2: {
+					Name:          "failing test",
+					SummaryResult: libhive.TestResult{Details: "failed\n"},
+					Attempts: []*libhive.TestAttempt{
+						{Result: libhive.TestResult{Details: "failed\n"}},
+						{Result: libhive.TestResult{Details: "failed\n"}},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Fatal("wrong results reported:", spew.Sdump(results))
+	}
+}
+
+// This test verifies that skipped tests are reported as skipped, and that a test which
+// fails before skipping is reported as failed.
+func TestSkip(t *testing.T) {
+	suite := Suite{Name: "skip"}
+	suite.Add(TestSpec{
+		Name: "skipped test",
+		Run: func(t *T) {
+			t.Skipf("not supported by %s", "client")
+			t.Error("unreachable")
+		},
+	})
+	suite.Add(TestSpec{
+		Name: "failed and skipped test",
+		Run: func(t *T) {
+			t.Error("failed")
+			t.Skip("skipped")
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetRetries(1)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+
+	tm.Terminate()
+	results := tm.Results()
+	removeTimestamps(results)
+
+	wantResults := map[libhive.TestSuiteID]*libhive.TestSuite{
+		0: {
+			ID:             0,
+			Name:           suite.Name,
+			ClientVersions: make(map[string]string),
+			TestCases: map[libhive.TestID]*libhive.TestCase{
+				1: {
+					Name:          "skipped test",
+					SummaryResult: libhive.TestResult{Pass: true, Skipped: true, Details: "not supported by client\n"},
+				},
+				2: {
+					Name:          "failed and skipped test",
+					SummaryResult: libhive.TestResult{Details: "failed\nskipped\n"},
+					Attempts: []*libhive.TestAttempt{
+						{Result: libhive.TestResult{Details: "failed\nskipped\n"}},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Fatal("wrong results reported:", spew.Sdump(results))
+	}
+}
+
+// This test verifies that subtests are reported with their parent test, and that
+// failed subtests fail the parent.
+func TestSubtests(t *testing.T) {
+	suite := Suite{Name: "subtests"}
+	suite.Add(TestSpec{
+		Name: "parent",
+		Run: func(t *T) {
+			t.Run(TestSpec{
+				Name: "child",
+				Run: func(t *T) {
+					t.Run(TestSpec{
+						Name: "grandchild",
+						Run:  func(t *T) {},
+					})
+				},
+			})
+			t.Run(TestSpec{
+				Name: "failing child",
+				Run: func(t *T) {
+					t.Error("failed")
+				},
+			})
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+
+	tm.Terminate()
+	results := tm.Results()
+	removeTimestamps(results)
+
+	wantResults := map[libhive.TestSuiteID]*libhive.TestSuite{
+		0: {
+			ID:             0,
+			Name:           suite.Name,
+			ClientVersions: make(map[string]string),
+			TestCases: map[libhive.TestID]*libhive.TestCase{
+				1: {
+					Name:          "parent",
+					SummaryResult: libhive.TestResult{Details: "1 of 2 subtests failed:\n  failing child\n"},
+				},
+				2: {
+					Name:          "child",
+					Parent:        1,
+					SummaryResult: libhive.TestResult{Pass: true},
+				},
+				3: {
+					Name:          "grandchild",
+					Parent:        2,
+					SummaryResult: libhive.TestResult{Pass: true},
+				},
+				4: {
+					Name:          "failing child",
+					Parent:        1,
+					SummaryResult: libhive.TestResult{Details: "failed\n"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Fatal("wrong results reported:", spew.Sdump(results))
+	}
+}
+
+// This test verifies that measurements are stored in the test case, and that
+// invalid measurements fail the test.
+func TestMeasurements(t *testing.T) {
+	suite := Suite{Name: "measurements"}
+	suite.Add(TestSpec{
+		Name: "measuring test",
+		Run: func(t *T) {
+			t.Measure("sync time", 10, "s")
+			t.Measure("peers", 3, "")
+			t.Measure("sync time", 12.5, "s")
+		},
+	})
+	suite.Add(TestSpec{
+		Name: "invalid measurement",
+		Run: func(t *T) {
+			t.Measure("rate", math.Inf(1), "blocks/s")
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+
+	tm.Terminate()
+	results := tm.Results()
+	removeTimestamps(results)
+
+	wantResults := map[libhive.TestSuiteID]*libhive.TestSuite{
+		0: {
+			ID:             0,
+			Name:           suite.Name,
+			ClientVersions: make(map[string]string),
+			TestCases: map[libhive.TestID]*libhive.TestCase{
+				1: {
+					Name:          "measuring test",
+					SummaryResult: libhive.TestResult{Pass: true},
+					Measurements: []simapi.Measurement{
+						{Name: "sync time", Value: 12.5, Unit: "s"},
+						{Name: "peers", Value: 3},
+					},
+				},
+				2: {
+					Name:          "invalid measurement",
+					SummaryResult: libhive.TestResult{Details: "can't record measurement rate: invalid value +Inf\n"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Fatal("wrong results reported:", spew.Sdump(results))
+	}
+}
+
+// This test checks that the measurements of a failed attempt are stored with the
+// attempt, and don't appear in the result of the retried test.
+func TestMeasurementsRetry(t *testing.T) {
+	attempt := 0
+	suite := Suite{Name: "measurements"}
+	suite.Add(TestSpec{
+		Name: "retried test",
+		Run: func(t *T) {
+			attempt++
+			if attempt == 1 {
+				t.Measure("sync time", 100, "s")
+				t.Measure("peers", 1, "")
+				t.Fatal("sync too slow")
+			}
+			t.Measure("sync time", 10, "s")
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetRetries(1)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	test := tm.Results()[0].TestCases[1]
+	want := []simapi.Measurement{{Name: "sync time", Value: 10, Unit: "s"}}
+	if !reflect.DeepEqual(test.Measurements, want) {
+		t.Errorf("wrong measurements: %s", spew.Sdump(test.Measurements))
+	}
+	if len(test.Attempts) != 1 {
+		t.Fatalf("wrong number of attempts %d", len(test.Attempts))
+	}
+	wantAttempt := []simapi.Measurement{{Name: "sync time", Value: 100, Unit: "s"}, {Name: "peers", Value: 1}}
+	if !reflect.DeepEqual(test.Attempts[0].Measurements, wantAttempt) {
+		t.Errorf("wrong measurements of attempt: %s", spew.Sdump(test.Attempts[0].Measurements))
+	}
+}
+
+// This test checks that the subtests of a failed attempt are stored with the attempt,
+// and only the subtests of the last attempt are listed in the suite.
+func TestSubtestsRetry(t *testing.T) {
+	attempt := 0
+	suite := Suite{Name: "subtests"}
+	suite.Add(TestSpec{
+		Name: "parent",
+		Run: func(t *T) {
+			attempt++
+			t.Run(TestSpec{
+				Name: "child",
+				Run: func(t *T) {
+					if attempt == 1 {
+						t.Fatal("failed")
+					}
+				},
+			})
+			if attempt == 1 {
+				t.Fatal("parent failed")
+			}
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetRetries(1)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	tests := tm.Results()[0].TestCases
+	if len(tests) != 2 {
+		t.Fatalf("wrong number of test cases: %s", spew.Sdump(tests))
+	}
+	parent := tests[1]
+	if !parent.SummaryResult.Pass || !parent.SummaryResult.Flaky {
+		t.Errorf("parent test not flaky: %+v", parent.SummaryResult)
+	}
+	for id, test := range tests {
+		if id != 1 && (test.Parent != 1 || !test.SummaryResult.Pass) {
+			t.Errorf("wrong subtest %d in suite: %s", id, spew.Sdump(test))
+		}
+	}
+	if len(parent.Attempts) != 1 {
+		t.Fatalf("wrong number of attempts %d", len(parent.Attempts))
+	}
+	subtests := parent.Attempts[0].Subtests
+	if len(subtests) != 1 {
+		t.Fatalf("wrong subtests of attempt: %s", spew.Sdump(subtests))
+	}
+	for _, test := range subtests {
+		if test.Name != "child" || test.SummaryResult.Pass {
+			t.Errorf("wrong subtest of attempt: %s", spew.Sdump(test))
+		}
+	}
+}
+
+// This test verifies that parallel tests run after the sequential tests of the suite,
+// and that the number of running parallel tests is limited.
+func TestParallel(t *testing.T) {
+	var (
+		mu               sync.Mutex
+		events           []string
+		running, maxSeen int
+	)
+	record := func(ev string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, ev)
+	}
+	parallelTest := func(name string) TestSpec {
+		return TestSpec{
+			Name: name,
+			Run: func(t *T) {
+				t.Parallel()
+				mu.Lock()
+				running++
+				maxSeen = max(maxSeen, running)
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				record(name)
+			},
+		}
+	}
+
+	suite := Suite{Name: "parallel"}
+	suite.Add(parallelTest("p1"))
+	suite.Add(parallelTest("p2"))
+	suite.Add(TestSpec{Name: "seq", Run: func(t *T) { record("seq") }})
+	suite.Add(parallelTest("p3"))
+	suite.Add(parallelTest("p4"))
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetParallelism(2)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	if len(events) != 5 || events[0] != "seq" {
+		t.Errorf("wrong test order: %v", events)
+	}
+	if maxSeen != 2 {
+		t.Errorf("wrong max number of parallel tests: %d", maxSeen)
+	}
+	for _, test := range tm.Results()[0].TestCases {
+		if !test.SummaryResult.Pass {
+			t.Errorf("test %q failed", test.Name)
+		}
+	}
+}
+
+// This test verifies that a test ends after its parallel subtests.
+func TestParallelSubtests(t *testing.T) {
+	suite := Suite{Name: "parallel"}
+	suite.Add(TestSpec{
+		Name: "parent",
+		Run: func(t *T) {
+			for _, name := range []string{"sub1", "sub2"} {
+				t.Run(TestSpec{
+					Name: name,
+					Run: func(t *T) {
+						t.Parallel()
+						time.Sleep(20 * time.Millisecond)
+					},
+				})
+			}
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetParallelism(2)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	tests := make(map[string]*libhive.TestCase)
+	for _, test := range tm.Results()[0].TestCases {
+		tests[test.Name] = test
+	}
+	parent := tests["parent"]
+	for _, name := range []string{"sub1", "sub2"} {
+		sub := tests[name]
+		if sub == nil {
+			t.Fatalf("subtest %q missing", name)
+		}
+		if sub.End.After(parent.End) {
+			t.Errorf("subtest %q ended after parent", name)
+		}
+	}
+}
+
+// This test verifies that tests exceeding their time limit are ended, and that
+// time spent in subtests doesn't count.
+func TestTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+
+	suite := Suite{Name: "timeout"}
+	suite.Add(TestSpec{
+		Name:    "hanging test",
+		Timeout: 50 * time.Millisecond,
+		Run: func(t *T) {
+			t.Log("waiting")
+			<-hang
+		},
+	})
+	suite.Add(TestSpec{
+		Name: "parent test",
+		Run: func(t *T) {
+			t.Run(TestSpec{
+				Name: "slow subtest",
+				Run: func(t *T) {
+					time.Sleep(200 * time.Millisecond)
+				},
+			})
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetTestTimeout(100 * time.Millisecond)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+
+	tm.Terminate()
+	results := tm.Results()
+	removeTimestamps(results)
+
+	wantResults := map[libhive.TestSuiteID]*libhive.TestSuite{
+		0: {
+			ID:             0,
+			Name:           suite.Name,
+			ClientVersions: make(map[string]string),
+			TestCases: map[libhive.TestID]*libhive.TestCase{
+				1: {
+					Name:          "hanging test",
+					SummaryResult: libhive.TestResult{Timeout: true, Details: "waiting\ntest timed out after 50ms\n"},
+				},
+				2: {
+					Name:          "parent test",
+					SummaryResult: libhive.TestResult{Details: "1 of 1 subtests failed:\n  slow subtest\n"},
+				},
+				3: {
+					Name:          "slow subtest",
+					Parent:        2,
+					SummaryResult: libhive.TestResult{Timeout: true, Details: "test timed out after 100ms\n"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Fatal("wrong results reported:", spew.Sdump(results))
+	}
+}
+
+// This test checks that a test function which keeps running after its attempt timed out
+// can't affect the next attempt, and that subtests of a timed out test are ended.
+func TestTimeoutIsolation(t *testing.T) {
+	var (
+		hang      = make(chan struct{})
+		release   = make(chan struct{})
+		lateDone  = make(chan struct{})
+		attemptMu sync.Mutex
+		attempts  int
+	)
+	defer close(hang)
+
+	suite := Suite{Name: "timeout"}
+	suite.Add(TestSpec{
+		Name:    "retried test",
+		Timeout: 50 * time.Millisecond,
+		Run: func(t *T) {
+			attemptMu.Lock()
+			attempts++
+			n := attempts
+			attemptMu.Unlock()
+			if n == 2 {
+				// Let the first attempt continue, and wait until it's done.
+				close(release)
+				<-lateDone
+				return
+			}
+			<-release
+			t.Log("late output")
+			t.Run(TestSpec{Name: "late subtest", Run: func(t *T) {}})
+			close(lateDone)
+			t.Fail()
+		},
+	})
+	suite.Add(TestSpec{
+		Name:    "parent test",
+		Timeout: 50 * time.Millisecond,
+		Run: func(t *T) {
+			t.Run(TestSpec{
+				Name: "parallel subtest",
+				Run: func(t *T) {
+					t.Parallel()
+					<-hang
+				},
+			})
+			<-hang
+		},
+	})
+
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetRetries(1)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	tm.Terminate()
+
+	tests := make(map[string]*libhive.TestCase)
+	for _, s := range tm.Results() {
+		for _, test := range s.TestCases {
+			tests[test.Name] = test
+		}
+	}
+	if _, ok := tests["late subtest"]; ok {
+		t.Error("subtest of timed out attempt was started")
+	}
+	if test := tests["retried test"]; test == nil || !test.SummaryResult.Pass || test.SummaryResult.Details != "" {
+		t.Errorf("wrong result of retried test: %s", spew.Sdump(test))
+	}
+	sub := tests["parallel subtest"]
+	if sub == nil || sub.SummaryResult.Pass || !strings.Contains(sub.SummaryResult.Details, "parent test ended") {
+		t.Errorf("wrong result of parallel subtest: %s", spew.Sdump(sub))
+	}
+}
+
 var testPatternTests = []struct {
 	Pattern string
 	WantRun []string
@@ -154,3 +760,94 @@ func TestSkipping(t *testing.T) {
 		}
 	}
 }
+
+// This test verifies that sharding splits the tests of a simulation, and that
+// subtests run in the shard of their parent test.
+func TestSharding(t *testing.T) {
+	suite := Suite{Name: "suite"}
+	for i := range 10 {
+		suite.Add(TestSpec{Name: fmt.Sprintf("test-%d", i), Run: func(t *T) {}})
+	}
+	suite.Add(TestSpec{Name: "always", AlwaysRun: true, Run: func(t *T) {
+		for i := range 10 {
+			t.Run(TestSpec{Name: fmt.Sprintf("sub-%d", i), Run: func(t *T) {}})
+		}
+	}})
+	suite.Add(TestSpec{Name: "parent", Run: func(t *T) {
+		for i := range 10 {
+			t.Run(TestSpec{Name: fmt.Sprintf("child-%d", i), Run: func(t *T) {}})
+		}
+	}})
+
+	const shards = 3
+	runCount := make(map[string]int)
+	for i := 1; i <= shards; i++ {
+		tm, srv := newFakeAPI(nil)
+		sim := NewAt(srv.URL)
+		sim.SetShard(fmt.Sprintf("%d/%d", i, shards))
+		if err := RunSuite(sim, suite); err != nil {
+			t.Fatal("run failed:", err)
+		}
+		srv.Close()
+		tm.Terminate()
+
+		for _, s := range tm.Results() {
+			for _, test := range s.TestCases {
+				runCount[test.Name]++
+			}
+		}
+	}
+
+	if runCount["always"] != shards {
+		t.Errorf("AlwaysRun test ran %d times, want %d", runCount["always"], shards)
+	}
+	// The other tests must run exactly once. Subtests of "parent" only run in the
+	// shard of their parent, so they would be missing if they were sharded again.
+	delete(runCount, "always")
+	if len(runCount) != 31 {
+		t.Errorf("wrong number of tests run: %d, want 31", len(runCount))
+	}
+	for name, n := range runCount {
+		if n != 1 {
+			t.Errorf("test %q ran in %d shards", name, n)
+		}
+	}
+}
+
+// This test checks that client tests only run for clients with the required
+// capabilities.
+func TestClientCapabilities(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	suite := Suite{Name: "suite"}
+	suite.Add(ClientTestSpec{Name: "snap-CLIENT", Capabilities: []string{"protocol:snap"}, Run: func(t *T, c *Client) {}})
+	suite.Add(ClientTestSpec{Name: "prague-CLIENT", Capabilities: []string{"fork:Prague", "api:engine/v3"}, Run: func(t *T, c *Client) {}})
+	suite.Add(ClientTestSpec{Name: "graphql-CLIENT", Capabilities: []string{"api:graphql"}, Run: func(t *T, c *Client) {}})
+	suite.Add(ClientTestSpec{Name: "any-CLIENT", Run: func(t *T, c *Client) {}})
+
+	sim := NewAt(srv.URL)
+	if err := RunSuite(sim, suite); err != nil {
+		t.Fatal("run failed:", err)
+	}
+
+	var names []string
+	for _, s := range tm.Results() {
+		for _, test := range s.TestCases {
+			names = append(names, test.Name)
+		}
+	}
+	sort.Strings(names)
+	want := []string{"any-client-1", "any-client-2", "prague-client-1", "snap-client-1"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("wrong tests run: %q, want %q", names, want)
+	}
+
+	// Invalid capabilities are rejected.
+	bad := Suite{Name: "bad"}
+	bad.Add(ClientTestSpec{Name: "bad", Capabilities: []string{"Prague"}, Run: func(t *T, c *Client) {}})
+	if err := RunSuite(sim, bad); err == nil {
+		t.Fatal("expected error for invalid capability")
+	}
+}
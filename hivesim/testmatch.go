@@ -1,7 +1,10 @@
 package hivesim
 
 import (
+	"fmt"
+	"hash/fnv"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -75,3 +78,38 @@ func splitRegexp(s string) []string {
 	}
 	return append(a, s)
 }
+
+// testShard selects the tests of one shard, when the tests of a simulator are split
+// across multiple hive runs. Tests are assigned to shards by a hash of their suite and
+// test name, so every run assigns them in the same way.
+type testShard struct {
+	index int // 1-based
+	count int // zero when the tests aren't sharded
+	spec  string
+}
+
+// parseTestShard parses a shard specification of the form "i/n".
+func parseTestShard(s string) (testShard, error) {
+	index, count, ok := strings.Cut(s, "/")
+	if !ok {
+		return testShard{}, fmt.Errorf("invalid shard %q, want i/n", s)
+	}
+	i, err1 := strconv.Atoi(index)
+	n, err2 := strconv.Atoi(count)
+	if err1 != nil || err2 != nil || n < 1 || i < 1 || i > n {
+		return testShard{}, fmt.Errorf("invalid shard %q, want i/n with 1 <= i <= n", s)
+	}
+	return testShard{index: i, count: n, spec: s}, nil
+}
+
+// match reports whether the test belongs to the shard.
+func (sh *testShard) match(suite, test string) bool {
+	if sh.count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(suite))
+	h.Write([]byte{0})
+	h.Write([]byte(test))
+	return int(h.Sum32()%uint32(sh.count)) == sh.index-1
+}
@@ -1,6 +1,7 @@
 package hivesim
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -23,3 +24,40 @@ func TestMatch(t *testing.T) {
 		t.Fatal("expected no match")
 	}
 }
+
+func TestShard(t *testing.T) {
+	for _, s := range []string{"", "1", "0/2", "3/2", "1/0", "a/b"} {
+		if _, err := parseTestShard(s); err == nil {
+			t.Errorf("no error for invalid shard %q", s)
+		}
+	}
+
+	// Every test must be in exactly one shard.
+	var shards []testShard
+	for i := 1; i <= 4; i++ {
+		sh, err := parseTestShard(fmt.Sprintf("%d/4", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, sh)
+	}
+	sizes := make([]int, len(shards))
+	for i := range 100 {
+		name := fmt.Sprintf("test-%d", i)
+		var n int
+		for j := range shards {
+			if shards[j].match("suite", name) {
+				sizes[j]++
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("test %s is in %d shards", name, n)
+		}
+	}
+	for i, size := range sizes {
+		if size == 0 {
+			t.Errorf("shard %d is empty", i+1)
+		}
+	}
+}
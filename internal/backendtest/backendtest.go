@@ -0,0 +1,247 @@
+// Package backendtest contains a conformance test for container backends which run
+// containers on a real container engine. The test exercises the backend operations used
+// by the simulation API, so each backend can be checked against the same expectations.
+package backendtest
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+const imageTag = "hive/backendtest"
+
+// imageSource is the build context of the test image. The image runs an HTTP server,
+// which serves the files in /www.
+var imageSource = fstest.MapFS{
+	"Dockerfile": {Data: []byte(`FROM busybox
+RUN mkdir -p /www
+CMD ["httpd", "-f", "-p", "8080", "-h", "/www"]
+`)},
+}
+
+// Run runs the conformance test against the given builder and backend.
+func Run(t *testing.T, builder libhive.Builder, backend libhive.ContainerBackend) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	backend.SetHiveInstanceInfo("backendtest", "")
+	if err := backend.Build(ctx, builder); err != nil {
+		t.Fatal("can't build helper images:", err)
+	}
+	if err := builder.BuildImage(ctx, imageTag, imageSource); err != nil {
+		t.Fatal("can't build test image:", err)
+	}
+	srv, err := backend.ServeAPI(ctx, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal("can't start API server:", err)
+	}
+	defer srv.Close()
+
+	t.Run("Container", func(t *testing.T) { testContainer(ctx, t, backend) })
+	t.Run("Network", func(t *testing.T) { testNetwork(ctx, t, backend) })
+	t.Run("Snapshot", func(t *testing.T) { testSnapshot(ctx, t, backend) })
+}
+
+// testContainer checks the container lifecycle, file upload and download,
+// running programs in the container and pausing.
+func testContainer(ctx context.Context, t *testing.T, backend libhive.ContainerBackend) {
+	opt := libhive.ContainerOptions{
+		Env:       map[string]string{"HIVE_TEST": "1"},
+		Files:     formFiles(t, map[string]string{"/www/index.html": "hello"}),
+		CheckLive: 8080,
+	}
+	id, info := startContainer(ctx, t, backend, opt)
+	if info.IP == "" {
+		t.Fatal("container has no IP address")
+	}
+
+	// Uploaded files and environment variables are visible to programs.
+	exec, err := backend.RunProgram(ctx, id, []string{"sh", "-c", "cat /www/index.html; echo $HIVE_TEST"})
+	if err != nil {
+		t.Fatal("RunProgram failed:", err)
+	}
+	if exec.ExitCode != 0 || exec.Stdout != "hello1\n" {
+		t.Fatalf("wrong program result: %+v", exec)
+	}
+	exec, err = backend.RunProgram(ctx, id, []string{"sh", "-c", "exit 3"})
+	if err != nil {
+		t.Fatal("RunProgram failed:", err)
+	}
+	if exec.ExitCode != 3 {
+		t.Fatalf("wrong exit code %d, want 3", exec.ExitCode)
+	}
+
+	// Files can be downloaded from the container.
+	content := downloadFile(ctx, t, backend, id, "/www/index.html")
+	if content != "hello" {
+		t.Fatalf("wrong downloaded file content %q", content)
+	}
+
+	// The container keeps working after it was paused.
+	if err := backend.PauseContainer(id); err != nil {
+		t.Fatal("PauseContainer failed:", err)
+	}
+	if err := backend.UnpauseContainer(id); err != nil {
+		t.Fatal("UnpauseContainer failed:", err)
+	}
+	if _, err := backend.RunProgram(ctx, id, []string{"true"}); err != nil {
+		t.Fatal("RunProgram failed after unpausing:", err)
+	}
+
+	// Files can still be downloaded after the container was stopped.
+	if err := backend.StopContainer(id); err != nil {
+		t.Fatal("StopContainer failed:", err)
+	}
+	info.Wait()
+	if content := downloadFile(ctx, t, backend, id, "/www/index.html"); content != "hello" {
+		t.Fatalf("wrong file content %q after stopping container", content)
+	}
+	if err := backend.DeleteContainer(id); err != nil {
+		t.Fatal("DeleteContainer failed:", err)
+	}
+}
+
+// testNetwork checks that containers can be connected to networks.
+func testNetwork(ctx context.Context, t *testing.T, backend libhive.ContainerBackend) {
+	id, _ := startContainer(ctx, t, backend, libhive.ContainerOptions{})
+
+	bridgeID, err := backend.NetworkNameToID("bridge")
+	if err != nil {
+		t.Fatal("can't find default network:", err)
+	}
+	if ip, err := backend.ContainerIP(id, bridgeID); err != nil || ip == nil {
+		t.Fatalf("container has no IP in default network: %v, %v", ip, err)
+	}
+
+	name := fmt.Sprintf("hive-backendtest-%d", time.Now().UnixNano())
+	networkID, err := backend.CreateNetwork(name)
+	if err != nil {
+		t.Fatal("CreateNetwork failed:", err)
+	}
+	defer backend.RemoveNetwork(networkID)
+	if found, err := backend.NetworkNameToID(name); err != nil || found != networkID {
+		t.Fatalf("wrong network ID %q (err %v), want %q", found, err, networkID)
+	}
+
+	if err := backend.ConnectContainer(id, networkID); err != nil {
+		t.Fatal("ConnectContainer failed:", err)
+	}
+	if ip, err := backend.ContainerIP(id, networkID); err != nil || ip == nil {
+		t.Fatalf("container has no IP in network: %v, %v", ip, err)
+	}
+	if err := backend.DisconnectContainer(id, networkID); err != nil {
+		t.Fatal("DisconnectContainer failed:", err)
+	}
+	if _, err := backend.ContainerIP(id, networkID); err == nil {
+		t.Fatal("container still has IP after disconnecting")
+	}
+
+	if err := backend.RemoveNetwork(networkID); err != nil {
+		t.Fatal("RemoveNetwork failed:", err)
+	}
+	if _, err := backend.NetworkNameToID(name); err != libhive.ErrNetworkNotFound {
+		t.Fatal("wrong error for removed network:", err)
+	}
+}
+
+// testSnapshot checks that containers can be started from a snapshot.
+func testSnapshot(ctx context.Context, t *testing.T, backend libhive.ContainerBackend) {
+	id, _ := startContainer(ctx, t, backend, libhive.ContainerOptions{})
+	if _, err := backend.RunProgram(ctx, id, []string{"sh", "-c", "echo saved > /www/state"}); err != nil {
+		t.Fatal("RunProgram failed:", err)
+	}
+	image, err := backend.SnapshotContainer(ctx, id, "backendtest", nil)
+	if err != nil {
+		t.Fatal("SnapshotContainer failed:", err)
+	}
+	defer backend.DeleteSnapshot(image)
+
+	snapID, _ := startContainerFrom(ctx, t, backend, image, libhive.ContainerOptions{})
+	if content := downloadFile(ctx, t, backend, snapID, "/www/state"); content != "saved\n" {
+		t.Fatalf("wrong file content in snapshot %q", content)
+	}
+}
+
+func startContainer(ctx context.Context, t *testing.T, backend libhive.ContainerBackend, opt libhive.ContainerOptions) (string, *libhive.ContainerInfo) {
+	return startContainerFrom(ctx, t, backend, imageTag, opt)
+}
+
+// startContainerFrom creates and starts a container. The container is removed
+// when the test ends.
+func startContainerFrom(ctx context.Context, t *testing.T, backend libhive.ContainerBackend, image string, opt libhive.ContainerOptions) (string, *libhive.ContainerInfo) {
+	t.Helper()
+	id, err := backend.CreateContainer(ctx, image, opt)
+	if err != nil {
+		t.Fatal("CreateContainer failed:", err)
+	}
+	info, err := backend.StartContainer(ctx, id, opt)
+	if err != nil {
+		t.Fatal("StartContainer failed:", err)
+	}
+	t.Cleanup(func() {
+		backend.DeleteContainer(id)
+		info.Wait()
+	})
+	return id, info
+}
+
+// downloadFile returns the content of a single file in a container.
+func downloadFile(ctx context.Context, t *testing.T, backend libhive.ContainerBackend, containerID, path string) string {
+	t.Helper()
+	rc, err := backend.DownloadFiles(ctx, containerID, path)
+	if err != nil {
+		t.Fatal("DownloadFiles failed:", err)
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal("can't read downloaded archive:", err)
+	}
+	if want := path[strings.LastIndex(path, "/")+1:]; hdr.Name != want {
+		t.Fatalf("wrong file name %q in archive, want %q", hdr.Name, want)
+	}
+	content, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatal("can't read downloaded file:", err)
+	}
+	return string(content)
+}
+
+// formFiles creates the file headers of a multipart form containing the given files,
+// like the simulation API receives them.
+func formFiles(t *testing.T, files map[string]string) map[string]*multipart.FileHeader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, content := range files {
+		fw, err := w.CreateFormFile(name, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, content)
+	}
+	w.Close()
+
+	form, err := multipart.NewReader(&buf, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal("can't read form:", err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	result := make(map[string]*multipart.FileHeader, len(form.File))
+	for name, headers := range form.File {
+		result[name] = headers[0]
+	}
+	return result
+}
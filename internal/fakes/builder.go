@@ -11,7 +11,9 @@ import (
 type BuilderHooks struct {
 	BuildClientImage    func(context.Context, libhive.ClientDesignator) (string, error)
 	BuildSimulatorImage func(context.Context, string, map[string]string) (string, error)
+	BuildImage          func(ctx context.Context, name string, fsys fs.FS) error
 	ReadFile            func(ctx context.Context, image string, file string) ([]byte, error)
+	ImageID             func(ctx context.Context, image string) (string, error)
 }
 
 // fakeBuilder implements Backend without docker.
@@ -43,6 +45,9 @@ func (b *fakeBuilder) BuildSimulatorImage(ctx context.Context, sim string, build
 }
 
 func (b *fakeBuilder) BuildImage(ctx context.Context, name string, fsys fs.FS) error {
+	if b.hooks.BuildImage != nil {
+		return b.hooks.BuildImage(ctx, name, fsys)
+	}
 	return nil
 }
 
@@ -52,3 +57,10 @@ func (b *fakeBuilder) ReadFile(ctx context.Context, image, file string) ([]byte,
 	}
 	return []byte{}, nil
 }
+
+func (b *fakeBuilder) ImageID(ctx context.Context, image string) (string, error) {
+	if b.hooks.ImageID != nil {
+		return b.hooks.ImageID(ctx, image)
+	}
+	return "sha256:" + image, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"sync"
@@ -14,12 +15,18 @@ import (
 
 // BackendHooks can be used to override the behavior of the fake backend.
 type BackendHooks struct {
-	CreateContainer  func(image string, opt libhive.ContainerOptions) (string, error)
-	StartContainer   func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error)
-	DeleteContainer  func(containerID string) error
-	PauseContainer   func(containerID string) error
-	UnpauseContainer func(containerID string) error
-	RunProgram       func(containerID string, cmd []string) (*libhive.ExecInfo, error)
+	CreateContainer   func(image string, opt libhive.ContainerOptions) (string, error)
+	StartContainer    func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error)
+	StopContainer     func(containerID string) error
+	DeleteContainer   func(containerID string) error
+	PauseContainer    func(containerID string) error
+	UnpauseContainer  func(containerID string) error
+	SnapshotContainer func(containerID, name string, labels map[string]string) (string, error)
+	DeleteSnapshot    func(image string) error
+	DownloadFiles     func(containerID, path string) (io.ReadCloser, error)
+	RunProgram        func(containerID string, cmd []string) (*libhive.ExecInfo, error)
+	RunNetworkScript  func(containerID string, script string) (*libhive.ExecInfo, error)
+	DialContainer     func(addr string) (net.Conn, error)
 
 	NetworkNameToID     func(string) (string, error)
 	CreateNetwork       func(string) (string, error)
@@ -37,8 +44,9 @@ type fakeBackend struct {
 	clientCounter uint64
 	netCounter    uint64
 
-	mutex sync.Mutex
-	cimg  map[string]string // tracks created containers and their image names
+	mutex   sync.Mutex
+	cimg    map[string]string        // tracks created containers and their image names
+	running map[string]chan struct{} // closed when a container is deleted
 }
 
 type apiServer struct {
@@ -56,7 +64,7 @@ func (s apiServer) Addr() net.Addr {
 
 // NewBackend creates a new fake container backend.
 func NewContainerBackend(hooks *BackendHooks) libhive.ContainerBackend {
-	b := &fakeBackend{cimg: make(map[string]string)}
+	b := &fakeBackend{cimg: make(map[string]string), running: make(map[string]chan struct{})}
 	if hooks != nil {
 		b.hooks = *hooks
 	}
@@ -127,9 +135,18 @@ func (b *fakeBackend) StartContainer(ctx context.Context, containerID string, op
 		}
 		info = *info2
 		info.ID = containerID
-		if info.Wait == nil {
-			info.Wait = func() {}
-		}
+	}
+	switch {
+	case info.Wait != nil:
+	case opt.Labels[libhive.LabelHiveType] == libhive.ContainerTypeClient:
+		// By default, clients run until they are deleted.
+		running := make(chan struct{})
+		b.mutex.Lock()
+		b.running[containerID] = running
+		b.mutex.Unlock()
+		info.Wait = func() { <-running }
+	default:
+		info.Wait = func() {}
 	}
 
 	info.ID = containerID
@@ -140,10 +157,24 @@ func (b *fakeBackend) StartContainer(ctx context.Context, containerID string, op
 	if info.MAC == "" {
 		info.MAC = "00:80:41:ae:fd:7e"
 	}
-	info.Wait = func() {}
 	return &info, nil
 }
 
+func (b *fakeBackend) StopContainer(containerID string) error {
+	var err error
+	if b.hooks.StopContainer != nil {
+		err = b.hooks.StopContainer(containerID)
+	}
+
+	b.mutex.Lock()
+	if running, ok := b.running[containerID]; ok {
+		close(running)
+		delete(b.running, containerID)
+	}
+	b.mutex.Unlock()
+	return err
+}
+
 func (b *fakeBackend) DeleteContainer(containerID string) error {
 	var err error
 	if b.hooks.DeleteContainer != nil {
@@ -152,6 +183,10 @@ func (b *fakeBackend) DeleteContainer(containerID string) error {
 
 	b.mutex.Lock()
 	delete(b.cimg, containerID)
+	if running, ok := b.running[containerID]; ok {
+		close(running)
+		delete(b.running, containerID)
+	}
 	b.mutex.Unlock()
 	return err
 }
@@ -170,6 +205,20 @@ func (b *fakeBackend) UnpauseContainer(containerID string) error {
 	return nil
 }
 
+func (b *fakeBackend) SnapshotContainer(ctx context.Context, containerID, name string, labels map[string]string) (string, error) {
+	if b.hooks.SnapshotContainer != nil {
+		return b.hooks.SnapshotContainer(containerID, name, labels)
+	}
+	return "snapshot:" + name, nil
+}
+
+func (b *fakeBackend) DeleteSnapshot(image string) error {
+	if b.hooks.DeleteSnapshot != nil {
+		return b.hooks.DeleteSnapshot(image)
+	}
+	return nil
+}
+
 func (b *fakeBackend) RunProgram(ctx context.Context, containerID string, cmd []string) (*libhive.ExecInfo, error) {
 	if b.hooks.RunProgram != nil {
 		return b.hooks.RunProgram(containerID, cmd)
@@ -177,6 +226,32 @@ func (b *fakeBackend) RunProgram(ctx context.Context, containerID string, cmd []
 	return &libhive.ExecInfo{Stdout: "std output", Stderr: "std err", ExitCode: 0}, nil
 }
 
+func (b *fakeBackend) ShellCommand(containerID string) string {
+	return "fake-shell " + containerID
+}
+
+func (b *fakeBackend) DownloadFiles(ctx context.Context, containerID string, path string) (io.ReadCloser, error) {
+	if b.hooks.DownloadFiles != nil {
+		return b.hooks.DownloadFiles(containerID, path)
+	}
+	return nil, fmt.Errorf("no such file: %s", path)
+}
+
+func (b *fakeBackend) RunNetworkScript(ctx context.Context, containerID string, script string, labels map[string]string) (*libhive.ExecInfo, error) {
+	if b.hooks.RunNetworkScript != nil {
+		return b.hooks.RunNetworkScript(containerID, script)
+	}
+	return &libhive.ExecInfo{ExitCode: 0}, nil
+}
+
+func (b *fakeBackend) DialContainer(ctx context.Context, addr string) (net.Conn, error) {
+	if b.hooks.DialContainer != nil {
+		return b.hooks.DialContainer(addr)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
 func (b *fakeBackend) NetworkNameToID(name string) (string, error) {
 	if b.hooks.NetworkNameToID != nil {
 		return b.hooks.NetworkNameToID(name)
@@ -42,7 +42,7 @@ func NewBuilder(client *docker.Client, cfg *Config, auth *docker.AuthConfigurati
 // BuildClientImage builds a docker image of the given client.
 func (b *Builder) BuildClientImage(ctx context.Context, client libhive.ClientDesignator) (string, error) {
 	dir := b.config.Inventory.ClientDirectory(client)
-	tag := fmt.Sprintf("hive/clients/%s:latest", client.Name())
+	tag := client.ImageTag()
 	dockerFile := client.Dockerfile()
 	err := b.buildImage(ctx, dir, dockerFile, tag, client.BuildArgs)
 	return tag, err
@@ -81,7 +81,7 @@ func (b *Builder) BuildImage(ctx context.Context, name string, fsys fs.FS) error
 
 	b.logger.Info("building image", "image", name, "nocache", opts.NoCache, "pull", b.config.PullEnabled)
 	if err := b.client.BuildImage(opts); err != nil {
-		if imageAlreadyExists(err) {
+		if ImageAlreadyExists(err) {
 			b.logger.Info("image already exists", "image", name)
 		} else {
 			b.logger.Error("image build failed", "image", name, "err", err)
@@ -91,10 +91,10 @@ func (b *Builder) BuildImage(ctx context.Context, name string, fsys fs.FS) error
 	return nil
 }
 
-// imageAlreadyExists reports whether a build failed only because a concurrent
+// ImageAlreadyExists reports whether a build failed only because a concurrent
 // hive process already produced the identical image, a benign cross-process
 // race when multiple simulations share one Docker daemon.
-func imageAlreadyExists(err error) bool {
+func ImageAlreadyExists(err error) bool {
 	ok, _ := regexp.MatchString("\\bAlreadyExists: ", err.Error())
 	return ok
 }
@@ -221,6 +221,17 @@ func (b *Builder) ReadFile(ctx context.Context, image, path string) ([]byte, err
 	}
 }
 
+// ImageID returns the ID of a local image.
+func (b *Builder) ImageID(ctx context.Context, image string) (string, error) {
+	img, err := b.client.InspectImage(image)
+	if err == docker.ErrNoSuchImage {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return img.ID, nil
+}
+
 // buildImage builds a single docker image from the specified context.
 // branch specifies a build argument to use a specific base image branch or github source branch.
 func (b *Builder) buildImage(ctx context.Context, contextDir, dockerFile, imageTag string, buildArgs map[string]string) error {
@@ -251,6 +262,42 @@ func (b *Builder) buildImage(ctx context.Context, contextDir, dockerFile, imageT
 	return nil
 }
 
+// PushImage tags a local image into the given registry and pushes it there.
+func (b *Builder) PushImage(ctx context.Context, image, registry string) error {
+	repo, tag, ok := strings.Cut(image, ":")
+	if !ok {
+		tag = "latest"
+	}
+	target := registry + "/" + repo
+	logger := b.logger.With("image", image, "target", target+":"+tag)
+
+	opts := docker.TagImageOptions{Context: ctx, Repo: target, Tag: tag, Force: true}
+	if err := b.client.TagImage(image, opts); err != nil {
+		logger.Error("image tagging failed", "err", err)
+		return err
+	}
+	var auth docker.AuthConfiguration
+	if b.authenticator != nil {
+		host, _, _ := strings.Cut(registry, "/")
+		auth = b.authenticator.Configs[host]
+	}
+	push := docker.PushImageOptions{
+		Context:      ctx,
+		Name:         target,
+		Tag:          tag,
+		OutputStream: io.Discard,
+	}
+	if b.config.BuildOutput != nil {
+		push.OutputStream = b.config.BuildOutput
+	}
+	logger.Info("pushing image")
+	if err := b.client.PushImage(push, auth); err != nil {
+		logger.Error("image push failed", "err", err)
+		return err
+	}
+	return nil
+}
+
 func convertBuildArgs(m map[string]string) []docker.BuildArg {
 	args := make([]docker.BuildArg, 0, len(m))
 	for key, value := range m {
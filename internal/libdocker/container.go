@@ -15,17 +15,20 @@ import (
 	"sync"
 	"time"
 
-	"github.com/ethereum/hive/hiveproxy"
 	"github.com/ethereum/hive/internal/libhive"
 	docker "github.com/fsouza/go-dockerclient"
 )
 
+// snapshotRepository is the image repository of client snapshots.
+const snapshotRepository = "hive/snapshot"
+
 type ContainerBackend struct {
 	client *docker.Client
 	config *Config
 	logger *slog.Logger
 
-	proxy *hiveproxy.Proxy
+	// Running API proxies.
+	proxies ProxySet
 
 	// Hive instance information for labeling
 	hiveInstanceID string
@@ -51,6 +54,15 @@ func (b *ContainerBackend) GetDockerClient() interface{} {
 	return b.client
 }
 
+// ShellCommand returns the command for opening a shell in a container.
+func (b *ContainerBackend) ShellCommand(containerID string) string {
+	cli := b.config.CLI
+	if cli == "" {
+		cli = "docker"
+	}
+	return fmt.Sprintf("%s exec -it %s sh", cli, containerID)
+}
+
 // RunProgram runs a /hive-bin script in a container.
 func (b *ContainerBackend) RunProgram(ctx context.Context, containerID string, cmd []string) (*libhive.ExecInfo, error) {
 	exec, err := b.client.CreateExec(docker.CreateExecOptions{
@@ -103,6 +115,8 @@ func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string
 		},
 	}
 
+	createOpts.HostConfig = &docker.HostConfig{NetworkMode: b.config.DefaultNetwork}
+	applyResources(createOpts.HostConfig, opt.Resources)
 	if opt.Input != nil {
 		// Pre-announce that stdin will be attached. The stdin attachment
 		// will fail silently if this is not set.
@@ -132,9 +146,24 @@ func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string
 	return c.ID, err
 }
 
+// exitState returns the exit status of a stopped container.
+// It returns nil if the container does not exist anymore.
+func (b *ContainerBackend) exitState(containerID string) *libhive.ContainerExit {
+	c, err := b.client.InspectContainerWithOptions(docker.InspectContainerOptions{ID: containerID})
+	if err != nil {
+		return nil
+	}
+	return &libhive.ContainerExit{
+		ExitCode:  c.State.ExitCode,
+		OOMKilled: c.State.OOMKilled,
+		Time:      c.State.FinishedAt,
+	}
+}
+
 // StartContainer starts a docker container.
 func (b *ContainerBackend) StartContainer(ctx context.Context, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
-	if opt.CheckLive != 0 && b.proxy == nil {
+	proxy := b.proxies.Live()
+	if opt.CheckLive != 0 && proxy == nil {
 		panic("attempt to start container with CheckLive, but proxy is not running")
 	}
 
@@ -149,18 +178,30 @@ func (b *ContainerBackend) StartContainer(ctx context.Context, containerID strin
 		return nil, fmt.Errorf("container did not start: %v", err)
 	}
 
+	// Collect resource usage while the container is running.
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	stats := b.collectStats(statsCtx, logger, containerID)
+	info.Usage = stats.Usage
+
 	// This goroutine waits for the container to end and closes log
 	// files when done.
 	containerExit := make(chan struct{})
+	var exitState *libhive.ContainerExit
 	go func() {
 		defer close(containerExit)
+		defer stopStats()
 		err := waiter.Wait()
 		logger.Debug("container exited", "err", err)
+		exitState = b.exitState(containerID)
 		err = waiter.Close()
 		logger.Debug("container files closed", "err", err)
 	}()
 	// Set up the wait function.
 	info.Wait = func() { <-containerExit }
+	info.ExitState = func() *libhive.ContainerExit {
+		<-containerExit
+		return exitState
+	}
 
 	// Get the IP. This can only be done after the container has started.
 	inspect := docker.InspectContainerOptions{Context: ctx, ID: containerID}
@@ -205,7 +246,7 @@ func (b *ContainerBackend) StartContainer(ctx context.Context, containerID strin
 		defer cancel()
 		addr := &net.TCPAddr{IP: net.ParseIP(info.IP), Port: int(opt.CheckLive)}
 		go func() {
-			err := b.proxy.CheckLive(ctx, addr)
+			err := proxy.CheckLive(ctx, addr)
 			if err == nil {
 				close(hasStarted)
 			}
@@ -232,6 +273,21 @@ func (b *ContainerBackend) StartContainer(ctx context.Context, containerID strin
 	return info, checkErr
 }
 
+// StopContainer kills the given container. The container is not removed, so its files
+// can still be downloaded.
+func (b *ContainerBackend) StopContainer(containerID string) error {
+	b.logger.Debug("stopping container", "container", containerID[:8])
+	err := b.client.KillContainer(docker.KillContainerOptions{ID: containerID})
+	var notRunning *docker.ContainerNotRunning
+	if errors.As(err, &notRunning) {
+		return nil
+	}
+	if err != nil {
+		b.logger.Error("can't stop container", "container", containerID[:8], "err", err)
+	}
+	return err
+}
+
 // DeleteContainer removes the given container. If the container is running, it is stopped.
 func (b *ContainerBackend) DeleteContainer(containerID string) error {
 	b.logger.Debug("removing container", "container", containerID[:8])
@@ -262,6 +318,31 @@ func (b *ContainerBackend) UnpauseContainer(containerID string) error {
 	return err
 }
 
+// SnapshotContainer commits the given container to an image. The container is paused
+// while the image is created. Note that the content of volumes is not included in the
+// image.
+func (b *ContainerBackend) SnapshotContainer(ctx context.Context, containerID string, name string, labels map[string]string) (string, error) {
+	b.logger.Debug("creating container snapshot", "container", containerID[:8], "name", name)
+	img, err := b.client.CommitContainer(docker.CommitContainerOptions{
+		Context:    ctx,
+		Container:  containerID,
+		Repository: snapshotRepository,
+		Tag:        name,
+		Run:        &docker.Config{Labels: labels},
+	})
+	if err != nil {
+		b.logger.Error("can't create container snapshot", "container", containerID[:8], "err", err)
+		return "", err
+	}
+	return img.ID, nil
+}
+
+// DeleteSnapshot removes a snapshot image.
+func (b *ContainerBackend) DeleteSnapshot(image string) error {
+	b.logger.Debug("removing snapshot image", "image", image)
+	return b.client.RemoveImageExtended(image, docker.RemoveImageOptions{Force: true})
+}
+
 // CreateNetwork creates a docker network.
 func (b *ContainerBackend) CreateNetwork(name string) (string, error) {
 	network, err := b.client.CreateNetwork(docker.CreateNetworkOptions{
@@ -276,6 +357,9 @@ func (b *ContainerBackend) CreateNetwork(name string) (string, error) {
 
 // NetworkNameToID finds the network ID of network by the given name.
 func (b *ContainerBackend) NetworkNameToID(name string) (string, error) {
+	if name == "bridge" && b.config.DefaultNetwork != "" {
+		name = b.config.DefaultNetwork
+	}
 	networks, err := b.client.ListNetworks()
 	if err != nil {
 		return "", err
@@ -334,6 +418,20 @@ func (b *ContainerBackend) DisconnectContainer(containerID, networkID string) er
 	})
 }
 
+// DownloadFiles returns a tar archive of a file or directory in a container.
+func (b *ContainerBackend) DownloadFiles(ctx context.Context, containerID string, path string) (io.ReadCloser, error) {
+	pipeR, pipeW := io.Pipe()
+	go func() {
+		err := b.client.DownloadFromContainer(containerID, docker.DownloadFromContainerOptions{
+			Context:      ctx,
+			Path:         path,
+			OutputStream: pipeW,
+		})
+		pipeW.CloseWithError(err)
+	}()
+	return pipeR, nil
+}
+
 // uploadFiles uploads the given files into a docker container.
 func (b *ContainerBackend) uploadFiles(ctx context.Context, id string, files map[string]*multipart.FileHeader) error {
 	if len(files) == 0 {
@@ -406,7 +504,7 @@ func (b *ContainerBackend) runContainer(ctx context.Context, logger *slog.Logger
 
 		// If console logging is requested, dump stderr there.
 		if b.config.ContainerOutput != nil {
-			prefixer := newLinePrefixWriter(b.config.ContainerOutput, fmt.Sprintf("[%s] ", id[:8]))
+			prefixer := NewLinePrefixWriter(b.config.ContainerOutput, fmt.Sprintf("[%s] ", id[:8]))
 			closer.addFile(prefixer)
 			errStream = prefixer
 
@@ -427,7 +525,7 @@ func (b *ContainerBackend) runContainer(ctx context.Context, logger *slog.Logger
 
 		// If console logging was requested, tee the output and tag it with the container id.
 		if b.config.ContainerOutput != nil {
-			prefixer := newLinePrefixWriter(b.config.ContainerOutput, fmt.Sprintf("[%s] ", id[:8]))
+			prefixer := NewLinePrefixWriter(b.config.ContainerOutput, fmt.Sprintf("[%s] ", id[:8]))
 			closer.addFile(prefixer)
 			outStream = io.MultiWriter(log, prefixer)
 		}
@@ -509,22 +607,22 @@ func (w *fileCloser) closeFiles() {
 	})
 }
 
-// linePrefixWriter wraps a writer, prefixing written lines with a string.
-type linePrefixWriter struct {
+// LinePrefixWriter wraps a writer, prefixing written lines with a string.
+type LinePrefixWriter struct {
 	w      io.Writer
 	prefix string
 	buf    []byte // holds current incomplete line
 }
 
-func newLinePrefixWriter(w io.Writer, prefix string) *linePrefixWriter {
-	return &linePrefixWriter{
+func NewLinePrefixWriter(w io.Writer, prefix string) *LinePrefixWriter {
+	return &LinePrefixWriter{
 		w:      w,
 		prefix: prefix,
 		buf:    []byte(prefix),
 	}
 }
 
-func (w *linePrefixWriter) Write(bytes []byte) (int, error) {
+func (w *LinePrefixWriter) Write(bytes []byte) (int, error) {
 	var err error
 	for _, b := range bytes {
 		if b == '\n' {
@@ -542,7 +640,7 @@ func (w *linePrefixWriter) Write(bytes []byte) (int, error) {
 }
 
 // Close flushes the last line.
-func (w *linePrefixWriter) Close() error {
+func (w *LinePrefixWriter) Close() error {
 	var err error
 	if len(w.buf) > len(w.prefix) {
 		w.buf = append(w.buf, '\n')
@@ -31,6 +31,15 @@ type Config struct {
 
 	// This tells the docker client whether to authenticate requests
 	UseAuthentication bool
+
+	// DefaultNetwork is the network containers are attached to when they are created.
+	// If empty, the daemon default is used. The "bridge" network used by the simulation
+	// API is resolved to this network.
+	DefaultNetwork string
+
+	// CLI is the command-line tool of the container engine, used in commands printed
+	// for the user. If empty, "docker" is used.
+	CLI string
 }
 
 func Connect(dockerEndpoint string, cfg *Config) (*Builder, *ContainerBackend, error) {
@@ -54,7 +63,7 @@ func Connect(dockerEndpoint string, cfg *Config) (*Builder, *ContainerBackend, e
 	}
 	logger.Debug("docker daemon online", "version", env.Get("Version"))
 
-	builder, err := createBuilder(client, cfg)
+	builder, err := CreateBuilder(client, cfg)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -62,7 +71,9 @@ func Connect(dockerEndpoint string, cfg *Config) (*Builder, *ContainerBackend, e
 	return builder, backend, nil
 }
 
-func createBuilder(client *docker.Client, cfg *Config) (*Builder, error) {
+// CreateBuilder creates an image builder, loading registry credentials if
+// authentication is enabled in the config.
+func CreateBuilder(client *docker.Client, cfg *Config) (*Builder, error) {
 	var auth *docker.AuthConfigurations
 	var err error
 	if cfg.UseAuthentication {
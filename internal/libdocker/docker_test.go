@@ -0,0 +1,16 @@
+package libdocker_test
+
+import (
+	"testing"
+
+	"github.com/ethereum/hive/internal/backendtest"
+	"github.com/ethereum/hive/internal/libdocker"
+)
+
+func TestBackend(t *testing.T) {
+	builder, backend, err := libdocker.Connect("", &libdocker.Config{})
+	if err != nil {
+		t.Skip("docker is not available:", err)
+	}
+	backendtest.Run(t, builder, backend)
+}
@@ -0,0 +1,52 @@
+package libdocker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ethereum/hive/internal/libhive"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// RunNetworkScript runs a shell script in the network namespace of a container.
+// The script runs in a temporary hiveproxy container, which has the tc tool.
+func (b *ContainerBackend) RunNetworkScript(ctx context.Context, containerID string, script string, labels map[string]string) (*libhive.ExecInfo, error) {
+	c, err := b.client.CreateContainer(docker.CreateContainerOptions{
+		Context: ctx,
+		Config: &docker.Config{
+			Image:      hiveproxyTag,
+			Entrypoint: []string{"sh", "-c", script},
+			Labels:     labels,
+		},
+		HostConfig: &docker.HostConfig{
+			NetworkMode: "container:" + containerID,
+			CapAdd:      []string{"NET_ADMIN"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't create network script container: %v", err)
+	}
+	defer b.client.RemoveContainer(docker.RemoveContainerOptions{ID: c.ID, Force: true})
+
+	if err := b.client.StartContainerWithContext(c.ID, nil, ctx); err != nil {
+		return nil, fmt.Errorf("can't start network script container: %v", err)
+	}
+	exitCode, err := b.client.WaitContainerWithContext(c.ID, ctx)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	err = b.client.Logs(docker.LogsOptions{
+		Context:      ctx,
+		Container:    c.ID,
+		OutputStream: &stdout,
+		ErrorStream:  &stderr,
+		Stdout:       true,
+		Stderr:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &libhive.ExecInfo{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode}, nil
+}
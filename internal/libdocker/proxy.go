@@ -2,6 +2,7 @@ package libdocker
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net"
@@ -17,7 +18,7 @@ const hiveproxyTag = "hive/hiveproxy"
 // Build builds the hiveproxy image.
 func (cb *ContainerBackend) Build(ctx context.Context, b libhive.Builder) error {
 	err := b.BuildImage(ctx, hiveproxyTag, hiveproxy.Source)
-	if err != nil && !imageAlreadyExists(err) {
+	if err != nil && !ImageAlreadyExists(err) {
 		return err
 	}
 	return nil
@@ -71,9 +72,6 @@ func (cb *ContainerBackend) ServeAPI(ctx context.Context, h http.Handler) (libhi
 		}
 	}
 
-	// Register proxy in ContainerBackend, so it can be used for CheckLive.
-	cb.proxy = proxy
-
 	srv := &proxyContainer{
 		cb:              cb,
 		containerID:     id,
@@ -85,7 +83,7 @@ func (cb *ContainerBackend) ServeAPI(ctx context.Context, h http.Handler) (libhi
 	}
 
 	// Register proxy in ContainerBackend, so it can be used for CheckLive.
-	cb.proxy = proxy
+	cb.proxies.Add(proxy)
 	slog.Info("hiveproxy started", "container", id[:12], "addr", srv.Addr())
 	return srv, nil
 }
@@ -113,7 +111,7 @@ func (c *proxyContainer) Addr() net.Addr {
 func (c *proxyContainer) Close() error {
 	c.stopping.Do(func() {
 		// Unregister proxy in backend.
-		c.cb.proxy = nil
+		c.cb.proxies.Remove(c.proxy)
 
 		// Stop the container.
 		c.containerStdin.Close()
@@ -126,3 +124,55 @@ func (c *proxyContainer) Close() error {
 	})
 	return c.stopErr
 }
+
+// ProxySet tracks the running API proxies of a container backend. There is one proxy
+// for each simulator. The Kubernetes backend uses it as well.
+type ProxySet struct {
+	mu      sync.Mutex
+	proxies []*hiveproxy.Proxy
+}
+
+// Add registers a running proxy.
+func (s *ProxySet) Add(p *hiveproxy.Proxy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proxies = append(s.proxies, p)
+}
+
+// Remove unregisters a proxy.
+func (s *ProxySet) Remove(p *hiveproxy.Proxy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, rp := range s.proxies {
+		if rp == p {
+			s.proxies = append(s.proxies[:i], s.proxies[i+1:]...)
+			return
+		}
+	}
+}
+
+// Live returns a running proxy, or nil if no proxy is running. When several
+// simulators run concurrently, any of their proxies can be used for CheckLive because
+// they are all attached to the same network.
+func (s *ProxySet) Live() *hiveproxy.Proxy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.proxies) == 0 {
+		return nil
+	}
+	return s.proxies[len(s.proxies)-1]
+}
+
+// Dial opens a TCP connection to a container address through a running proxy.
+func (s *ProxySet) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	proxy := s.Live()
+	if proxy == nil {
+		return nil, errors.New("proxy is not running")
+	}
+	return proxy.Dial(ctx, addr)
+}
+
+// DialContainer opens a TCP connection to a container through the API proxy.
+func (cb *ContainerBackend) DialContainer(ctx context.Context, addr string) (net.Conn, error) {
+	return cb.proxies.Dial(ctx, addr)
+}
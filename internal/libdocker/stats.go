@@ -0,0 +1,88 @@
+package libdocker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/ethereum/hive/internal/libhive"
+	"github.com/ethereum/hive/internal/simapi"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// applyResources sets the resource limits of a container.
+func applyResources(hc *docker.HostConfig, r simapi.Resources) {
+	if r.CPUs > 0 {
+		hc.NanoCPUs = int64(r.CPUs * 1e9)
+	}
+	if r.CPUShares > 0 {
+		hc.CPUShares = r.CPUShares
+	}
+	if r.Memory > 0 {
+		hc.Memory = r.Memory
+	}
+	if r.Pids > 0 {
+		pids := r.Pids
+		hc.PidsLimit = &pids
+	}
+}
+
+// statsCollector tracks the resource usage of a running container.
+type statsCollector struct {
+	mu    sync.Mutex
+	usage libhive.ResourceUsage
+}
+
+// collectStats streams the stats of a container until it is removed or ctx is canceled.
+func (b *ContainerBackend) collectStats(ctx context.Context, logger *slog.Logger, containerID string) *statsCollector {
+	c := new(statsCollector)
+	ch := make(chan *docker.Stats)
+	go func() {
+		err := b.client.Stats(docker.StatsOptions{
+			ID:      containerID,
+			Stats:   ch,
+			Stream:  true,
+			Context: ctx,
+		})
+		if err != nil && ctx.Err() == nil {
+			logger.Debug("container stats stream failed", "err", err)
+		}
+	}()
+	go func() {
+		for s := range ch {
+			c.update(s)
+		}
+	}()
+	return c
+}
+
+func (c *statsCollector) update(s *docker.Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// MaxUsage is not available with cgroups v2, so the peak is also
+	// tracked using the current usage.
+	mem := max(s.MemoryStats.MaxUsage, s.MemoryStats.Usage)
+	if int64(mem) > c.usage.PeakMemory {
+		c.usage.PeakMemory = int64(mem)
+	}
+	// Stats of a stopped container are all zero. Keep the last values.
+	if s.CPUStats.CPUUsage.TotalUsage == 0 {
+		return
+	}
+	c.usage.CPUTime = int64(s.CPUStats.CPUUsage.TotalUsage)
+	var rx, tx uint64
+	for _, n := range s.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	c.usage.NetworkRx = int64(rx)
+	c.usage.NetworkTx = int64(tx)
+}
+
+// Usage returns the resource usage of the container.
+func (c *statsCollector) Usage() libhive.ResourceUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage
+}
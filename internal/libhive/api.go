@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
@@ -34,18 +35,32 @@ func newSimulationAPI(b ContainerBackend, env SimEnv, tm *TestManager, hive Hive
 	router := mux.NewRouter()
 	router.HandleFunc("/hive", api.getHiveInfo).Methods("GET")
 	router.HandleFunc("/clients", api.getClientTypes).Methods("GET")
+	router.HandleFunc("/catalog", api.setCatalog).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/exec", api.execInClient).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}", api.getNodeStatus).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/exit", api.waitNodeExit).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/log", api.getClientLog).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/file", api.getClientFile).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/archive", api.getClientArchive).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/artifact", api.attachClientFiles).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/proxy/{port:[0-9]+}{path:(?:/.*)?}", api.proxyClientRPC)
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node", api.startClient).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}", api.stopClient).Methods("DELETE")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/pause", api.pauseClient).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/pause", api.unpauseClient).Methods("DELETE")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/snapshot", api.snapshotClient).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/register/{target}", api.registerMultiTestNode).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test", api.startTest).Methods("POST")
 	// post because the delete http verb does not always support a message body
 	router.HandleFunc("/testsuite/{suite}/test/{test}", api.endTest).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/retry", api.retryTest).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/measurement", api.recordMeasurement).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/artifact", api.attachTestFile).Methods("POST")
 	router.HandleFunc("/testsuite", api.startSuite).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}", api.endSuite).Methods("DELETE")
+	// Network conditions must be registered before the network routes below.
+	router.HandleFunc("/testsuite/{suite}/network/"+networkConditionsName+"/{node}", api.networkConditionsSet).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/network/"+networkConditionsName+"/{node}", api.networkConditionsClear).Methods("DELETE")
 	router.HandleFunc("/testsuite/{suite}/network/{network}", api.networkCreate).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/network/{network}", api.networkRemove).Methods("DELETE")
 	router.HandleFunc("/testsuite/{suite}/network/{network}/{node}", api.networkIPGet).Methods("GET")
@@ -64,7 +79,9 @@ type simAPI struct {
 // getHiveInfo returns information about the hive server instance.
 func (api *simAPI) getHiveInfo(w http.ResponseWriter, r *http.Request) {
 	slog.Info("API: hive info requested")
-	serveJSON(w, api.hive)
+	info := api.hive
+	info.CompletedTests = api.env.Resume.CompletedTests()
+	serveJSON(w, info)
 }
 
 // getClientTypes returns all known client types.
@@ -72,6 +89,22 @@ func (api *simAPI) getClientTypes(w http.ResponseWriter, r *http.Request) {
 	serveJSON(w, api.tm.clientDefs)
 }
 
+// setCatalog stores the test catalog of the simulator.
+func (api *simAPI) setCatalog(w http.ResponseWriter, r *http.Request) {
+	var catalog simapi.TestCatalog
+	if err := json.NewDecoder(r.Body).Decode(&catalog); err != nil {
+		slog.Error("API: invalid test catalog", "error", err)
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	if catalog.Suites == nil {
+		catalog.Suites = []simapi.CatalogSuite{}
+	}
+	api.tm.SetCatalog(&catalog)
+	slog.Info("API: test catalog received", "suites", len(catalog.Suites))
+	serveOK(w)
+}
+
 // startSuite starts a suite.
 func (api *simAPI) startSuite(w http.ResponseWriter, r *http.Request) {
 	var suite simapi.TestRequest
@@ -126,12 +159,14 @@ func (api *simAPI) startTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	testID, err := api.tm.StartTest(suiteID, test.Name, test.Description)
+	testID, err := api.tm.StartSubtest(suiteID, TestID(test.Parent), test.Name, test.Description)
 	if err != nil {
 		err := fmt.Errorf("can't start test case: %s", err.Error())
 		serveError(w, err, http.StatusInternalServerError)
 		return
 	}
+	timeout := time.Duration(test.Timeout) * time.Millisecond
+	api.tm.startTestTimer(suiteID, testID, timeout)
 	slog.Info("API: test started", "suite", suiteID, "test", testID, "name", test.Name)
 	serveJSON(w, testID)
 }
@@ -153,6 +188,9 @@ func (api *simAPI) endTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !result.Pass && api.tm.config.PauseOnFailure != nil {
+		api.tm.pauseOnFailure(suiteID, testID)
+	}
 	err = api.tm.EndTest(suiteID, testID, &result)
 	if err != nil {
 		slog.Error("API: EndTest failed", "suite", suiteID, "test", testID, "error", err)
@@ -161,7 +199,66 @@ func (api *simAPI) endTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	slog.Info("API: test ended", "suite", suiteID, "test", testID, "pass", result.Pass)
+	slog.Info("API: test ended", "suite", suiteID, "test", testID, "pass", result.Pass, "skipped", result.Skipped)
+	serveOK(w)
+}
+
+// retryTest ends a failed attempt of a test case. It shuts down all clients
+// of the attempt.
+func (api *simAPI) retryTest(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var result TestResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		slog.Error("API: invalid result data in retryTest", "suite", suiteID, "test", testID, "error", err)
+		err := fmt.Errorf("can't unmarshal result: %v", err)
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if !result.Pass && api.tm.config.PauseOnFailure != nil {
+		api.tm.pauseOnFailure(suiteID, testID)
+	}
+	err = api.tm.RetryTest(suiteID, testID, &result)
+	if err != nil {
+		slog.Error("API: RetryTest failed", "suite", suiteID, "test", testID, "error", err)
+		err := fmt.Errorf("can't retry test case: %v", err)
+		serveError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("API: test attempt failed, retrying", "suite", suiteID, "test", testID)
+	serveOK(w)
+}
+
+// recordMeasurement adds a measurement to a test case.
+func (api *simAPI) recordMeasurement(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var m simapi.Measurement
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		err := fmt.Errorf("can't unmarshal measurement: %v", err)
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	if m.Name == "" {
+		serveError(w, errors.New("measurement has no name"), http.StatusBadRequest)
+		return
+	}
+	if err := api.tm.RecordMeasurement(testID, m); err != nil {
+		slog.Error("API: can't record measurement", "suite", suiteID, "test", testID, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+	slog.Debug("API: measurement recorded", "suite", suiteID, "test", testID, "name", m.Name, "value", m.Value)
 	serveOK(w)
 }
 
@@ -204,6 +301,19 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 		serveError(w, err, http.StatusBadRequest)
 		return
 	}
+	image := clientDef.Image
+	if clientConfig.Snapshot != "" {
+		snap, err := api.tm.getSnapshot(suiteID, clientConfig.Snapshot)
+		if err == nil && snap.client != clientDef {
+			err = fmt.Errorf("snapshot %s is not of client type %s", clientConfig.Snapshot, clientDef.Name)
+		}
+		if err != nil {
+			slog.Error("API: "+err.Error(), "client", clientDef.Name)
+			serveError(w, err, http.StatusBadRequest)
+			return
+		}
+		image = snap.image
+	}
 	// Get the network names, if any, for the container to be connected to at start.
 	networks, err := api.checkClientNetworks(&clientConfig, suiteID)
 	if err != nil {
@@ -239,6 +349,15 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 		env["HIVE_LOGLEVEL"] = strconv.Itoa(api.env.SimLogLevel)
 	}
 
+	// Wait until another client may be started. The number of client containers
+	// is limited across all simulations when --client.limit is set.
+	release, err := api.tm.acquireClientSlot(r.Context())
+	if err != nil {
+		slog.Error("API: no client slot available", "client", clientDef.Name, "error", err)
+		serveError(w, err, http.StatusInternalServerError)
+		return
+	}
+
 	// Set up the timeout.
 	timeout := api.env.ClientStartTimeout
 	if timeout == 0 {
@@ -260,9 +379,11 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 
 	// Create the client container.
 	options := ContainerOptions{Env: env, Files: files, Labels: labels, Name: containerName}
-	containerID, err := api.backend.CreateContainer(ctx, clientDef.Image, options)
+	options.Resources = clientResources(clientDef.Resources, clientConfig.Resources)
+	containerID, err := api.backend.CreateContainer(ctx, image, options)
 	if err != nil {
 		slog.Error("API: client container create failed", "client", clientDef.Name, "error", err)
+		release()
 		err := fmt.Errorf("client container create failed (%v)", err)
 		serveError(w, err, http.StatusInternalServerError)
 		return
@@ -277,6 +398,8 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 	for _, network := range networks {
 		if err := api.tm.ConnectContainer(suiteID, network, containerID); err != nil {
 			slog.Error("API: failed to connect container", "network", network, "container", containerID, "error", err)
+			api.backend.DeleteContainer(containerID)
+			release()
 			serveError(w, err, http.StatusInternalServerError)
 			return
 		}
@@ -288,6 +411,8 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 		v, err := strconv.ParseUint(portStr, 10, 16)
 		if err != nil {
 			slog.Error("API: could not parse check-live port", "error", err)
+			api.backend.DeleteContainer(containerID)
+			release()
 			serveError(w, err, http.StatusBadRequest)
 			return
 		}
@@ -296,6 +421,18 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 
 	// Start it!
 	info, err := api.backend.StartContainer(ctx, containerID, options)
+	var wait func()
+	if info != nil && info.Wait != nil {
+		// The slot is released when the container has stopped.
+		wait = info.Wait
+		info.Wait = func() {
+			wait()
+			release()
+			api.tm.emit(clientEvent(EventClientStop, suiteID, testID, info.ID, clientDef.Name))
+		}
+	} else {
+		release()
+	}
 	if info != nil {
 		// Capture the current log file size as the starting offset for this test.
 		logBegin := logFileSize(logFilePath)
@@ -307,6 +444,11 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 			LogFile:        logPath,
 			LogOffsets:     &TestLogOffsets{Begin: logBegin},
 			wait:           info.Wait,
+			usage:          info.Usage,
+		}
+		if err == nil && wait != nil {
+			clientInfo.state = &clientState{exited: make(chan struct{})}
+			go api.tm.watchClient(suiteID, testID, clientInfo, wait, info.ExitState)
 		}
 
 		// Add client version to the test suite.
@@ -329,6 +471,7 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 
 	// It's started.
 	slog.Info("API: client "+clientDef.Name+" started", "suite", suiteID, "test", testID, "container", containerID[:8])
+	api.tm.emit(clientEvent(EventClientStart, suiteID, testID, info.ID, clientDef.Name))
 	serveJSON(w, &simapi.StartNodeResponse{ID: info.ID, IP: info.IP})
 }
 
@@ -355,6 +498,32 @@ func (api *simAPI) checkClient(req *simapi.NodeConfig) (*ClientDefinition, error
 	return nil, errors.New("unknown client type in start request")
 }
 
+// clientResources applies the resource limits of a start request to the
+// default limits of the client. Limits which are unset in the request keep
+// their default value.
+func clientResources(defaults, req *simapi.Resources) simapi.Resources {
+	var r simapi.Resources
+	if defaults != nil {
+		r = *defaults
+	}
+	if req == nil {
+		return r
+	}
+	if req.CPUs != 0 {
+		r.CPUs = req.CPUs
+	}
+	if req.CPUShares != 0 {
+		r.CPUShares = req.CPUShares
+	}
+	if req.Memory != 0 {
+		r.Memory = req.Memory
+	}
+	if req.Pids != 0 {
+		r.Pids = req.Pids
+	}
+	return r
+}
+
 // checkClientNetworks pre-checks the existence of initial networks for a client container.
 func (api *simAPI) checkClientNetworks(req *simapi.NodeConfig, suiteID TestSuiteID) ([]string, error) {
 	for _, network := range req.Networks {
@@ -425,6 +594,28 @@ func (api *simAPI) unpauseClient(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// snapshotClient saves the state of a client container.
+func (api *simAPI) snapshotClient(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+
+	id, err := api.tm.SnapshotClient(r.Context(), suiteID, testID, node)
+	switch {
+	case err == ErrNoSuchNode:
+		serveError(w, err, http.StatusNotFound)
+	case err != nil:
+		slog.Error("API: could not create client snapshot", "container", node, "error", err)
+		serveError(w, err, http.StatusInternalServerError)
+	default:
+		slog.Info("API: client snapshot created", "container", node, "snapshot", id)
+		serveJSON(w, &simapi.SnapshotResponse{ID: id})
+	}
+}
+
 // registerMultiTestNode registers a client from one test with another test.
 // This enables client reuse across multiple tests while maintaining proper
 // clientInfo association for UI visibility in each individual test.
@@ -473,6 +664,8 @@ func (api *simAPI) registerMultiTestNode(w http.ResponseWriter, r *http.Request)
 		InstantiatedAt: nodeInfo.InstantiatedAt,
 		LogFile:        nodeInfo.LogFile,
 		LogOffsets:     logOffsets,
+		usage:          nodeInfo.usage,
+		state:          nodeInfo.state,
 		// wait is intentionally nil - target tests shouldn't stop the client
 	}
 
@@ -503,6 +696,45 @@ func (api *simAPI) getNodeStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	node := mux.Vars(r)["node"]
+	status, err := api.tm.NodeStatus(suiteID, testID, node)
+	if err != nil {
+		slog.Error("API: can't find node", "node", node, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+	serveJSON(w, status)
+}
+
+// waitNodeExit waits for a client container to stop and returns its status.
+func (api *simAPI) waitNodeExit(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	node := mux.Vars(r)["node"]
+	status, err := api.tm.WaitNodeExit(r.Context(), suiteID, testID, node)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return // the simulator has cancelled the request
+		}
+		slog.Error("API: can't find node", "node", node, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+	serveJSON(w, status)
+}
+
+// getClientLog serves the log output of a client container.
+func (api *simAPI) getClientLog(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
 	node := mux.Vars(r)["node"]
 	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
 	if err != nil {
@@ -510,8 +742,171 @@ func (api *simAPI) getNodeStatus(w http.ResponseWriter, r *http.Request) {
 		serveError(w, err, http.StatusNotFound)
 		return
 	}
+	var offset int64
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.ParseInt(v, 10, 64); err != nil {
+			serveError(w, errInvalidLogOffset, http.StatusBadRequest)
+			return
+		}
+	}
+	follow := r.URL.Query().Get("follow") == "true"
+
+	// When the client is not running, following the log just returns its content.
+	exited := make(chan struct{})
+	if nodeInfo.state != nil {
+		exited = nodeInfo.state.exited
+	} else {
+		close(exited)
+	}
+
+	file := filepath.Join(api.tm.config.LogDir, filepath.FromSlash(nodeInfo.LogFile))
+	err = serveClientLog(w, r, file, offset, follow, exited)
+	switch {
+	case err == errInvalidLogOffset:
+		serveError(w, err, http.StatusBadRequest)
+	case errors.Is(err, fs.ErrNotExist):
+		serveError(w, errors.New("client log not found"), http.StatusNotFound)
+	case err != nil:
+		slog.Error("API: can't serve client log", "node", node, "error", err)
+	}
+}
+
+// getClientFile serves the content of a file in a client container.
+func (api *simAPI) getClientFile(w http.ResponseWriter, r *http.Request) {
+	nodeInfo, file, ok := api.requestNodeFile(w, r)
+	if !ok {
+		return
+	}
+	archive, err := api.tm.downloadFiles(r.Context(), nodeInfo.ID, file)
+	if err != nil {
+		slog.Error("API: can't download client file", "node", nodeInfo.ID, "path", file, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+	defer archive.Close()
+	hdr, content, err := readFile(archive)
+	if err != nil {
+		serveError(w, fmt.Errorf("can't read %s: %v", file, err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("content-type", "application/octet-stream")
+	w.Header().Set("content-length", strconv.FormatInt(hdr.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, content)
+}
+
+// getClientArchive serves a tar archive of a file or directory in a client container.
+func (api *simAPI) getClientArchive(w http.ResponseWriter, r *http.Request) {
+	nodeInfo, file, ok := api.requestNodeFile(w, r)
+	if !ok {
+		return
+	}
+	archive, err := api.tm.downloadFiles(r.Context(), nodeInfo.ID, file)
+	if err != nil {
+		slog.Error("API: can't download client files", "node", nodeInfo.ID, "path", file, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+	defer archive.Close()
+	w.Header().Set("content-type", "application/x-tar")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, archive)
+}
+
+// attachClientFiles stores a file or directory of a client container as an artifact
+// of the test.
+func (api *simAPI) attachClientFiles(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	nodeInfo, file, ok := api.requestNodeFile(w, r)
+	if !ok {
+		return
+	}
+	artifact, err := api.tm.AttachClientFiles(r.Context(), suiteID, testID, nodeInfo.ID, file)
+	if err != nil {
+		slog.Error("API: can't attach client files", "node", nodeInfo.ID, "path", file, "error", err)
+		serveError(w, err, http.StatusInternalServerError)
+		return
+	}
+	slog.Info("API: client files attached", "node", nodeInfo.ID, "path", file, "file", artifact.File)
+	serveJSON(w, artifact)
+}
 
-	serveJSON(w, &simapi.NodeResponse{ID: nodeInfo.ID, Name: nodeInfo.Name})
+// attachTestFile stores the request body as an artifact of the test.
+func (api *simAPI) attachTestFile(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		serveError(w, errors.New("missing artifact name"), http.StatusBadRequest)
+		return
+	}
+	artifact, err := api.tm.AttachTestFile(testID, name, r.Body)
+	switch {
+	case err == ErrNoSuchTestCase:
+		serveError(w, err, http.StatusNotFound)
+	case err != nil:
+		slog.Error("API: can't attach test file", "suite", suiteID, "test", testID, "name", name, "error", err)
+		serveError(w, err, http.StatusInternalServerError)
+	default:
+		slog.Info("API: test file attached", "suite", suiteID, "test", testID, "name", name, "file", artifact.File)
+		serveJSON(w, artifact)
+	}
+}
+
+// proxyClientRPC relays an HTTP request to a port of a client container. The request
+// and response are recorded in the RPC transcript of the test.
+func (api *simAPI) proxyClientRPC(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	vars := mux.Vars(r)
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, vars["node"])
+	if err != nil {
+		serveError(w, err, http.StatusNotFound)
+		return
+	}
+	port, err := strconv.ParseUint(vars["port"], 10, 16)
+	if err != nil {
+		serveError(w, errors.New("invalid port"), http.StatusBadRequest)
+		return
+	}
+	path := vars["path"]
+	if path == "" {
+		path = "/"
+	}
+	api.tm.proxyRPC(w, r, testID, nodeInfo, uint16(port), path)
+}
+
+// requestNodeFile returns the client and file path of a file download request.
+// It serves an error response if the request is invalid.
+func (api *simAPI) requestNodeFile(w http.ResponseWriter, r *http.Request) (*ClientInfo, string, bool) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return nil, "", false
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		slog.Error("API: can't find node", "node", node, "error", err)
+		serveError(w, err, http.StatusNotFound)
+		return nil, "", false
+	}
+	file := r.URL.Query().Get("path")
+	if !path.IsAbs(file) {
+		serveError(w, errors.New("path must be absolute"), http.StatusBadRequest)
+		return nil, "", false
+	}
+	return nodeInfo, file, true
 }
 
 func (api *simAPI) execInClient(w http.ResponseWriter, r *http.Request) {
@@ -658,6 +1053,57 @@ func (api *simAPI) networkDisconnect(w http.ResponseWriter, r *http.Request) {
 	serveOK(w)
 }
 
+// networkConditionsSet applies network conditions to a container.
+func (api *simAPI) networkConditionsSet(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	var cond simapi.NetworkConditions
+	if err := json.NewDecoder(r.Body).Decode(&cond); err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	containerID := mux.Vars(r)["node"]
+	err = api.tm.SetNetworkConditions(r.Context(), suiteID, containerID, &cond)
+	switch {
+	case errors.Is(err, ErrNoSuchNode):
+		serveError(w, err, http.StatusNotFound)
+		return
+	case err != nil:
+		slog.Error("API: failed to set network conditions", "container", containerID, "error", err)
+		serveError(w, err, http.StatusInternalServerError)
+		return
+	}
+	slog.Info("API: network conditions set", "container", containerID, "peers", len(cond.Peers))
+	serveOK(w)
+}
+
+// networkConditionsClear removes the network conditions of a container.
+func (api *simAPI) networkConditionsClear(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	containerID := mux.Vars(r)["node"]
+	err = api.tm.ClearNetworkConditions(r.Context(), suiteID, containerID)
+	switch {
+	case errors.Is(err, ErrNoSuchNode):
+		serveError(w, err, http.StatusNotFound)
+		return
+	case err != nil:
+		slog.Error("API: failed to clear network conditions", "container", containerID, "error", err)
+		serveError(w, err, http.StatusInternalServerError)
+		return
+	}
+	slog.Info("API: network conditions cleared", "container", containerID)
+	serveOK(w)
+}
+
 // requestSuite returns the suite ID from the request body and checks that
 // it corresponds to a running suite.
 func (api *simAPI) requestSuite(r *http.Request) (TestSuiteID, error) {
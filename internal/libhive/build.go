@@ -0,0 +1,116 @@
+package libhive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// BuildReportFileName returns the file name of the build report of a run
+// started at the given time. Every run writes its own report, so reports of
+// earlier runs in the same results directory are kept.
+func BuildReportFileName(start time.Time) string {
+	return fmt.Sprintf("build-%d.json", start.Unix())
+}
+
+// ParseBuildReportFileName returns the start time encoded in a build report
+// file name. The boolean result is false if name is not a build report.
+func ParseBuildReportFileName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, "build-") || !strings.HasSuffix(name, ".json") {
+		return time.Time{}, false
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(name, "build-"), ".json")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
+
+// BuildOptions configures how client images are built.
+type BuildOptions struct {
+	// Concurrency is the max number of client images built at the same time.
+	Concurrency int
+	// Strict makes the build fail if any client fails to build.
+	Strict bool
+	// SkipClientImages makes Build create the client definitions without building
+	// client images. Clients can't be started in the run, so this is only useful for
+	// listing tests.
+	SkipClientImages bool
+}
+
+// BuildReport contains the results of client image builds.
+type BuildReport struct {
+	Start   time.Time     `json:"start"`
+	Clients []ClientBuild `json:"clients"`
+}
+
+// ClientBuild is the build result of a single client.
+type ClientBuild struct {
+	Client   string `json:"client"`
+	Image    string `json:"image"`
+	ImageID  string `json:"imageID,omitempty"`
+	Duration int64  `json:"durationMs"`        // build time in milliseconds
+	CacheHit bool   `json:"cacheHit"`          // true if the image did not change
+	Error    string `json:"error,omitempty"`   // build error
+	Version  string `json:"version,omitempty"` // client version
+}
+
+// Failed returns the names of clients which failed to build.
+func (r *BuildReport) Failed() []string {
+	var failed []string
+	for _, b := range r.Clients {
+		if b.Error != "" {
+			failed = append(failed, b.Client)
+		}
+	}
+	return failed
+}
+
+// WriteFile writes the report as JSON to the given directory. The file name is
+// derived from the start time of the build, see BuildReportFileName.
+func (r *BuildReport) WriteFile(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	enc, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, BuildReportFileName(r.Start)), enc, 0644)
+}
+
+// Print writes a human-readable summary of the report.
+// Nothing is written if no clients were built.
+func (r *BuildReport) Print(w io.Writer) {
+	if len(r.Clients) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "client build summary (%d clients, %d failed):\n", len(r.Clients), len(r.Failed()))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, b := range r.Clients {
+		duration := (time.Duration(b.Duration) * time.Millisecond).String()
+		switch {
+		case b.Error != "":
+			fmt.Fprintf(tw, "  %s\tFAILED\t%s\t%s\n", b.Client, duration, b.Error)
+		case b.CacheHit:
+			fmt.Fprintf(tw, "  %s\tok\t%s\t%s (cached)\n", b.Client, duration, shortImageID(b.ImageID))
+		default:
+			fmt.Fprintf(tw, "  %s\tok\t%s\t%s\n", b.Client, duration, shortImageID(b.ImageID))
+		}
+	}
+	tw.Flush()
+}
+
+func shortImageID(id string) string {
+	if len(id) > 19 {
+		return id[:19]
+	}
+	return id
+}
@@ -14,24 +14,13 @@ type CleanupOptions struct {
 	InstanceID    string        // Clean specific instance, empty for all
 	OlderThan     time.Duration // Clean containers older than duration
 	DryRun        bool          // Show what would be cleaned without doing it
-	ContainerType string        // Filter by container type (client, simulator, proxy)
+	ContainerType string        // Filter by container type (client, simulator, proxy, snapshot)
 }
 
-// CleanupHiveContainers finds and removes Hive containers based on labels
+// CleanupHiveContainers finds and removes Hive containers based on labels.
+// Client snapshot images are removed as well.
 func CleanupHiveContainers(ctx context.Context, client *docker.Client, opts CleanupOptions) error {
-	// Build label filter
-	filters := map[string][]string{
-		"label": {"hive.instance"}, // All containers with hive.instance label
-	}
-
-	if opts.InstanceID != "" {
-		filters["label"] = append(filters["label"], "hive.instance="+opts.InstanceID)
-	}
-
-	if opts.ContainerType != "" {
-		filters["label"] = append(filters["label"], "hive.type="+opts.ContainerType)
-	}
-
+	filters := cleanupFilters(opts)
 	containers, err := client.ListContainers(docker.ListContainersOptions{
 		Context: ctx,
 		All:     true,
@@ -42,15 +31,8 @@ func CleanupHiveContainers(ctx context.Context, client *docker.Client, opts Clea
 	}
 
 	for _, container := range containers {
-		if opts.OlderThan > 0 {
-			createdTimeStr, exists := container.Labels[LabelHiveCreated]
-			if !exists {
-				continue // Skip containers without creation timestamp
-			}
-			createdTime, err := time.Parse(time.RFC3339, createdTimeStr)
-			if err != nil || time.Since(createdTime) < opts.OlderThan {
-				continue
-			}
+		if !olderThan(container.Labels, opts.OlderThan) {
+			continue
 		}
 
 		containerType := container.Labels[LabelHiveType]
@@ -74,9 +56,79 @@ func CleanupHiveContainers(ctx context.Context, client *docker.Client, opts Clea
 		}
 	}
 
+	return cleanupSnapshotImages(ctx, client, opts)
+}
+
+// cleanupSnapshotImages removes the client snapshot images left behind by hive.
+func cleanupSnapshotImages(ctx context.Context, client *docker.Client, opts CleanupOptions) error {
+	if opts.ContainerType != "" && opts.ContainerType != ContainerTypeSnapshot {
+		return nil
+	}
+	filters := cleanupFilters(opts)
+	if opts.ContainerType == "" {
+		filters["label"] = append(filters["label"], LabelHiveType+"="+ContainerTypeSnapshot)
+	}
+	images, err := client.ListImages(docker.ListImagesOptions{
+		Context: ctx,
+		Filters: filters,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list images: %v", err)
+	}
+
+	for _, image := range images {
+		if !olderThan(image.Labels, opts.OlderThan) {
+			continue
+		}
+		id := strings.TrimPrefix(image.ID, "sha256:")[:12]
+
+		if opts.DryRun {
+			fmt.Printf("Would remove image %s (%s)\n", id, ContainerTypeSnapshot)
+			continue
+		}
+
+		err := client.RemoveImageExtended(image.ID, docker.RemoveImageOptions{
+			Context: ctx,
+			Force:   true,
+		})
+		if err != nil {
+			fmt.Printf("Failed to remove image %s: %v\n", id, err)
+		} else {
+			fmt.Printf("Removed image %s (%s)\n", id, ContainerTypeSnapshot)
+		}
+	}
+
 	return nil
 }
 
+// cleanupFilters returns the docker label filters matching the given options.
+func cleanupFilters(opts CleanupOptions) map[string][]string {
+	filters := map[string][]string{
+		"label": {LabelHiveInstance}, // All objects with hive.instance label
+	}
+	if opts.InstanceID != "" {
+		filters["label"] = append(filters["label"], LabelHiveInstance+"="+opts.InstanceID)
+	}
+	if opts.ContainerType != "" {
+		filters["label"] = append(filters["label"], LabelHiveType+"="+opts.ContainerType)
+	}
+	return filters
+}
+
+// olderThan reports whether the creation time label is older than the given duration.
+// Objects without a creation timestamp only match when the duration is zero.
+func olderThan(labels map[string]string, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	createdTimeStr, exists := labels[LabelHiveCreated]
+	if !exists {
+		return false
+	}
+	createdTime, err := time.Parse(time.RFC3339, createdTimeStr)
+	return err == nil && time.Since(createdTime) >= d
+}
+
 // ListHiveContainers lists all Hive containers with their metadata
 func ListHiveContainers(ctx context.Context, client *docker.Client, instanceID string) error {
 	// Build label filter
@@ -1,6 +1,7 @@
 package libhive
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -51,3 +52,29 @@ func TestCleanupOptionsDefaults(t *testing.T) {
 		t.Errorf("Expected empty ContainerType, got %s", opts.ContainerType)
 	}
 }
+
+func TestCleanupFilters(t *testing.T) {
+	filters := cleanupFilters(CleanupOptions{InstanceID: "test-instance", ContainerType: ContainerTypeSnapshot})
+	want := []string{LabelHiveInstance, LabelHiveInstance + "=test-instance", LabelHiveType + "=snapshot"}
+	if !reflect.DeepEqual(filters["label"], want) {
+		t.Errorf("wrong label filters %q, want %q", filters["label"], want)
+	}
+}
+
+func TestCleanupOlderThan(t *testing.T) {
+	old := map[string]string{LabelHiveCreated: time.Now().Add(-2 * time.Hour).Format(time.RFC3339)}
+	recent := map[string]string{LabelHiveCreated: time.Now().Format(time.RFC3339)}
+
+	if !olderThan(nil, 0) {
+		t.Error("unlabelled object not matched without age filter")
+	}
+	if olderThan(nil, time.Hour) {
+		t.Error("unlabelled object matched with age filter")
+	}
+	if !olderThan(old, time.Hour) {
+		t.Error("old object not matched")
+	}
+	if olderThan(recent, time.Hour) {
+		t.Error("recent object matched")
+	}
+}
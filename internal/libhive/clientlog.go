@@ -0,0 +1,76 @@
+package libhive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/hive/internal/simapi"
+)
+
+// logFollowInterval is the interval at which followed client logs are checked for new
+// output.
+const logFollowInterval = 100 * time.Millisecond
+
+var errInvalidLogOffset = errors.New("invalid log offset")
+
+// serveClientLog writes the content of a client log file, starting at the given
+// offset. When follow is true, output appended to the file is streamed until the
+// client has exited or the request is cancelled.
+func serveClientLog(w http.ResponseWriter, r *http.Request, file string, offset int64, follow bool, exited <-chan struct{}) error {
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	stat, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset > stat.Size() {
+		return errInvalidLogOffset
+	}
+	if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	w.Header().Set("content-type", "text/plain")
+	w.Header().Set(simapi.LogOffsetHeader, strconv.FormatInt(offset, 10))
+	if !follow {
+		w.Header().Set(simapi.LogEndHeader, strconv.FormatInt(stat.Size(), 10))
+		w.WriteHeader(http.StatusOK)
+		_, err := io.CopyN(w, fd, stat.Size()-offset)
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return followLog(r.Context(), w, fd, exited)
+}
+
+// followLog copies the content of fd to w until the client has exited.
+func followLog(ctx context.Context, w http.ResponseWriter, fd *os.File, exited <-chan struct{}) error {
+	flusher, _ := w.(http.Flusher)
+	ticker := time.NewTicker(logFollowInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := io.Copy(w, fd); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-ticker.C:
+		case <-exited:
+			// Copy the remaining output.
+			_, err := io.Copy(w, fd)
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
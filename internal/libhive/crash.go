@@ -0,0 +1,112 @@
+package libhive
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ethereum/hive/internal/simapi"
+)
+
+// clientState tracks whether a client container is still running.
+// It is guarded by testCaseMutex.
+type clientState struct {
+	exited   chan struct{}  // closed when the container has stopped
+	stopping bool           // set when hive stops the container
+	crash    *ContainerExit // set when the container stopped by itself
+}
+
+// watchClient waits for a client container to stop. If the container was not stopped
+// by hive, the exit is recorded as a crash. The wait function must be the unwrapped
+// wait function of the backend.
+func (manager *TestManager) watchClient(suiteID TestSuiteID, testID TestID, node *ClientInfo, wait func(), exitState func() *ContainerExit) {
+	wait()
+	var exit *ContainerExit
+	if exitState != nil {
+		exit = exitState()
+	}
+
+	manager.testCaseMutex.Lock()
+	crashed := !node.state.stopping
+	if crashed {
+		if exit == nil {
+			exit = &ContainerExit{ExitCode: -1, Time: time.Now()}
+		}
+		node.state.crash = exit
+	}
+	close(node.state.exited)
+	manager.testCaseMutex.Unlock()
+
+	if crashed {
+		slog.Warn("client crashed", "client", node.Name, "container", node.ID, "exitCode", exit.ExitCode, "oomKilled", exit.OOMKilled)
+		manager.emit(clientEvent(EventClientCrash, suiteID, testID, node.ID, node.Name))
+	}
+}
+
+// NodeStatus returns the state of a client container.
+func (manager *TestManager) NodeStatus(testSuite TestSuiteID, test TestID, nodeID string) (*simapi.NodeResponse, error) {
+	node, err := manager.GetNodeInfo(testSuite, test, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	manager.testCaseMutex.RLock()
+	defer manager.testCaseMutex.RUnlock()
+	return node.status(), nil
+}
+
+// WaitNodeExit waits until a client container has stopped and returns its state.
+func (manager *TestManager) WaitNodeExit(ctx context.Context, testSuite TestSuiteID, test TestID, nodeID string) (*simapi.NodeResponse, error) {
+	node, err := manager.GetNodeInfo(testSuite, test, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if node.state != nil {
+		select {
+		case <-node.state.exited:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	manager.testCaseMutex.RLock()
+	defer manager.testCaseMutex.RUnlock()
+	return node.status(), nil
+}
+
+// status returns the API representation of the client.
+// This must be called with testCaseMutex held.
+func (c *ClientInfo) status() *simapi.NodeResponse {
+	resp := &simapi.NodeResponse{ID: c.ID, Name: c.Name, State: simapi.NodeStopped}
+	if c.state == nil {
+		return resp
+	}
+	select {
+	case <-c.state.exited:
+		if crash := c.state.crash; crash != nil {
+			resp.State = simapi.NodeExited
+			resp.ExitCode = crash.ExitCode
+			resp.OOMKilled = crash.OOMKilled
+		}
+	default:
+		resp.State = simapi.NodeRunning
+	}
+	return resp
+}
+
+// recordCrash annotates the test result if the client has crashed.
+// This must be called with testCaseMutex held.
+func (c *ClientInfo) recordCrash(result *TestResult) {
+	if c.state == nil || c.state.crash == nil {
+		return
+	}
+	c.Exit = c.state.crash
+	result.ClientCrashed = true
+	note := fmt.Sprintf("client %s (%s) crashed with exit code %d", c.Name, c.ID, c.Exit.ExitCode)
+	if c.Exit.OOMKilled {
+		note += " (out of memory)"
+	}
+	if result.Details != "" && result.Details[len(result.Details)-1] != '\n' {
+		result.Details += "\n"
+	}
+	result.Details += note + "\n"
+}
@@ -4,15 +4,18 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
+
+	"github.com/ethereum/hive/internal/simapi"
 )
 
 // Docker label keys used by Hive
 const (
 	LabelHiveInstance    = "hive.instance"     // Unique Hive instance ID
 	LabelHiveVersion     = "hive.version"      // Hive version/commit
-	LabelHiveType        = "hive.type"         // container type: client|simulator|proxy
+	LabelHiveType        = "hive.type"         // container type: client|simulator|proxy|netem|snapshot
 	LabelHiveTestSuite   = "hive.test.suite"   // test suite ID
 	LabelHiveTestCase    = "hive.test.case"    // test case ID
 	LabelHiveClientName  = "hive.client.name"  // client name (go-ethereum, etc)
@@ -26,6 +29,8 @@ const (
 	ContainerTypeClient    = "client"
 	ContainerTypeSimulator = "simulator"
 	ContainerTypeProxy     = "proxy"
+	ContainerTypeNetem     = "netem"    // temporary container applying network conditions
+	ContainerTypeSnapshot  = "snapshot" // image of a client snapshot
 )
 
 // Global counter for ensuring unique container names
@@ -147,9 +152,54 @@ type TestCase struct {
 	SummaryResult TestResult             `json:"summaryResult"` // The result of the whole test case.
 	ClientInfo    map[string]*ClientInfo `json:"clientInfo"`    // Info about each client.
 
+	// Parent is the ID of the test which ran this test as a subtest.
+	// It is zero for the top-level tests of a suite.
+	Parent TestID `json:"parent,omitempty"`
+
 	// MultiTestContext is true when this test case is the lifecycle owner
 	// for clients shared across multiple tests (via registerMultiTestNode).
 	MultiTestContext bool `json:"multiTestContext,omitempty"`
+
+	// Attempts contains the failed attempts of a retried test case.
+	Attempts []*TestAttempt `json:"attempts,omitempty"`
+
+	// Artifacts contains files copied out of client containers and files attached
+	// by the test.
+	Artifacts []*Artifact `json:"artifacts,omitempty"`
+
+	// Measurements contains the numeric values recorded by the test. For a retried
+	// test, these are the values of the last attempt.
+	Measurements []simapi.Measurement `json:"measurements,omitempty"`
+
+	timer    *time.Timer // ends the test when it exceeds its time limit
+	timeout  time.Duration
+	subtests []TestID
+}
+
+// Artifact is a file stored with a test result. It is either a file or directory copied
+// out of a client container, or data attached by the test, which has a name instead.
+type Artifact struct {
+	Name     string `json:"name,omitempty"`     // name given by the test
+	Client   string `json:"client,omitempty"`   // client name
+	ClientID string `json:"clientId,omitempty"` // container ID
+	Path     string `json:"path,omitempty"`     // path in the client container
+	File     string `json:"file"`               // relative to the log directory
+}
+
+// TestAttempt is a failed attempt of a test case which was run again.
+type TestAttempt struct {
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Result     TestResult             `json:"result"`
+	ClientInfo map[string]*ClientInfo `json:"clientInfo,omitempty"` // Clients of the attempt.
+
+	// Measurements contains the values recorded by the attempt.
+	Measurements []simapi.Measurement `json:"measurements,omitempty"`
+
+	// Subtests contains the subtests run by the attempt, keyed by the test ID they
+	// had during the run. They are not listed in the test cases of the suite, so only
+	// the subtests of the last attempt count in the results.
+	Subtests map[TestID]*TestCase `json:"subtests,omitempty"`
 }
 
 // TestResult represents the result of a test case.
@@ -157,6 +207,16 @@ type TestResult struct {
 	Pass    bool `json:"pass"`
 	Timeout bool `json:"timeout,omitempty"`
 
+	// Skipped is set when the simulator did not run the test, e.g. because the
+	// client does not support it. Skipped tests also have Pass set.
+	Skipped bool `json:"skipped,omitempty"`
+
+	// Flaky is set when the test passed after failed attempts.
+	Flaky bool `json:"flaky,omitempty"`
+
+	// ClientCrashed is set when a client exited while the test was running.
+	ClientCrashed bool `json:"clientCrashed,omitempty"`
+
 	// The test log can be stored inline ("details"), or as offsets into the
 	// suite's TestDetailsLog file ("log").
 	Details    string          `json:"details,omitempty"`
@@ -181,7 +241,47 @@ type ClientInfo struct {
 	// client container serves multiple tests.
 	LogOffsets *TestLogOffsets `json:"logOffsets,omitempty"`
 
-	wait func()
+	// Resources is the resource usage of the client container, measured
+	// when the test ended. For clients shared between multiple tests, this is
+	// the total usage since the container was started.
+	Resources *ResourceUsage `json:"resources,omitempty"`
+
+	// Exit is the exit status of a client which stopped by itself, i.e. crashed,
+	// while the test was running.
+	Exit *ContainerExit `json:"exit,omitempty"`
+
+	// RPCTranscript is the file containing the RPC requests sent to the client
+	// through the recording proxy during the test. The path is relative to the
+	// log directory.
+	RPCTranscript string `json:"rpcTranscript,omitempty"`
+
+	wait    func()
+	usage   func() ResourceUsage
+	state   *clientState // shared with tests using the same client
+	stopped bool         // stopped during the test, removed when the test ends
+}
+
+// recordUsage stores the current resource usage of the client.
+func (c *ClientInfo) recordUsage() {
+	if c.usage != nil {
+		usage := c.usage()
+		c.Resources = &usage
+	}
+}
+
+// ResourceUsage is the resource consumption of a container.
+type ResourceUsage struct {
+	PeakMemory int64 `json:"peakMemory"` // max memory usage in bytes
+	CPUTime    int64 `json:"cpuTime"`    // CPU time in nanoseconds
+	NetworkRx  int64 `json:"networkRx"`  // bytes received
+	NetworkTx  int64 `json:"networkTx"`  // bytes sent
+}
+
+// ContainerExit is the exit status of a container.
+type ContainerExit struct {
+	ExitCode  int       `json:"exitCode"`
+	OOMKilled bool      `json:"oomKilled,omitempty"`
+	Time      time.Time `json:"time"`
 }
 
 // HiveInstance contains information about hive itself.
@@ -190,14 +290,18 @@ type HiveInstance struct {
 	SourceDate   string      `json:"sourceDate"`
 	BuildDate    string      `json:"buildDate"`
 	HiveVersion  VersionInfo `json:"hiveVersion,omitempty"` // Enhanced hive version info
+
+	// Replay records the images and settings of the run.
+	Replay *ReplayManifest `json:"replay,omitempty"`
 }
 
 // ClientDefinition is served by the /clients API endpoint to list the available clients
 type ClientDefinition struct {
-	Name    string         `json:"name"`
-	Version string         `json:"version"`
-	Image   string         `json:"-"` // not exposed via API
-	Meta    ClientMetadata `json:"meta"`
+	Name      string            `json:"name"`
+	Version   string            `json:"version"`
+	Image     string            `json:"-"` // not exposed via API
+	Meta      ClientMetadata    `json:"meta"`
+	Resources *simapi.Resources `json:"resources,omitempty"`
 }
 
 // ExecInfo is the result of running a script in a client container.
@@ -206,3 +310,47 @@ type ExecInfo struct {
 	Stderr   string `json:"stderr"`
 	ExitCode int    `json:"exitCode"`
 }
+
+// removeSubtests removes the subtests of a test from the suite, including their own
+// subtests, and returns them.
+func (s *TestSuite) removeSubtests(parent TestID) map[TestID]*TestCase {
+	var removed map[TestID]*TestCase
+	for changed := true; changed; {
+		changed = false
+		for id, test := range s.TestCases {
+			if test.Parent == 0 || (test.Parent != parent && removed[test.Parent] == nil) {
+				continue
+			}
+			if removed == nil {
+				removed = make(map[TestID]*TestCase)
+			}
+			removed[id] = test
+			delete(s.TestCases, id)
+			changed = true
+		}
+	}
+	return removed
+}
+
+// rollUpSubtests adds the results of the subtests of a test to its result. If any
+// subtest has failed, the test fails as well.
+func (s *TestSuite) rollUpSubtests(test *TestCase, result *TestResult) {
+	var failed []string
+	for _, id := range test.subtests {
+		sub := s.TestCases[id]
+		if sub != nil && !sub.End.IsZero() && !sub.SummaryResult.Pass {
+			failed = append(failed, sub.Name)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+	result.Pass = false
+	if result.Details != "" && !strings.HasSuffix(result.Details, "\n") {
+		result.Details += "\n"
+	}
+	result.Details += fmt.Sprintf("%d of %d subtests failed:\n", len(failed), len(test.subtests))
+	for _, name := range failed {
+		result.Details += "  " + name + "\n"
+	}
+}
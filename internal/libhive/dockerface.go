@@ -8,6 +8,8 @@ import (
 	"mime/multipart"
 	"net"
 	"net/http"
+
+	"github.com/ethereum/hive/internal/simapi"
 )
 
 // ContainerBackend captures the docker interactions of the simulation API.
@@ -28,13 +30,37 @@ type ContainerBackend interface {
 	// These methods work with containers.
 	CreateContainer(ctx context.Context, image string, opt ContainerOptions) (string, error)
 	StartContainer(ctx context.Context, containerID string, opt ContainerOptions) (*ContainerInfo, error)
+	StopContainer(containerID string) error // stops without removing the container
 	DeleteContainer(containerID string) error
 	PauseContainer(containerID string) error
 	UnpauseContainer(containerID string) error
 
+	// SnapshotContainer saves the state of a container as an image with the given name.
+	// The image is created with the given labels. It returns the image ID.
+	// DeleteSnapshot removes the image.
+	SnapshotContainer(ctx context.Context, containerID string, name string, labels map[string]string) (string, error)
+	DeleteSnapshot(image string) error
+
+	// DownloadFiles returns a tar archive of a file or directory in the given container.
+	// This also works for containers which have exited but were not deleted yet.
+	DownloadFiles(ctx context.Context, containerID string, path string) (io.ReadCloser, error)
+
 	// RunProgram runs a command in the given container and returns its outputs and exit code.
 	RunProgram(ctx context.Context, containerID string, cmdline []string) (*ExecInfo, error)
 
+	// ShellCommand returns a command line which opens a shell in the given container.
+	// This is printed for the user when clients are kept for debugging.
+	ShellCommand(containerID string) string
+
+	// RunNetworkScript runs a shell script in the network namespace of the given container.
+	// The script may change the network configuration, and the tc tool is available.
+	// The labels are applied to any container created for running the script.
+	RunNetworkScript(ctx context.Context, containerID string, script string, labels map[string]string) (*ExecInfo, error)
+
+	// DialContainer opens a TCP connection to a container address (IP:port). Hive may
+	// not be able to reach containers directly, so this goes through the API proxy.
+	DialContainer(ctx context.Context, addr string) (net.Conn, error)
+
 	// These methods configure docker networks.
 	NetworkNameToID(name string) (string, error)
 	CreateNetwork(name string) (string, error)
@@ -75,6 +101,9 @@ type ContainerOptions struct {
 
 	// Name: Docker container name (optional)
 	Name string
+
+	// Resources: limits of the container. Zero values mean there is no limit.
+	Resources simapi.Resources
 }
 
 // ContainerInfo is returned by StartContainer.
@@ -88,6 +117,15 @@ type ContainerInfo struct {
 	// This must be called for all containers that were started
 	// to avoid resource leaks.
 	Wait func()
+
+	// Usage returns the resource usage of the container since it was started.
+	// This is nil if the backend does not collect container stats.
+	Usage func() ResourceUsage
+
+	// ExitState waits for the container to stop and returns its exit status.
+	// It returns nil if the status is unknown, e.g. because the container was
+	// removed. This is nil if the backend does not report exit status.
+	ExitState func() *ContainerExit
 }
 
 // Builder can build docker images of clients and simulators.
@@ -98,9 +136,23 @@ type Builder interface {
 
 	// ReadFile returns the content of a file in the given image.
 	ReadFile(ctx context.Context, image, path string) ([]byte, error)
+
+	// ImageID returns the ID of a local image. It returns the empty string
+	// if the image does not exist.
+	ImageID(ctx context.Context, image string) (string, error)
 }
 
 // ClientMetadata is metadata to describe the client in more detail, configured with a YAML file in the client dir.
 type ClientMetadata struct {
-	Roles []string `yaml:"roles" json:"roles"`
+	Roles        []string           `yaml:"roles" json:"roles"`
+	Capabilities ClientCapabilities `yaml:"capabilities" json:"capabilities"`
+}
+
+// ClientCapabilities lists the features supported by a client: the forks it can run,
+// the API namespaces it serves and the protocols it implements. API namespaces and
+// protocols are given as "name" or "name/version", e.g. "engine/v3" or "snap/1".
+type ClientCapabilities struct {
+	Forks     []string `yaml:"forks" json:"forks,omitempty"`
+	APIs      []string `yaml:"apis" json:"apis,omitempty"`
+	Protocols []string `yaml:"protocols" json:"protocols,omitempty"`
 }
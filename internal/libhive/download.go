@@ -0,0 +1,126 @@
+package libhive
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ArtifactDir is the directory of test artifacts in the log directory.
+const ArtifactDir = "artifacts"
+
+var errNotRegularFile = errors.New("not a regular file")
+
+// downloadFiles returns a tar archive of a file or directory in a client container.
+// Errors of the backend are returned before any data is read from the archive.
+func (manager *TestManager) downloadFiles(ctx context.Context, containerID, file string) (io.ReadCloser, error) {
+	archive, err := manager.backend.DownloadFiles(ctx, containerID, file)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(archive)
+	if _, err := r.Peek(1); err != nil {
+		archive.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, archive}, nil
+}
+
+// readFile returns the content of a regular file in a tar archive.
+// The archive must contain the file as its first entry.
+func readFile(archive io.Reader) (*tar.Header, io.Reader, error) {
+	tr := tar.NewReader(archive)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, nil, errNotRegularFile
+	}
+	return hdr, tr, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// AttachClientFiles copies a file or directory out of a client container and stores it
+// as an artifact of the test.
+func (manager *TestManager) AttachClientFiles(ctx context.Context, testSuite TestSuiteID, test TestID, nodeID, file string) (*Artifact, error) {
+	node, err := manager.GetNodeInfo(testSuite, test, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := manager.downloadFiles(ctx, node.ID, file)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	base := unsafeFileChars.ReplaceAllString(path.Base(file), "_")
+	artifact := &Artifact{Client: node.Name, ClientID: node.ID, Path: file}
+	err = manager.storeArtifact(test, artifact, fmt.Sprintf("%s-%s-*.tar", node.ID, base), archive)
+	if err != nil {
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// AttachTestFile stores data provided by the simulator as an artifact of the test.
+func (manager *TestManager) AttachTestFile(test TestID, name string, data io.Reader) (*Artifact, error) {
+	if name == "" {
+		return nil, errors.New("artifact has no name")
+	}
+	// The random part of the file name goes before the extension.
+	ext := path.Ext(name)
+	base := unsafeFileChars.ReplaceAllString(strings.TrimSuffix(name, ext), "_")
+	ext = unsafeFileChars.ReplaceAllString(ext, "_")
+	artifact := &Artifact{Name: name}
+	err := manager.storeArtifact(test, artifact, fmt.Sprintf("test%d-%s-*%s", test, base, ext), data)
+	if err != nil {
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// storeArtifact writes an artifact file to the log directory and adds the artifact to
+// the test. The file name is created from pattern as in os.CreateTemp.
+func (manager *TestManager) storeArtifact(test TestID, artifact *Artifact, pattern string, data io.Reader) error {
+	dir := filepath.Join(manager.config.LogDir, ArtifactDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fd, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fd, data)
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fd.Name())
+		return err
+	}
+	artifact.File = path.Join(ArtifactDir, filepath.Base(fd.Name()))
+
+	// Register it in the test.
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+	testCase, ok := manager.runningTestCases[test]
+	if !ok {
+		os.Remove(fd.Name())
+		return ErrNoSuchTestCase
+	}
+	testCase.Artifacts = append(testCase.Artifacts, artifact)
+	return nil
+}
@@ -0,0 +1,157 @@
+package libhive
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	EventSimulationStart = "simulationStart"
+	EventSimulationEnd   = "simulationEnd"
+	EventSuiteStart      = "suiteStart"
+	EventSuiteEnd        = "suiteEnd"
+	EventTestStart       = "testStart"
+	EventTestRetry       = "testRetry"
+	EventTestEnd         = "testEnd"
+	EventClientStart     = "clientStart"
+	EventClientStop      = "clientStop"
+	EventClientCrash     = "clientCrash"
+)
+
+// Event is a progress notification of a simulation run.
+type Event struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Simulator string    `json:"simulator,omitempty"`
+
+	// Suite and test of the event.
+	Suite     *TestSuiteID `json:"suite,omitempty"`
+	SuiteName string       `json:"suiteName,omitempty"`
+	Test      *TestID      `json:"test,omitempty"`
+	TestName  string       `json:"testName,omitempty"`
+
+	// Client of clientStart, clientStop and clientCrash events.
+	ClientID   string `json:"clientId,omitempty"`
+	ClientName string `json:"clientName,omitempty"`
+
+	// Results of testRetry, testEnd and simulationEnd events.
+	Result    *TestResult `json:"result,omitempty"`
+	SimResult *SimResult  `json:"simResult,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// EventFeed delivers events to subscribers.
+// Sending on a nil feed does nothing.
+type EventFeed struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// NewEventFeed creates an event feed.
+func NewEventFeed() *EventFeed {
+	return &EventFeed{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a subscriber. Events are buffered up to the given size. If the
+// subscriber does not keep up, the channel is closed and no more events are delivered.
+func (f *EventFeed) Subscribe(buffer int) (events <-chan Event, unsubscribe func()) {
+	ch := make(chan Event, buffer)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	unsubscribe = func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subs[ch]; ok {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Send delivers an event to all subscribers. It never blocks.
+func (f *EventFeed) Send(ev Event) {
+	if f == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// eventKeepAlive is the interval of keep-alive comments sent to event stream clients.
+const eventKeepAlive = 15 * time.Second
+
+// ServeHTTP streams events as Server-Sent Events.
+func (f *EventFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := f.Subscribe(256)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				// The client was too slow and missed events.
+				return
+			}
+			data, err := json.Marshal(&ev)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// suiteEvent creates an event of a test suite.
+func suiteEvent(typ string, suiteID TestSuiteID, suite *TestSuite) Event {
+	return Event{Type: typ, Suite: &suiteID, SuiteName: suite.Name}
+}
+
+// testEvent creates an event of a test case.
+func testEvent(typ string, suiteID TestSuiteID, testID TestID, test *TestCase) Event {
+	return Event{Type: typ, Suite: &suiteID, Test: &testID, TestName: test.Name}
+}
+
+// clientEvent creates an event of a client container.
+func clientEvent(typ string, suiteID TestSuiteID, testID TestID, clientID, clientName string) Event {
+	return Event{Type: typ, Suite: &suiteID, Test: &testID, ClientID: clientID, ClientName: clientName}
+}
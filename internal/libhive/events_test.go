@@ -0,0 +1,90 @@
+package libhive_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/hive/hivesim"
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// This test checks that the test manager publishes events for suites and tests.
+func TestEvents(t *testing.T) {
+	feed := libhive.NewEventFeed()
+	events, unsubscribe := feed.Subscribe(100)
+	defer unsubscribe()
+
+	suite := hivesim.Suite{Name: "suite"}
+	suite.Add(hivesim.TestSpec{Name: "a", Run: func(t *hivesim.T) {}})
+	suite.Add(hivesim.TestSpec{Name: "b", Run: func(t *hivesim.T) { t.Fatal("b failed") }})
+	runSuite(t, libhive.SimEnv{Events: feed}, suite)
+	unsubscribe()
+
+	var got []string
+	for ev := range events {
+		desc := ev.Type + " " + ev.SuiteName + ev.TestName
+		if ev.Result != nil && !ev.Result.Pass {
+			desc += " (failed)"
+		}
+		got = append(got, desc)
+	}
+	want := []string{
+		"suiteStart suite",
+		"testStart a",
+		"testEnd a",
+		"testStart b",
+		"testEnd b (failed)",
+		"suiteEnd suite",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong events:\n got %q\nwant %q", got, want)
+	}
+}
+
+// This test checks the Server-Sent Events endpoint.
+func TestEventsHTTP(t *testing.T) {
+	feed := libhive.NewEventFeed()
+	srv := httptest.NewServer(feed)
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("wrong content type %q", ct)
+	}
+
+	// Wait for the subscription, then send an event.
+	r := bufio.NewReader(resp.Body)
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(line, ":") {
+		t.Fatalf("unexpected first line %q (err %v)", line, err)
+	}
+	feed.Send(libhive.Event{Type: libhive.EventSimulationStart, Simulator: "sim"})
+
+	var lines []string
+	for len(lines) < 2 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line = strings.TrimSuffix(line, "\n"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if lines[0] != "event: simulationStart" {
+		t.Fatalf("wrong event line %q", lines[0])
+	}
+	var ev libhive.Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != libhive.EventSimulationStart || ev.Simulator != "sim" || ev.Time.IsZero() {
+		t.Fatalf("wrong event %+v", ev)
+	}
+}
@@ -0,0 +1,328 @@
+package libhive
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Supported result export formats.
+const (
+	FormatJUnit = "junit"
+	FormatTAP   = "tap"
+)
+
+// ParseResultFormats parses a comma-separated list of export formats.
+func ParseResultFormats(list string) ([]string, error) {
+	var formats []string
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+		switch f {
+		case "":
+			continue
+		case FormatJUnit, FormatTAP:
+			formats = append(formats, f)
+		default:
+			return nil, fmt.Errorf("unknown result format %q", f)
+		}
+	}
+	return formats, nil
+}
+
+// ExportFileName returns the name of the exported file for a suite file.
+// Formats other than JUnit and TAP use the format name as the file extension.
+func ExportFileName(suiteFile, format string) string {
+	base := strings.TrimSuffix(suiteFile, ".json")
+	switch format {
+	case FormatJUnit:
+		return base + ".xml"
+	case FormatTAP:
+		return base + ".tap"
+	default:
+		return base + "." + format
+	}
+}
+
+// ExportSuite writes the suite in the given format. The test logs are read from fsys,
+// which must contain the results directory.
+func ExportSuite(w io.Writer, format string, suite *TestSuite, fsys fs.FS) error {
+	switch format {
+	case FormatJUnit:
+		return WriteJUnit(w, fsys, suite)
+	case FormatTAP:
+		return WriteTAP(w, fsys, suite)
+	default:
+		return fmt.Errorf("unknown result format %q", format)
+	}
+}
+
+// TestDetails returns the log output of a test result. The log is read from the details
+// log of the suite if the result has log offsets.
+func TestDetails(fsys fs.FS, suite *TestSuite, result TestResult) (string, error) {
+	if result.LogOffsets == nil || suite.TestDetailsLog == "" {
+		return result.Details, nil
+	}
+	f, err := fsys.Open(path.Clean(suite.TestDetailsLog))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		return "", fmt.Errorf("details log %s does not support random access", suite.TestDetailsLog)
+	}
+	begin, end := result.LogOffsets.Begin, result.LogOffsets.End
+	if begin < 0 || end < begin {
+		return "", fmt.Errorf("invalid log offsets %d-%d in %s", begin, end, suite.TestDetailsLog)
+	}
+	buf := make([]byte, end-begin)
+	if _, err := ra.ReadAt(buf, begin); err != nil && err != io.EOF {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// exportedTest is a test case of a suite being exported.
+type exportedTest struct {
+	*TestCase
+	details string
+}
+
+// exportTests returns the test cases of a suite, ordered by ID. Multi-test context
+// entries are skipped because they are not test results. Tests whose log can't be
+// read are exported without it.
+func exportTests(fsys fs.FS, suite *TestSuite) []exportedTest {
+	ids := make([]TestID, 0, len(suite.TestCases))
+	for id, test := range suite.TestCases {
+		if !test.MultiTestContext {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	tests := make([]exportedTest, len(ids))
+	for i, id := range ids {
+		test := suite.TestCases[id]
+		tests[i] = exportedTest{TestCase: test}
+		if !test.SummaryResult.Pass || test.SummaryResult.Skipped {
+			details, err := TestDetails(fsys, suite, test.SummaryResult)
+			if err != nil {
+				slog.Warn("can't read test details", "suite", suite.Name, "test", test.Name, "err", err)
+			}
+			tests[i].details = details
+		}
+	}
+	return tests
+}
+
+func testDuration(test *TestCase) time.Duration {
+	if test.Start.IsZero() || test.End.Before(test.Start) {
+		return 0
+	}
+	return test.End.Sub(test.Start)
+}
+
+func sortedClientVersions(suite *TestSuite) []string {
+	clients := make([]string, 0, len(suite.ClientVersions))
+	for client := range suite.ClientVersions {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	return clients
+}
+
+// JUnit XML output.
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr,omitempty"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	ClassName  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitFailure    `xml:"failure,omitempty"`
+	Skipped    *junitSkipped    `xml:"skipped,omitempty"`
+}
+
+// junitProperties is the properties element of a test case. It is a separate type
+// because encoding/xml writes the parent element of an empty "a>b" field.
+type junitProperties struct {
+	Property []junitProperty `xml:"property"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes suites as JUnit XML.
+func WriteJUnit(w io.Writer, fsys fs.FS, suites ...*TestSuite) error {
+	var out junitTestSuites
+	for _, suite := range suites {
+		tests := exportTests(fsys, suite)
+		js := junitTestSuite{Name: suite.Name, Tests: len(tests)}
+		for _, client := range sortedClientVersions(suite) {
+			js.Properties = append(js.Properties, junitProperty{
+				Name:  "client." + client,
+				Value: suite.ClientVersions[client],
+			})
+		}
+		var start, end time.Time
+		for _, test := range tests {
+			if start.IsZero() || test.Start.Before(start) {
+				start = test.Start
+			}
+			if test.End.After(end) {
+				end = test.End
+			}
+			tc := junitTestCase{
+				Name:       test.Name,
+				ClassName:  suite.Name,
+				Time:       junitSeconds(testDuration(test.TestCase)),
+				Properties: junitClientProperties(suite, test.TestCase),
+			}
+			if test.SummaryResult.Skipped {
+				js.Skipped++
+				tc.Skipped = &junitSkipped{Message: skipReason(test.details)}
+			}
+			if !test.SummaryResult.Pass {
+				js.Failures++
+				tc.Failure = &junitFailure{Message: "test failed", Type: "failure", Text: test.details}
+				if test.SummaryResult.Timeout {
+					tc.Failure.Message, tc.Failure.Type = "test timed out", "timeout"
+				}
+			}
+			js.TestCases = append(js.TestCases, tc)
+		}
+		if !start.IsZero() {
+			js.Timestamp = start.UTC().Format("2006-01-02T15:04:05")
+			js.Time = junitSeconds(end.Sub(start))
+		} else {
+			js.Time = junitSeconds(0)
+		}
+		out.Suites = append(out.Suites, js)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitClientProperties returns the versions of the clients used by a test.
+func junitClientProperties(suite *TestSuite, test *TestCase) *junitProperties {
+	names := make(map[string]struct{})
+	for _, client := range test.ClientInfo {
+		names[client.Name] = struct{}{}
+	}
+	var props []junitProperty
+	for _, client := range sortedClientVersions(suite) {
+		if _, ok := names[client]; ok {
+			props = append(props, junitProperty{Name: "client." + client, Value: suite.ClientVersions[client]})
+		}
+	}
+	if len(props) == 0 {
+		return nil
+	}
+	return &junitProperties{Property: props}
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteTAP writes suites in the Test Anything Protocol format (version 13).
+func WriteTAP(w io.Writer, fsys fs.FS, suites ...*TestSuite) error {
+	var (
+		b     strings.Builder
+		total int
+	)
+	for _, suite := range suites {
+		tests := exportTests(fsys, suite)
+		fmt.Fprintf(&b, "# suite: %s\n", suite.Name)
+		for _, client := range sortedClientVersions(suite) {
+			fmt.Fprintf(&b, "# client %s: %s\n", client, suite.ClientVersions[client])
+		}
+		for _, test := range tests {
+			total++
+			status := "ok"
+			if !test.SummaryResult.Pass {
+				status = "not ok"
+			}
+			if test.SummaryResult.Skipped {
+				fmt.Fprintf(&b, "ok %d - %s # SKIP %s\n", total, tapDescription(suite.Name+": "+test.Name), tapDescription(skipReason(test.details)))
+				continue
+			}
+			fmt.Fprintf(&b, "%s %d - %s\n", status, total, tapDescription(suite.Name+": "+test.Name))
+			b.WriteString("  ---\n")
+			fmt.Fprintf(&b, "  duration_ms: %d\n", testDuration(test.TestCase).Milliseconds())
+			if test.SummaryResult.Timeout {
+				b.WriteString("  timeout: true\n")
+			}
+			if test.SummaryResult.Flaky {
+				b.WriteString("  flaky: true\n")
+			}
+			if test.details != "" {
+				b.WriteString("  details: |\n")
+				for _, line := range strings.Split(strings.TrimRight(test.details, "\n"), "\n") {
+					b.WriteString("    " + line + "\n")
+				}
+			}
+			b.WriteString("  ...\n")
+		}
+	}
+	_, err := fmt.Fprintf(w, "TAP version 13\n1..%d\n%s", total, b.String())
+	return err
+}
+
+// skipReason returns the last line of the log of a skipped test, which is the
+// message passed to t.Skip.
+func skipReason(details string) string {
+	details = strings.TrimRight(details, "\n")
+	if i := strings.LastIndexByte(details, '\n'); i >= 0 {
+		return details[i+1:]
+	}
+	return details
+}
+
+// tapDescription escapes characters which have a special meaning in TAP test lines.
+func tapDescription(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	return strings.ReplaceAll(s, "#", "\\#")
+}
@@ -0,0 +1,134 @@
+package libhive
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func exportTestSuite() (*TestSuite, fstest.MapFS) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	details := "first line\nsecond line\n"
+	suite := &TestSuite{
+		Name:           "suite",
+		ClientVersions: map[string]string{"go-ethereum": "v1.2.3"},
+		TestDetailsLog: "details/suite.log",
+		TestCases: map[TestID]*TestCase{
+			1: {
+				Name:          "pass",
+				Start:         start,
+				End:           start.Add(1500 * time.Millisecond),
+				SummaryResult: TestResult{Pass: true},
+			},
+			2: {
+				Name:  "fail",
+				Start: start.Add(2 * time.Second),
+				End:   start.Add(3 * time.Second),
+				SummaryResult: TestResult{
+					LogOffsets: &TestLogOffsets{Begin: 4, End: 4 + int64(len(details))},
+				},
+				ClientInfo: map[string]*ClientInfo{
+					"abcdef12": {ID: "abcdef12", Name: "go-ethereum"},
+					"12abcdef": {ID: "12abcdef", Name: "go-ethereum"},
+				},
+			},
+			4: {
+				Name:          "skip",
+				Start:         start.Add(3 * time.Second),
+				End:           start.Add(3 * time.Second),
+				SummaryResult: TestResult{Pass: true, Skipped: true, Details: "starting\nnot supported by client\n"},
+			},
+			3: {
+				Name:             "context",
+				MultiTestContext: true,
+				SummaryResult:    TestResult{Pass: true},
+			},
+		},
+	}
+	fsys := fstest.MapFS{
+		"details/suite.log": {Data: []byte("xxx\n" + details)},
+	}
+	return suite, fsys
+}
+
+func TestWriteJUnit(t *testing.T) {
+	suite, fsys := exportTestSuite()
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, fsys, suite); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="suite" tests="3" failures="1" skipped="1" time="3.000" timestamp="2024-01-02T03:04:05">
+    <properties>
+      <property name="client.go-ethereum" value="v1.2.3"></property>
+    </properties>
+    <testcase name="pass" classname="suite" time="1.500"></testcase>
+    <testcase name="fail" classname="suite" time="1.000">
+      <properties>
+        <property name="client.go-ethereum" value="v1.2.3"></property>
+      </properties>
+      <failure message="test failed" type="failure">first line&#xA;second line&#xA;</failure>
+    </testcase>
+    <testcase name="skip" classname="suite" time="0.000">
+      <skipped message="not supported by client"></skipped>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if buf.String() != want {
+		t.Errorf("wrong output:\n%s", buf.String())
+	}
+}
+
+func TestWriteTAP(t *testing.T) {
+	suite, fsys := exportTestSuite()
+	var buf bytes.Buffer
+	if err := WriteTAP(&buf, fsys, suite); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"TAP version 13",
+		"1..3",
+		"# suite: suite",
+		"# client go-ethereum: v1.2.3",
+		"ok 1 - suite: pass",
+		"  ---",
+		"  duration_ms: 1500",
+		"  ...",
+		"not ok 2 - suite: fail",
+		"  ---",
+		"  duration_ms: 1000",
+		"  details: |",
+		"    first line",
+		"    second line",
+		"  ...",
+		"ok 3 - suite: skip # SKIP not supported by client",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("wrong output:\n%s", buf.String())
+	}
+}
+
+// This test checks that tests with unreadable logs are exported without the log.
+func TestExportInvalidLogOffsets(t *testing.T) {
+	suite, fsys := exportTestSuite()
+	suite.TestCases[2].SummaryResult.LogOffsets = &TestLogOffsets{Begin: 10, End: 4}
+
+	if _, err := TestDetails(fsys, suite, suite.TestCases[2].SummaryResult); err == nil {
+		t.Fatal("TestDetails: expected error for invalid offsets")
+	}
+	var buf bytes.Buffer
+	if err := WriteTAP(&buf, fsys, suite); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "not ok 2 - suite: fail\n") {
+		t.Errorf("failed test missing from output:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "details:") {
+		t.Errorf("output contains details of unreadable log:\n%s", buf.String())
+	}
+}
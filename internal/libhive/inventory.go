@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/ethereum/hive/internal/simapi"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 	"gopkg.in/yaml.v3"
@@ -196,6 +197,10 @@ type ClientDesignator struct {
 
 	// Arguments passed to the docker build.
 	BuildArgs map[string]string `yaml:"build_args,omitempty" json:"build_args,omitempty"`
+
+	// Resources are the default resource limits of client containers.
+	// They can be overridden by the simulator when starting a client.
+	Resources *simapi.Resources `yaml:"resources,omitempty" json:"resources,omitempty"`
 }
 
 func (c ClientDesignator) buildString() string {
@@ -233,6 +238,11 @@ func (c ClientDesignator) Name() string {
 	return c.Client + "_" + c.Nametag
 }
 
+// ImageTag returns the docker image name of the client.
+func (c ClientDesignator) ImageTag() string {
+	return fmt.Sprintf("hive/clients/%s:latest", c.Name())
+}
+
 // ParseClientList reads a comma-separated list of client names. Each client name may
 // optionally contain a branch/tag specifier separated from the name by underscore, e.g.
 // "besu_nightly".
@@ -2,12 +2,14 @@ package libhive
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/ethereum/hive/internal/simapi"
 )
 
 func TestParseClientDesignator(t *testing.T) {
@@ -145,13 +147,17 @@ func TestParseClientListYAML(t *testing.T) {
     github: org/repository
 - client: supereth3000
   nametag: thebest
+  resources:
+    cpus: 1.5
+    memory: 4294967296
+    pids: 512
 `
 
 	expectedOutput := []ClientDesignator{
 		{Client: "go-ethereum", Nametag: "custom", DockerfileExt: "git", BuildArgs: map[string]string{"tag": "custom"}},
 		{Client: "go-ethereum", DockerfileExt: "local"},
 		{Client: "supereth3000", Nametag: "github_org/repository", BuildArgs: map[string]string{"github": "org/repository"}},
-		{Client: "supereth3000", Nametag: "thebest"},
+		{Client: "supereth3000", Nametag: "thebest", Resources: &simapi.Resources{CPUs: 1.5, Memory: 4 << 30, Pids: 512}},
 	}
 
 	var inv Inventory
@@ -183,3 +189,41 @@ func TestLoadInventory(t *testing.T) {
 	t.Log("clients:", spew.Sdump(inv.Clients))
 	t.Log("simulators:", inv.Simulators)
 }
+
+func TestLoadClientMetadata(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hive.yaml")
+	content := `
+roles:
+  - "eth1"
+capabilities:
+  forks: ["Cancun", "Prague"]
+  apis: ["eth", "engine/v4", "graphql"]
+  protocols: ["eth/68", "snap/1", "discv5"]
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	md, err := loadClientMetadata(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ClientMetadata{
+		Roles: []string{"eth1"},
+		Capabilities: ClientCapabilities{
+			Forks:     []string{"Cancun", "Prague"},
+			APIs:      []string{"eth", "engine/v4", "graphql"},
+			Protocols: []string{"eth/68", "snap/1", "discv5"},
+		},
+	}
+	if !reflect.DeepEqual(md, want) {
+		t.Fatalf("wrong metadata: %s", spew.Sdump(md))
+	}
+
+	// Unknown capability kinds are rejected.
+	if err := os.WriteFile(file, []byte("capabilities:\n  features: [\"x\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadClientMetadata(file); err == nil {
+		t.Fatal("expected error for unknown capability kind")
+	}
+}
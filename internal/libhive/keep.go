@@ -0,0 +1,154 @@
+package libhive
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+)
+
+// FailedClient is a client container of a failed test.
+type FailedClient struct {
+	Simulator string
+	Suite     string
+	Test      string
+	Name      string // client name
+	ID        string // container ID
+	IP        string
+	Shell     string // command for opening a shell in the container
+
+	wait func() // nil if the container is not owned by the test
+}
+
+// failedClients returns the clients of a test.
+// This must be called with testCaseMutex held.
+func (manager *TestManager) failedClients(suite *TestSuite, test *TestCase) []*FailedClient {
+	var clients []*FailedClient
+	for _, v := range test.ClientInfo {
+		clients = append(clients, &FailedClient{
+			Simulator: manager.simulator,
+			Suite:     suite.Name,
+			Test:      test.Name,
+			Name:      v.Name,
+			ID:        v.ID,
+			IP:        v.IP,
+			Shell:     manager.backend.ShellCommand(v.ID),
+			wait:      v.wait,
+		})
+	}
+	return clients
+}
+
+// pauseOnFailure calls the PauseOnFailure hook for a failed test.
+// The test's clients are still running while the hook runs.
+func (manager *TestManager) pauseOnFailure(suiteID TestSuiteID, testID TestID) {
+	manager.testCaseMutex.RLock()
+	suite, ok1 := manager.runningTestSuites[suiteID]
+	test, ok2 := manager.runningTestCases[testID]
+	var clients []*FailedClient
+	if ok1 && ok2 {
+		clients = manager.failedClients(suite, test)
+	}
+	manager.testCaseMutex.RUnlock()
+
+	if len(clients) > 0 {
+		slog.Info("pausing simulation after test failure", "test", test.Name)
+		manager.config.PauseOnFailure(clients)
+	}
+}
+
+// keepClients takes ownership of the clients of a failed test, so they are not
+// stopped when the test ends. This must be called with testCaseMutex held.
+func (manager *TestManager) keepClients(suite *TestSuite, test *TestCase) {
+	manager.keptMutex.Lock()
+	defer manager.keptMutex.Unlock()
+
+	for _, c := range manager.failedClients(suite, test) {
+		if c.wait == nil {
+			continue // not owned by this test
+		}
+		slog.Info("keeping client of failed test", "test", test.Name, "client", c.Name, "container", c.ID)
+		manager.keptClients = append(manager.keptClients, c)
+		manager.keptSuites[suite.ID] = true
+	}
+	for _, v := range test.ClientInfo {
+		if v.wait != nil {
+			v.state.stopping = true
+			v.wait = nil
+		}
+	}
+}
+
+// hasKeptClients reports whether clients of the suite were kept running.
+func (manager *TestManager) hasKeptClients(testSuite TestSuiteID) bool {
+	manager.keptMutex.Lock()
+	defer manager.keptMutex.Unlock()
+	return manager.keptSuites[testSuite]
+}
+
+// keepNetworks keeps the networks of a suite with kept clients.
+func (manager *TestManager) keepNetworks(testSuite TestSuiteID) {
+	manager.networkMutex.Lock()
+	networks := manager.networks[testSuite]
+	delete(manager.networks, testSuite)
+	delete(manager.netemNodes, testSuite)
+	manager.networkMutex.Unlock()
+
+	manager.keptMutex.Lock()
+	defer manager.keptMutex.Unlock()
+	for _, id := range networks {
+		manager.keptNetworks = append(manager.keptNetworks, id)
+	}
+}
+
+// KeptClients returns the clients of failed tests which are still running.
+func (r *Runner) KeptClients() []*FailedClient {
+	r.keptMutex.Lock()
+	defer r.keptMutex.Unlock()
+	return r.keptClients
+}
+
+// addKept takes over the kept clients and networks of a test manager.
+func (r *Runner) addKept(tm *TestManager) {
+	tm.keptMutex.Lock()
+	defer tm.keptMutex.Unlock()
+	r.keptMutex.Lock()
+	defer r.keptMutex.Unlock()
+
+	r.keptClients = append(r.keptClients, tm.keptClients...)
+	r.keptNetworks = append(r.keptNetworks, tm.keptNetworks...)
+	tm.keptClients, tm.keptNetworks = nil, nil
+}
+
+// RemoveKeptClients stops the kept clients and removes their networks.
+func (r *Runner) RemoveKeptClients() {
+	r.keptMutex.Lock()
+	clients, networks := r.keptClients, r.keptNetworks
+	r.keptClients, r.keptNetworks = nil, nil
+	r.keptMutex.Unlock()
+
+	for _, c := range clients {
+		slog.Info("removing kept client", "client", c.Name, "container", c.ID)
+		r.container.DeleteContainer(c.ID)
+		c.wait()
+	}
+	for _, id := range networks {
+		if err := r.container.RemoveNetwork(id); err != nil {
+			slog.Error("could not remove network", "id", id, "err", err)
+		}
+	}
+}
+
+// PrintFailedClients writes a description of the given clients, including commands
+// for inspecting them.
+func PrintFailedClients(w io.Writer, clients []*FailedClient) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range clients {
+		shell := c.Shell
+		if shell == "" {
+			shell = c.ID
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.Test, c.Name, c.IP, shell)
+	}
+	tw.Flush()
+}
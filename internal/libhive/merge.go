@@ -0,0 +1,207 @@
+package libhive
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// shardSuite is a suite result of one shard.
+type shardSuite struct {
+	dir   string
+	suite *TestSuite
+}
+
+// MergeResults combines the results of hive runs which ran different shards of the
+// same simulators (see --sim.shard) into a single results directory. Suites with the
+// same name are merged into one suite file. Tests are numbered again, and their logs
+// are written to a new details file of the suite, so result viewers work unchanged.
+// The client logs, simulator logs, artifacts and RPC transcripts referenced by the
+// results are copied to outputDir.
+//
+// Tests which run in every shard, such as hivesim tests with AlwaysRun set, appear
+// once for each shard.
+//
+// MergeResults returns the names of the written suite files.
+func MergeResults(outputDir string, shardDirs []string) ([]string, error) {
+	if len(shardDirs) == 0 {
+		return nil, errors.New("no result directories given")
+	}
+	var (
+		names  []string
+		groups = make(map[string][]shardSuite)
+	)
+	for _, dir := range shardDirs {
+		suites, err := readSuiteDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(suites) == 0 {
+			return nil, fmt.Errorf("no suite files in %s", dir)
+		}
+		for _, suite := range suites {
+			if _, ok := groups[suite.Name]; !ok {
+				names = append(names, suite.Name)
+			}
+			groups[suite.Name] = append(groups[suite.Name], shardSuite{dir, suite})
+		}
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, err
+	}
+	var files []string
+	for i, name := range names {
+		file, err := mergeSuites(outputDir, TestSuiteID(i), groups[name])
+		if err != nil {
+			return files, fmt.Errorf("suite %q: %v", name, err)
+		}
+		files = append(files, file)
+	}
+	// Keep the instance info of the first run.
+	if err := copyResultFile(shardDirs[0], outputDir, "hive.json"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return files, err
+	}
+	return files, nil
+}
+
+// mergeSuites writes the merged suite file of the given shard results.
+func mergeSuites(outputDir string, id TestSuiteID, parts []shardSuite) (string, error) {
+	first := parts[0].suite
+	merged := &TestSuite{
+		ID:             id,
+		Name:           first.Name,
+		Description:    first.Description,
+		ClientVersions: make(map[string]string),
+		RunMetadata:    first.RunMetadata,
+		TestCases:      make(map[TestID]*TestCase),
+		SimulatorLog:   first.SimulatorLog,
+		TestDetailsLog: fmt.Sprintf("details/%d-merged-%d.log", time.Now().Unix(), id),
+	}
+	detailsFile := filepath.Join(outputDir, filepath.FromSlash(merged.TestDetailsLog))
+	if err := os.MkdirAll(filepath.Dir(detailsFile), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(detailsFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	merged.testDetailsFile = f
+
+	var nextID TestID
+	for _, part := range parts {
+		for name, version := range part.suite.ClientVersions {
+			if _, ok := merged.ClientVersions[name]; !ok {
+				merged.ClientVersions[name] = version
+			}
+		}
+		copyMergedFile(part.dir, outputDir, part.suite.SimulatorLog)
+
+		// Assign new IDs in the order of the old ones.
+		oldIDs := slices.Sorted(maps.Keys(part.suite.TestCases))
+		newIDs := make(map[TestID]TestID, len(oldIDs))
+		for _, oldID := range oldIDs {
+			nextID++
+			newIDs[oldID] = nextID
+		}
+
+		fsys := os.DirFS(part.dir)
+		for _, oldID := range oldIDs {
+			test := *part.suite.TestCases[oldID]
+			test.Parent = newIDs[test.Parent]
+			test.SummaryResult, err = mergeTestResult(fsys, part.suite, merged, test.Name, test.SummaryResult)
+			if err != nil {
+				return "", err
+			}
+			test.Attempts, err = mergeAttempts(fsys, part.suite, merged, test.Name, test.Attempts)
+			if err != nil {
+				return "", err
+			}
+			copyMergedTestFiles(part.dir, outputDir, &test)
+			merged.TestCases[newIDs[oldID]] = &test
+		}
+	}
+	return writeSuiteFile(merged, outputDir)
+}
+
+// mergeTestResult moves the log of a test result into the details file of the
+// merged suite.
+func mergeTestResult(fsys fs.FS, from, to *TestSuite, name string, result TestResult) (TestResult, error) {
+	text, err := TestDetails(fsys, from, result)
+	if err != nil {
+		return result, fmt.Errorf("can't read log of test %q: %v", name, err)
+	}
+	result.Details = ""
+	result.LogOffsets = nil
+	if text != "" {
+		result.LogOffsets = to.writeTestDetails(name, text)
+	}
+	return result, nil
+}
+
+// mergeAttempts moves the logs of the failed attempts of a test, and of the subtests
+// of each attempt, into the details file of the merged suite.
+func mergeAttempts(fsys fs.FS, from, to *TestSuite, name string, attempts []*TestAttempt) ([]*TestAttempt, error) {
+	result := make([]*TestAttempt, len(attempts))
+	for i, a := range attempts {
+		var err error
+		attempt := *a
+		attemptName := fmt.Sprintf("%s (attempt %d)", name, i+1)
+		if attempt.Result, err = mergeTestResult(fsys, from, to, attemptName, attempt.Result); err != nil {
+			return nil, err
+		}
+		if a.Subtests != nil {
+			attempt.Subtests = make(map[TestID]*TestCase, len(a.Subtests))
+			for id, sub := range a.Subtests {
+				test := *sub
+				if test.SummaryResult, err = mergeTestResult(fsys, from, to, test.Name, test.SummaryResult); err != nil {
+					return nil, err
+				}
+				if test.Attempts, err = mergeAttempts(fsys, from, to, test.Name, test.Attempts); err != nil {
+					return nil, err
+				}
+				attempt.Subtests[id] = &test
+			}
+		}
+		result[i] = &attempt
+	}
+	return result, nil
+}
+
+// copyMergedTestFiles copies the client logs and artifacts of a test into the merged
+// results, including those of failed attempts.
+func copyMergedTestFiles(srcDir, dstDir string, test *TestCase) {
+	copyMergedClientFiles(srcDir, dstDir, test.ClientInfo)
+	for _, artifact := range test.Artifacts {
+		copyMergedFile(srcDir, dstDir, artifact.File)
+	}
+	for _, attempt := range test.Attempts {
+		copyMergedClientFiles(srcDir, dstDir, attempt.ClientInfo)
+		for _, sub := range attempt.Subtests {
+			copyMergedTestFiles(srcDir, dstDir, sub)
+		}
+	}
+}
+
+// copyMergedClientFiles copies the log files of clients into the merged results.
+func copyMergedClientFiles(srcDir, dstDir string, clients map[string]*ClientInfo) {
+	for _, client := range clients {
+		copyMergedFile(srcDir, dstDir, client.LogFile)
+		copyMergedFile(srcDir, dstDir, client.RPCTranscript)
+	}
+}
+
+// copyMergedFile copies a file referenced by a result. Missing files are reported, but
+// they don't stop the merge.
+func copyMergedFile(srcDir, dstDir, file string) {
+	if err := copyResultFile(srcDir, dstDir, file); err != nil {
+		slog.Warn("could not copy result file", "dir", srcDir, "file", file, "err", err)
+	}
+}
@@ -0,0 +1,97 @@
+package libhive_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/hive/hivesim"
+	"github.com/ethereum/hive/internal/fakes"
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// This test checks that the results of sharded runs are merged into one suite,
+// and that test logs can be read from the merged details file.
+func TestMergeResults(t *testing.T) {
+	suite := hivesim.Suite{Name: "suite"}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		suite.Add(hivesim.TestSpec{Name: name, Run: func(t *hivesim.T) {
+			t.Log("output of " + name)
+		}})
+	}
+	suite.Add(hivesim.TestSpec{Name: "setup", AlwaysRun: true, Run: func(t *hivesim.T) {
+		for _, name := range []string{"sub-1", "sub-2", "sub-3"} {
+			t.Run(hivesim.TestSpec{Name: name, Run: func(t *hivesim.T) {
+				t.Log("output of " + name)
+			}})
+		}
+	}})
+
+	shardDirs := []string{t.TempDir(), t.TempDir()}
+	for i, dir := range shardDirs {
+		runShard(t, dir, fmt.Sprintf("%d/%d", i+1, len(shardDirs)), suite)
+	}
+	outputDir := t.TempDir()
+	files, err := libhive.MergeResults(outputDir, shardDirs)
+	if err != nil {
+		t.Fatal("MergeResults failed:", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("wrong number of merged suite files: %d", len(files))
+	}
+
+	result := readSuiteFiles(t, outputDir)
+	if len(result) != 1 {
+		t.Fatalf("wrong number of suite files %d", len(result))
+	}
+	merged := result[0]
+	details, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(merged.TestDetailsLog)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for id, test := range merged.TestCases {
+		names = append(names, test.Name)
+		if test.Name == "setup" {
+			continue
+		}
+		offsets := test.SummaryResult.LogOffsets
+		if offsets == nil {
+			t.Errorf("test %s has no log offsets", test.Name)
+			continue
+		}
+		if text := string(details[offsets.Begin:offsets.End]); text != "output of "+test.Name+"\n" {
+			t.Errorf("wrong details of test %s (%d): %q", test.Name, id, text)
+		}
+		if test.Parent != 0 {
+			if parent := merged.TestCases[test.Parent]; parent == nil || parent.Name != "setup" {
+				t.Errorf("wrong parent %d of test %s", test.Parent, test.Name)
+			}
+		}
+	}
+	slices.Sort(names)
+	want := []string{"a", "b", "c", "d", "e", "f", "setup", "setup", "sub-1", "sub-2", "sub-3"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatal("wrong tests in merged suite:", names)
+	}
+}
+
+func runShard(t *testing.T, logdir, shard string, suite hivesim.Suite) {
+	backend := fakes.NewContainerBackend(nil)
+	tm := libhive.NewTestManager(libhive.SimEnv{LogDir: logdir}, backend, nil, libhive.HiveInfo{})
+	srv := httptest.NewServer(tm.API())
+	defer srv.Close()
+
+	sim := hivesim.NewAt(srv.URL)
+	sim.SetShard(shard)
+	if err := hivesim.RunSuite(sim, suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	if err := tm.Terminate(); err != nil {
+		t.Fatal("terminate failed:", err)
+	}
+}
@@ -0,0 +1,215 @@
+package libhive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ethereum/hive/internal/simapi"
+)
+
+// maxPeerConditions is the max number of peers with network conditions. The tc prio qdisc
+// supports 16 bands, and one of them is used for traffic to all other destinations.
+const maxPeerConditions = 15
+
+// networkConditionsName is reserved, it can't be used as a network name because it
+// collides with the network conditions endpoint.
+const networkConditionsName = "conditions"
+
+var errTooManyPeers = fmt.Errorf("too many peer conditions (max %d)", maxPeerConditions)
+
+// netemScript creates the shell script which applies network conditions to all network
+// interfaces of a container. peerIPs contains the IP addresses of each peer in
+// cond.Peers. When cond is nil, the script removes all conditions.
+func netemScript(cond *simapi.NetworkConditions, peerIPs [][]string) string {
+	var b strings.Builder
+	b.WriteString("for dev in $(ls /sys/class/net); do\n")
+	b.WriteString("  [ \"$dev\" = lo ] && continue\n")
+	b.WriteString("  tc qdisc del dev $dev root 2>/dev/null || true\n")
+	if cond != nil {
+		bands := max(len(cond.Peers)+1, 2)
+		fmt.Fprintf(&b, "  tc qdisc add dev $dev root handle 1: prio bands %d priomap%s || exit 1\n", bands, strings.Repeat(" 0", 16))
+		fmt.Fprintf(&b, "  tc qdisc add dev $dev parent 1:1 handle 10: netem%s || exit 1\n", netemArgs(cond.All, false))
+		for i, peer := range cond.Peers {
+			class := i + 2
+			fmt.Fprintf(&b, "  tc qdisc add dev $dev parent 1:%d handle %d: netem%s || exit 1\n", class, class+10, netemArgs(peer.LinkConditions, peer.Partition))
+			for _, ip := range peerIPs[i] {
+				fmt.Fprintf(&b, "  tc filter add dev $dev parent 1: protocol ip prio 1 u32 match ip dst %s/32 flowid 1:%d || exit 1\n", ip, class)
+			}
+		}
+	}
+	b.WriteString("done\n")
+	return b.String()
+}
+
+// netemArgs returns the netem qdisc parameters of a link.
+func netemArgs(link simapi.LinkConditions, drop bool) string {
+	var args string
+	if link.Latency > 0 || link.Jitter > 0 {
+		args += fmt.Sprintf(" delay %dms", link.Latency)
+		if link.Jitter > 0 {
+			args += fmt.Sprintf(" %dms", link.Jitter)
+		}
+	}
+	switch {
+	case drop:
+		args += " loss 100%"
+	case link.Loss > 0:
+		args += fmt.Sprintf(" loss %g%%", link.Loss)
+	}
+	if link.Bandwidth > 0 {
+		args += fmt.Sprintf(" rate %dkbit", link.Bandwidth)
+	}
+	return args
+}
+
+func validateLink(link simapi.LinkConditions) error {
+	if link.Loss < 0 || link.Loss > 100 {
+		return fmt.Errorf("invalid packet loss %g%%", link.Loss)
+	}
+	return nil
+}
+
+// SetNetworkConditions applies network conditions to the traffic sent by a container.
+// The conditions replace any conditions set previously.
+func (manager *TestManager) SetNetworkConditions(ctx context.Context, testSuite TestSuiteID, containerID string, cond *simapi.NetworkConditions) error {
+	if _, ok := manager.IsTestSuiteRunning(testSuite); !ok {
+		return ErrNoSuchTestSuite
+	}
+	if len(cond.Peers) > maxPeerConditions {
+		return errTooManyPeers
+	}
+	containerID, err := manager.suiteNodeID(testSuite, containerID)
+	if err != nil {
+		return err
+	}
+	if err := validateLink(cond.All); err != nil {
+		return err
+	}
+	peerIPs := make([][]string, len(cond.Peers))
+	for i, peer := range cond.Peers {
+		if err := validateLink(peer.LinkConditions); err != nil {
+			return fmt.Errorf("peer %s: %v", peer.Node, err)
+		}
+		peerID, err := manager.suiteNodeID(testSuite, peer.Node)
+		if err != nil {
+			return fmt.Errorf("peer %s: %w", peer.Node, err)
+		}
+		ips := manager.nodeIPs(testSuite, peerID)
+		if len(ips) == 0 {
+			return fmt.Errorf("peer %s has no IP address", peer.Node)
+		}
+		peerIPs[i] = ips
+	}
+
+	if err := manager.runNetemScript(ctx, containerID, netemScript(cond, peerIPs)); err != nil {
+		return err
+	}
+	manager.networkMutex.Lock()
+	defer manager.networkMutex.Unlock()
+	if manager.netemNodes[testSuite] == nil {
+		manager.netemNodes[testSuite] = make(map[string]struct{})
+	}
+	manager.netemNodes[testSuite][containerID] = struct{}{}
+	return nil
+}
+
+// ClearNetworkConditions removes the network conditions of a container.
+func (manager *TestManager) ClearNetworkConditions(ctx context.Context, testSuite TestSuiteID, containerID string) error {
+	if _, ok := manager.IsTestSuiteRunning(testSuite); !ok {
+		return ErrNoSuchTestSuite
+	}
+	containerID, err := manager.suiteNodeID(testSuite, containerID)
+	if err != nil {
+		return err
+	}
+	if err := manager.runNetemScript(ctx, containerID, netemScript(nil, nil)); err != nil {
+		return err
+	}
+	manager.networkMutex.Lock()
+	defer manager.networkMutex.Unlock()
+	delete(manager.netemNodes[testSuite], containerID)
+	return nil
+}
+
+// clearSuiteNetworkConditions removes the network conditions of all containers in a
+// suite. Containers which no longer exist are skipped.
+func (manager *TestManager) clearSuiteNetworkConditions(testSuite TestSuiteID) {
+	manager.networkMutex.Lock()
+	nodes := manager.netemNodes[testSuite]
+	delete(manager.netemNodes, testSuite)
+	manager.networkMutex.Unlock()
+
+	for containerID := range nodes {
+		err := manager.runNetemScript(context.Background(), containerID, netemScript(nil, nil))
+		if err != nil {
+			slog.Debug("could not remove network conditions", "container", containerID, "err", err)
+		}
+	}
+}
+
+// suiteNodeID resolves a node of a running test in the suite. Only the clients of the
+// suite and the simulation container may be changed through the network conditions API,
+// so simulators can't reach into containers of other simulations.
+func (manager *TestManager) suiteNodeID(testSuite TestSuiteID, nodeID string) (string, error) {
+	if nodeID == "simulation" {
+		return manager.simContainerID, nil
+	}
+	manager.testSuiteMutex.RLock()
+	defer manager.testSuiteMutex.RUnlock()
+	suite, ok := manager.runningTestSuites[testSuite]
+	if !ok {
+		return "", ErrNoSuchTestSuite
+	}
+	manager.testCaseMutex.RLock()
+	defer manager.testCaseMutex.RUnlock()
+	for id := range suite.TestCases {
+		testCase, ok := manager.runningTestCases[id]
+		if !ok {
+			continue
+		}
+		if node, ok := testCase.ClientInfo[nodeID]; ok {
+			return node.ID, nil
+		}
+	}
+	return "", ErrNoSuchNode
+}
+
+func (manager *TestManager) runNetemScript(ctx context.Context, containerID, script string) error {
+	labels := NewBaseLabels(manager.hiveInstanceID, manager.hiveVersion)
+	labels[LabelHiveType] = ContainerTypeNetem
+	info, err := manager.backend.RunNetworkScript(ctx, containerID, script, labels)
+	if err != nil {
+		return err
+	}
+	if info.ExitCode != 0 {
+		msg := strings.TrimSpace(info.Stderr)
+		if msg == "" {
+			msg = fmt.Sprintf("exit code %d", info.ExitCode)
+		}
+		return errors.New("tc failed: " + msg)
+	}
+	return nil
+}
+
+// nodeIPs returns the IP addresses of a container in the bridge network
+// and all networks of the suite.
+func (manager *TestManager) nodeIPs(testSuite TestSuiteID, containerID string) []string {
+	manager.networkMutex.RLock()
+	networks := []string{"bridge"}
+	for name := range manager.networks[testSuite] {
+		networks = append(networks, name)
+	}
+	manager.networkMutex.RUnlock()
+
+	var ips []string
+	for _, network := range networks {
+		ip, err := manager.ContainerIP(testSuite, network, containerID)
+		if err == nil && ip != "" && ip != "<nil>" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
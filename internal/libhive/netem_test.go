@@ -0,0 +1,42 @@
+package libhive
+
+import (
+	"testing"
+
+	"github.com/ethereum/hive/internal/simapi"
+)
+
+func TestNetemScript(t *testing.T) {
+	cond := &simapi.NetworkConditions{
+		All: simapi.LinkConditions{Latency: 100, Jitter: 10, Bandwidth: 1000},
+		Peers: []simapi.PeerConditions{
+			{Node: "a", LinkConditions: simapi.LinkConditions{Loss: 2.5}},
+			{Node: "b", Partition: true},
+		},
+	}
+	peerIPs := [][]string{{"10.0.0.2"}, {"10.0.0.3", "10.1.0.3"}}
+	want := `for dev in $(ls /sys/class/net); do
+  [ "$dev" = lo ] && continue
+  tc qdisc del dev $dev root 2>/dev/null || true
+  tc qdisc add dev $dev root handle 1: prio bands 3 priomap 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 || exit 1
+  tc qdisc add dev $dev parent 1:1 handle 10: netem delay 100ms 10ms rate 1000kbit || exit 1
+  tc qdisc add dev $dev parent 1:2 handle 12: netem loss 2.5% || exit 1
+  tc filter add dev $dev parent 1: protocol ip prio 1 u32 match ip dst 10.0.0.2/32 flowid 1:2 || exit 1
+  tc qdisc add dev $dev parent 1:3 handle 13: netem loss 100% || exit 1
+  tc filter add dev $dev parent 1: protocol ip prio 1 u32 match ip dst 10.0.0.3/32 flowid 1:3 || exit 1
+  tc filter add dev $dev parent 1: protocol ip prio 1 u32 match ip dst 10.1.0.3/32 flowid 1:3 || exit 1
+done
+`
+	if script := netemScript(cond, peerIPs); script != want {
+		t.Errorf("wrong script:\n%s", script)
+	}
+
+	wantClear := `for dev in $(ls /sys/class/net); do
+  [ "$dev" = lo ] && continue
+  tc qdisc del dev $dev root 2>/dev/null || true
+done
+`
+	if script := netemScript(nil, nil); script != wantClear {
+		t.Errorf("wrong clear script:\n%s", script)
+	}
+}
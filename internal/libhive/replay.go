@@ -0,0 +1,169 @@
+package libhive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// ReplayManifest records the images and settings of a run. It is stored in hive.json
+// and allows running the exact same combination of images again.
+type ReplayManifest struct {
+	Clients    []ReplayClient    `json:"clients"`
+	Simulators []ReplaySimulator `json:"simulators"`
+
+	SimTestPattern string `json:"simTestPattern,omitempty"`
+	SimShard       string `json:"simShard,omitempty"`
+	SimParallelism int    `json:"simParallelism"`
+	SimRandomSeed  int    `json:"simRandomSeed"`
+	SimRetries     int    `json:"simRetries,omitempty"`
+	SimLogLevel    int    `json:"simLogLevel"`
+
+	SimTestTimeout time.Duration `json:"simTestTimeout,omitempty"`
+}
+
+// ReplayClient is a client image of a recorded run.
+type ReplayClient struct {
+	Client     ClientDesignator `json:"client"` // build args are filtered
+	Image      string           `json:"image"`
+	ImageID    string           `json:"imageId"`
+	Dockerfile string           `json:"dockerfile"`
+	Version    string           `json:"version,omitempty"` // content of /version.txt
+}
+
+// ReplaySimulator is a simulator image of a recorded run.
+type ReplaySimulator struct {
+	Name       string            `json:"name"`
+	Image      string            `json:"image"`
+	ImageID    string            `json:"imageId"`
+	Dockerfile string            `json:"dockerfile"`
+	BuildArgs  map[string]string `json:"buildArgs,omitempty"` // filtered
+}
+
+// LoadReplayManifest reads the replay manifest from a hive.json file.
+func LoadReplayManifest(file string) (*ReplayManifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var obj HiveInstance
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	if obj.Replay == nil {
+		return nil, errors.New("file does not contain a replay manifest")
+	}
+	return obj.Replay, nil
+}
+
+// ClientList returns the clients of the manifest.
+func (m *ReplayManifest) ClientList() []ClientDesignator {
+	list := make([]ClientDesignator, len(m.Clients))
+	for i, c := range m.Clients {
+		list[i] = c.Client
+	}
+	return list
+}
+
+// SimulatorList returns the names of the simulators of the manifest.
+func (m *ReplayManifest) SimulatorList() []string {
+	list := make([]string, len(m.Simulators))
+	for i, s := range m.Simulators {
+		list[i] = s.Name
+	}
+	return list
+}
+
+// ApplyEnv sets the simulation settings of the manifest in env.
+func (m *ReplayManifest) ApplyEnv(env *SimEnv) {
+	env.SimTestPattern = m.SimTestPattern
+	env.SimShard = m.SimShard
+	env.SimParallelism = m.SimParallelism
+	env.SimRandomSeed = m.SimRandomSeed
+	env.SimRetries = m.SimRetries
+	env.SimLogLevel = m.SimLogLevel
+	env.SimTestTimeout = m.SimTestTimeout
+}
+
+// Replay prepares running the images of a replay manifest. Images which are not
+// available anymore are built again from the recorded build parameters. Note that
+// the rebuilt image may differ from the recorded one.
+func (r *Runner) Replay(ctx context.Context, m *ReplayManifest) error {
+	if err := r.container.Build(ctx, r.builder); err != nil {
+		return err
+	}
+
+	r.clientDefs = make([]*ClientDefinition, 0, len(m.Clients))
+	r.replayClients = nil
+	for _, c := range m.Clients {
+		if !r.imageExists(ctx, c.ImageID) {
+			slog.Warn("recorded client image not found, rebuilding", "client", c.Client.Name(), "image", c.ImageID)
+			build := r.buildClient(ctx, c.Client)
+			if build.Error != "" {
+				return fmt.Errorf("can't rebuild client %s: %s", c.Client.Name(), build.Error)
+			}
+			if build.ImageID != c.ImageID {
+				slog.Warn("rebuilt client image differs from recorded image", "client", c.Client.Name(), "image", build.ImageID)
+			}
+			c.Image, c.ImageID, c.Version = build.Image, build.ImageID, build.Version
+		}
+		r.clientDefs = append(r.clientDefs, &ClientDefinition{
+			Name:      c.Client.Name(),
+			Version:   c.Version,
+			Image:     c.ImageID,
+			Meta:      r.inv.Clients[c.Client.Client].Meta,
+			Resources: c.Client.Resources,
+		})
+		r.replayClients = append(r.replayClients, c)
+	}
+
+	r.simImages = make(map[string]string)
+	r.replaySims = nil
+	for _, s := range m.Simulators {
+		if !r.imageExists(ctx, s.ImageID) {
+			slog.Warn("recorded simulator image not found, rebuilding", "simulator", s.Name, "image", s.ImageID)
+			image, err := r.builder.BuildSimulatorImage(ctx, s.Name, s.BuildArgs)
+			if err != nil {
+				return err
+			}
+			id, err := r.builder.ImageID(ctx, image)
+			if err != nil {
+				return err
+			}
+			if id != s.ImageID {
+				slog.Warn("rebuilt simulator image differs from recorded image", "simulator", s.Name, "image", id)
+			}
+			s.Image, s.ImageID = image, id
+		}
+		r.simImages[s.Name] = s.ImageID
+		r.replaySims = append(r.replaySims, s)
+	}
+	return nil
+}
+
+func (r *Runner) imageExists(ctx context.Context, id string) bool {
+	if id == "" {
+		return false
+	}
+	found, err := r.builder.ImageID(ctx, id)
+	return err == nil && found != ""
+}
+
+// replayManifest creates the replay manifest of a run.
+func (r *Runner) replayManifest(env SimEnv) *ReplayManifest {
+	return &ReplayManifest{
+		Clients:        r.replayClients,
+		Simulators:     r.replaySims,
+		SimTestPattern: env.SimTestPattern,
+		SimShard:       env.SimShard,
+		SimParallelism: env.SimParallelism,
+		SimRandomSeed:  env.SimRandomSeed,
+		SimRetries:     env.SimRetries,
+		SimLogLevel:    env.SimLogLevel,
+		SimTestTimeout: env.SimTestTimeout,
+	}
+}
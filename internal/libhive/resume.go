@@ -0,0 +1,303 @@
+package libhive
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ResumeState contains the tests which passed in a previous run. When resuming a run,
+// these tests are skipped by the simulator and their results are merged into the
+// suite files of the new run.
+type ResumeState struct {
+	dir    string
+	suites map[string]map[string]*resumedTest // suite name -> test name -> test
+}
+
+// resumedTest is a passed test case of a previous run.
+type resumedTest struct {
+	suite *TestSuite
+	test  *TestCase
+}
+
+// LoadResumeState reads the suite files in a results directory.
+func LoadResumeState(dir string) (*ResumeState, error) {
+	suites, err := readSuiteDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	rs := &ResumeState{dir: dir, suites: make(map[string]map[string]*resumedTest)}
+	for _, suite := range suites {
+		rs.addSuite(suite)
+	}
+	return rs, nil
+}
+
+// readSuiteDir reads the suite files in a results directory, ordered by file name.
+// Invalid suite files are skipped.
+func readSuiteDir(dir string) ([]*TestSuite, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var suites []*TestSuite
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") || name == "hive.json" {
+			continue
+		}
+		if _, ok := ParseBuildReportFileName(name); ok {
+			continue
+		}
+		suite, err := readSuiteFile(filepath.Join(dir, name))
+		if err != nil {
+			slog.Warn("skipping invalid suite file", "file", name, "err", err)
+			continue
+		}
+		suites = append(suites, suite)
+	}
+	return suites, nil
+}
+
+func readSuiteFile(file string) (*TestSuite, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var suite TestSuite
+	if err := json.Unmarshal(data, &suite); err != nil {
+		return nil, err
+	}
+	if suite.Name == "" {
+		return nil, fmt.Errorf("suite has no name")
+	}
+	return &suite, nil
+}
+
+func (rs *ResumeState) addSuite(suite *TestSuite) {
+	tests := rs.suites[suite.Name]
+	if tests == nil {
+		tests = make(map[string]*resumedTest)
+		rs.suites[suite.Name] = tests
+	}
+	passed := passedTests(suite)
+	for id, test := range suite.TestCases {
+		if !passed[id] || test.MultiTestContext {
+			continue
+		}
+		// If the test passed in multiple runs, use the latest result.
+		if prev := tests[test.Name]; prev != nil && prev.test.End.After(test.End) {
+			continue
+		}
+		tests[test.Name] = &resumedTest{suite: suite, test: test}
+	}
+}
+
+// passedTests returns the IDs of tests which passed along with all their subtests.
+// A parent test whose subtests failed or did not finish must run again, because
+// skipping it would also skip the subtests.
+func passedTests(suite *TestSuite) map[TestID]bool {
+	children := make(map[TestID][]TestID)
+	for id, test := range suite.TestCases {
+		if test.Parent != 0 {
+			children[test.Parent] = append(children[test.Parent], id)
+		}
+	}
+	passed := make(map[TestID]bool, len(suite.TestCases))
+	visited := make(map[TestID]bool, len(suite.TestCases))
+	var check func(id TestID) bool
+	check = func(id TestID) bool {
+		if visited[id] {
+			return passed[id]
+		}
+		visited[id] = true
+		ok := suite.TestCases[id].SummaryResult.Pass
+		for _, child := range children[id] {
+			if !check(child) {
+				ok = false
+			}
+		}
+		passed[id] = ok
+		return ok
+	}
+	for id := range suite.TestCases {
+		check(id)
+	}
+	return passed
+}
+
+// CompletedTests returns the names of all passed tests, by suite name.
+func (rs *ResumeState) CompletedTests() map[string][]string {
+	if rs == nil {
+		return nil
+	}
+	completed := make(map[string][]string, len(rs.suites))
+	for suite, tests := range rs.suites {
+		names := make([]string, 0, len(tests))
+		for name := range tests {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		completed[suite] = names
+	}
+	return completed
+}
+
+// testNames returns the sorted names of passed tests in a suite.
+func (rs *ResumeState) testNames(suite string) []string {
+	names := make([]string, 0, len(rs.suites[suite]))
+	for name := range rs.suites[suite] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// copyClientLog copies a client log file of a resumed test into the new results
+// directory. Nothing is copied if the file already exists there.
+func (rs *ResumeState) copyClientLog(logFile, logdir string) error {
+	return copyResultFile(rs.dir, logdir, logFile)
+}
+
+// copyResultFile copies a file, given by its path relative to the results directory,
+// from one results directory to another. Nothing is copied if the file already exists
+// in the destination.
+func copyResultFile(srcDir, dstDir, file string) error {
+	if file == "" {
+		return nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(file)) {
+		return fmt.Errorf("invalid file name %q", file)
+	}
+	src := filepath.Join(srcDir, filepath.FromSlash(file))
+	dst := filepath.Join(dstDir, filepath.FromSlash(file))
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// mergeResumedTests adds the passed tests of the previous run to a suite.
+// Tests which were run again in this run are not added.
+//
+// This must be called with testSuiteMutex held.
+func (manager *TestManager) mergeResumedTests(suite *TestSuite) {
+	rs := manager.config.Resume
+	if rs == nil {
+		return
+	}
+	names := rs.testNames(suite.Name)
+	if len(names) == 0 {
+		return
+	}
+
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+
+	ran := make(map[string]bool, len(suite.TestCases))
+	for _, test := range suite.TestCases {
+		ran[test.Name] = true
+	}
+	parents := make(map[*TestCase]string)
+	for _, name := range names {
+		if ran[name] {
+			continue
+		}
+		rt := rs.suites[suite.Name][name]
+		test := *rt.test
+		manager.resumeClients(suite, rt.suite, test.ClientInfo)
+		test.SummaryResult = manager.resumeResult(suite, rt.suite, name, test.SummaryResult)
+		test.Attempts = manager.resumeAttempts(suite, rt.suite, name, rt.test.Attempts)
+		manager.testCaseCounter++
+		suite.TestCases[TestID(manager.testCaseCounter)] = &test
+		if test.Parent != 0 {
+			if parent := rt.suite.TestCases[test.Parent]; parent != nil {
+				parents[&test] = parent.Name
+			}
+			test.Parent = 0
+		}
+	}
+	resumeParents(suite, parents)
+}
+
+// resumeAttempts copies the failed attempts of a test from a previous run, including
+// the subtests of each attempt.
+func (manager *TestManager) resumeAttempts(suite, from *TestSuite, name string, attempts []*TestAttempt) []*TestAttempt {
+	result := make([]*TestAttempt, len(attempts))
+	for i, a := range attempts {
+		attempt := *a
+		manager.resumeClients(suite, from, attempt.ClientInfo)
+		attemptName := fmt.Sprintf("%s (attempt %d)", name, i+1)
+		attempt.Result = manager.resumeResult(suite, from, attemptName, attempt.Result)
+		if a.Subtests != nil {
+			attempt.Subtests = make(map[TestID]*TestCase, len(a.Subtests))
+			for id, sub := range a.Subtests {
+				test := *sub
+				manager.resumeClients(suite, from, test.ClientInfo)
+				test.SummaryResult = manager.resumeResult(suite, from, test.Name, test.SummaryResult)
+				test.Attempts = manager.resumeAttempts(suite, from, test.Name, sub.Attempts)
+				attempt.Subtests[id] = &test
+			}
+		}
+		result[i] = &attempt
+	}
+	return result
+}
+
+// resumeParents assigns the parent test IDs of resumed subtests. Parents are
+// identified by name because test IDs change between runs. The argument maps
+// each resumed subtest to the name of its parent in the previous run.
+func resumeParents(suite *TestSuite, parents map[*TestCase]string) {
+	ids := make(map[string]TestID, len(suite.TestCases))
+	for id, test := range suite.TestCases {
+		ids[test.Name] = id
+	}
+	for test, name := range parents {
+		test.Parent = ids[name]
+	}
+}
+
+// resumeClients copies the client logs of a resumed test into the new results
+// directory, and adds the client versions to the suite.
+func (manager *TestManager) resumeClients(suite, prevSuite *TestSuite, clients map[string]*ClientInfo) {
+	rs := manager.config.Resume
+	for _, client := range clients {
+		if manager.config.LogDir != "" {
+			if err := rs.copyClientLog(client.LogFile, manager.config.LogDir); err != nil {
+				slog.Warn("could not copy client log of resumed test", "client", client.Name, "err", err)
+			}
+		}
+		if _, ok := suite.ClientVersions[client.Name]; !ok {
+			if version, ok := prevSuite.ClientVersions[client.Name]; ok {
+				suite.ClientVersions[client.Name] = version
+			}
+		}
+	}
+}
+
+// resumeResult moves the test log of a resumed result into the details file of
+// the new suite.
+func (manager *TestManager) resumeResult(suite, prevSuite *TestSuite, name string, result TestResult) TestResult {
+	text, err := TestDetails(os.DirFS(manager.config.Resume.dir), prevSuite, result)
+	if err != nil {
+		slog.Warn("could not read details of resumed test", "test", name, "err", err)
+	}
+	result.Details = text
+	result.LogOffsets = nil
+	if text != "" && suite.testDetailsFile != nil {
+		result.Details = ""
+		result.LogOffsets = suite.writeTestDetails(name, text)
+	}
+	return result
+}
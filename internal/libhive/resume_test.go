@@ -0,0 +1,192 @@
+package libhive_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/hive/hivesim"
+	"github.com/ethereum/hive/internal/fakes"
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// This test checks that a resumed run skips the tests which passed in the
+// previous run, and that their results are merged into the new suite file.
+func TestResume(t *testing.T) {
+	var (
+		firstDir  = t.TempDir()
+		secondDir = t.TempDir()
+		executed  []string
+		failB     = true
+	)
+	suite := hivesim.Suite{Name: "suite"}
+	suite.Add(hivesim.TestSpec{Name: "a", Run: func(t *hivesim.T) {
+		executed = append(executed, "a")
+		t.Log("output of a")
+	}})
+	suite.Add(hivesim.TestSpec{Name: "b", Run: func(t *hivesim.T) {
+		executed = append(executed, "b")
+		if failB {
+			t.Fatal("b failed")
+		}
+	}})
+
+	// First run: test b fails.
+	runSuite(t, libhive.SimEnv{LogDir: firstDir}, suite)
+	if !reflect.DeepEqual(executed, []string{"a", "b"}) {
+		t.Fatal("wrong tests executed in first run:", executed)
+	}
+
+	// Second run: only b runs.
+	rs, err := libhive.LoadResumeState(firstDir)
+	if err != nil {
+		t.Fatal("LoadResumeState failed:", err)
+	}
+	wantCompleted := map[string][]string{"suite": {"a"}}
+	if completed := rs.CompletedTests(); !reflect.DeepEqual(completed, wantCompleted) {
+		t.Fatal("wrong completed tests:", completed)
+	}
+	executed, failB = nil, false
+	runSuite(t, libhive.SimEnv{LogDir: secondDir, Resume: rs}, suite)
+	if !reflect.DeepEqual(executed, []string{"b"}) {
+		t.Fatal("wrong tests executed in resumed run:", executed)
+	}
+
+	// Check the merged suite file.
+	result := readSuiteFiles(t, secondDir)
+	if len(result) != 1 {
+		t.Fatalf("wrong number of suite files %d", len(result))
+	}
+	var names []string
+	for _, test := range result[0].TestCases {
+		names = append(names, test.Name)
+		if !test.SummaryResult.Pass {
+			t.Errorf("test %s did not pass", test.Name)
+		}
+		if test.Name == "a" {
+			details, err := os.ReadFile(filepath.Join(secondDir, result[0].TestDetailsLog))
+			if err != nil {
+				t.Fatal(err)
+			}
+			offsets := test.SummaryResult.LogOffsets
+			if offsets == nil {
+				t.Fatal("resumed test has no log offsets")
+			}
+			if text := string(details[offsets.Begin:offsets.End]); text != "output of a\n" {
+				t.Errorf("wrong details of resumed test: %q", text)
+			}
+		}
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatal("wrong tests in merged suite:", names)
+	}
+}
+
+// This test checks that a parent test runs again in a resumed run when one of its
+// subtests failed, even though the parent itself passed.
+func TestResumeFailedSubtest(t *testing.T) {
+	var (
+		firstDir  = t.TempDir()
+		secondDir = t.TempDir()
+		executed  []string
+		failSub   = true
+	)
+	suite := hivesim.Suite{Name: "suite"}
+	suite.Add(hivesim.TestSpec{Name: "launch", Run: func(t *hivesim.T) {
+		executed = append(executed, "launch")
+		t.Run(hivesim.TestSpec{Name: "sub-ok", Run: func(t *hivesim.T) {
+			executed = append(executed, "sub-ok")
+		}})
+		t.Run(hivesim.TestSpec{Name: "sub-fail", Run: func(t *hivesim.T) {
+			executed = append(executed, "sub-fail")
+			if failSub {
+				t.Fatal("subtest failed")
+			}
+		}})
+	}})
+
+	// First run: the parent passes, but one of its subtests fails.
+	runSuite(t, libhive.SimEnv{LogDir: firstDir}, suite)
+	if !reflect.DeepEqual(executed, []string{"launch", "sub-ok", "sub-fail"}) {
+		t.Fatal("wrong tests executed in first run:", executed)
+	}
+
+	// Second run: the parent and the failed subtest run again.
+	rs, err := libhive.LoadResumeState(firstDir)
+	if err != nil {
+		t.Fatal("LoadResumeState failed:", err)
+	}
+	wantCompleted := map[string][]string{"suite": {"sub-ok"}}
+	if completed := rs.CompletedTests(); !reflect.DeepEqual(completed, wantCompleted) {
+		t.Fatal("wrong completed tests:", completed)
+	}
+	executed, failSub = nil, false
+	runSuite(t, libhive.SimEnv{LogDir: secondDir, Resume: rs}, suite)
+	if !reflect.DeepEqual(executed, []string{"launch", "sub-fail"}) {
+		t.Fatal("wrong tests executed in resumed run:", executed)
+	}
+
+	// All tests are in the merged suite, and the resumed subtest has the new parent.
+	result := readSuiteFiles(t, secondDir)
+	if len(result) != 1 {
+		t.Fatalf("wrong number of suite files %d", len(result))
+	}
+	ids := make(map[string]libhive.TestID)
+	for id, test := range result[0].TestCases {
+		ids[test.Name] = id
+		if !test.SummaryResult.Pass {
+			t.Errorf("test %s did not pass", test.Name)
+		}
+	}
+	if len(ids) != 3 {
+		t.Fatal("wrong tests in merged suite:", ids)
+	}
+	for _, name := range []string{"sub-ok", "sub-fail"} {
+		if parent := result[0].TestCases[ids[name]].Parent; parent != ids["launch"] {
+			t.Errorf("test %s has parent %d, want %d", name, parent, ids["launch"])
+		}
+	}
+}
+
+func runSuite(t *testing.T, env libhive.SimEnv, suite hivesim.Suite) {
+	backend := fakes.NewContainerBackend(nil)
+	tm := libhive.NewTestManager(env, backend, nil, libhive.HiveInfo{})
+	srv := httptest.NewServer(tm.API())
+	defer srv.Close()
+
+	if err := hivesim.RunSuite(hivesim.NewAt(srv.URL), suite); err != nil {
+		t.Fatal("suite run failed:", err)
+	}
+	if err := tm.Terminate(); err != nil {
+		t.Fatal("terminate failed:", err)
+	}
+}
+
+func readSuiteFiles(t *testing.T, dir string) []*libhive.TestSuite {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suites []*libhive.TestSuite
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var suite libhive.TestSuite
+		if err := json.Unmarshal(data, &suite); err != nil {
+			t.Fatal(err)
+		}
+		suites = append(suites, &suite)
+	}
+	return suites
+}
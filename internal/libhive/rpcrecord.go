@@ -0,0 +1,192 @@
+package libhive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxProxiedBody is the size limit of request and response bodies relayed by
+	// the RPC proxy.
+	maxProxiedBody = 128 * 1024 * 1024
+	// maxRecordedBody is the size limit of bodies stored in RPC transcripts. Larger
+	// bodies are truncated.
+	maxRecordedBody = 1024 * 1024
+)
+
+// RPCExchange is a request and its response, as recorded in an RPC transcript file.
+type RPCExchange struct {
+	Time     time.Time       `json:"time"`
+	Duration float64         `json:"durationMs"` // in milliseconds
+	Port     uint16          `json:"port"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Status   int             `json:"status,omitempty"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"` // set when the client could not be reached
+}
+
+var errResponseTooLarge = fmt.Errorf("response exceeds %d bytes", maxProxiedBody)
+
+// hopHeaders are the headers which are not relayed by the RPC proxy.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// rpcRecorder writes RPC transcripts.
+type rpcRecorder struct {
+	client *http.Client
+	mu     sync.Mutex // serializes writes to transcript files
+}
+
+func newRPCRecorder(backend ContainerBackend) *rpcRecorder {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return backend.DialContainer(ctx, addr)
+		},
+		MaxIdleConnsPerHost: 4,
+	}
+	return &rpcRecorder{client: &http.Client{Transport: transport}}
+}
+
+// proxyRPC relays an HTTP request to a port of a client container and records the
+// exchange in the RPC transcript of the test.
+func (manager *TestManager) proxyRPC(w http.ResponseWriter, r *http.Request, test TestID, node *ClientInfo, port uint16, path string) {
+	reqBody, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxiedBody))
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	url := fmt.Sprintf("http://%s:%d%s", node.IP, port, path)
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, url, bytes.NewReader(reqBody))
+	if err != nil {
+		serveError(w, err, http.StatusBadRequest)
+		return
+	}
+	req.Header = r.Header.Clone()
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+
+	ex := &RPCExchange{
+		Time:    time.Now(),
+		Port:    port,
+		Method:  r.Method,
+		Path:    path,
+		Request: transcriptBody(reqBody),
+	}
+	resp, err := manager.rpc.client.Do(req)
+	var respBody []byte
+	if err == nil {
+		// Read one byte more than the limit to detect larger responses.
+		respBody, err = io.ReadAll(io.LimitReader(resp.Body, maxProxiedBody+1))
+		resp.Body.Close()
+		if err == nil && len(respBody) > maxProxiedBody {
+			respBody, err = nil, errResponseTooLarge
+		}
+	}
+	ex.Duration = float64(time.Since(ex.Time).Microseconds()) / 1000
+	if err != nil {
+		ex.Error = err.Error()
+		manager.recordRPC(test, node, ex)
+		serveError(w, err, http.StatusBadGateway)
+		return
+	}
+	ex.Status = resp.StatusCode
+	ex.Response = transcriptBody(respBody)
+	manager.recordRPC(test, node, ex)
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+	// The body was read completely, so its length is known.
+	if r.Method != http.MethodHead {
+		w.Header().Set("Content-Length", strconv.Itoa(len(respBody)))
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+}
+
+// recordRPC appends an exchange to the RPC transcript of a client in a test.
+func (manager *TestManager) recordRPC(test TestID, node *ClientInfo, ex *RPCExchange) {
+	if manager.config.LogDir == "" {
+		return
+	}
+	file := filepath.ToSlash(filepath.Join(node.Name, fmt.Sprintf("rpc-%s-%d.jsonl", node.ID, test)))
+	line, err := json.Marshal(ex)
+	if err != nil {
+		slog.Error("could not encode RPC exchange", "client", node.ID, "err", err)
+		return
+	}
+
+	manager.rpc.mu.Lock()
+	err = appendFile(filepath.Join(manager.config.LogDir, filepath.FromSlash(file)), append(line, '\n'))
+	manager.rpc.mu.Unlock()
+	if err != nil {
+		slog.Error("could not write RPC transcript", "client", node.ID, "err", err)
+		return
+	}
+
+	manager.testCaseMutex.Lock()
+	node.RPCTranscript = file
+	manager.testCaseMutex.Unlock()
+}
+
+// transcriptBody converts a request or response body for storage in a transcript.
+// JSON bodies are stored as JSON, other bodies are stored as a string.
+func transcriptBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if len(body) <= maxRecordedBody {
+		var buf bytes.Buffer
+		if json.Compact(&buf, body) == nil {
+			return buf.Bytes()
+		}
+	}
+	text := string(body)
+	if len(text) > maxRecordedBody {
+		text = text[:maxRecordedBody] + fmt.Sprintf("... (%d bytes truncated)", len(body)-maxRecordedBody)
+	}
+	enc, _ := json.Marshal(text)
+	return enc
+}
+
+func appendFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Write(data)
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -13,6 +13,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,6 +31,26 @@ type Runner struct {
 	// This holds the image names of all built simulators.
 	simImages  map[string]string
 	clientDefs []*ClientDefinition
+
+	// buildReport contains the results of client builds.
+	buildReport BuildReport
+
+	// These record the images of the run for the replay manifest.
+	replayClients []ReplayClient
+	replaySims    []ReplaySimulator
+
+	// clientSlots bounds the number of client containers across all
+	// simulators. It is nil when there is no limit.
+	clientSlots chan struct{}
+
+	// serveMu ensures the API server of a simulation is started with the
+	// instance info of its own test manager.
+	serveMu sync.Mutex
+
+	// These are the clients and networks of failed tests which were kept running.
+	keptClients  []*FailedClient
+	keptNetworks []string
+	keptMutex    sync.Mutex
 }
 
 func NewRunner(inv Inventory, b Builder, cb ContainerBackend) *Runner {
@@ -41,52 +62,127 @@ func NewRunner(inv Inventory, b Builder, cb ContainerBackend) *Runner {
 }
 
 // Build builds client and simulator images.
-func (r *Runner) Build(ctx context.Context, clientList []ClientDesignator, simList []string, simBuildArgs map[string]string) error {
+func (r *Runner) Build(ctx context.Context, clientList []ClientDesignator, simList []string, simBuildArgs map[string]string, opts BuildOptions) error {
 	if err := r.container.Build(ctx, r.builder); err != nil {
 		return err
 	}
-	if err := r.buildClients(ctx, clientList); err != nil {
+	if err := r.buildClients(ctx, clientList, opts); err != nil {
 		return err
 	}
 	return r.buildSimulators(ctx, simList, simBuildArgs)
 }
 
-// buildClients builds client images.
-func (r *Runner) buildClients(ctx context.Context, clientList []ClientDesignator) error {
+// BuildReport returns the results of the client builds.
+func (r *Runner) BuildReport() *BuildReport {
+	return &r.buildReport
+}
+
+// buildClients builds client images. Up to opts.Concurrency images are built at the
+// same time.
+func (r *Runner) buildClients(ctx context.Context, clientList []ClientDesignator, opts BuildOptions) error {
 	if len(clientList) == 0 {
 		return errors.New("client list is empty, cannot simulate")
 	}
+	if opts.SkipClientImages {
+		r.buildReport = BuildReport{}
+		r.replayClients = nil
+		r.clientDefs = make([]*ClientDefinition, 0, len(clientList))
+		for _, client := range clientList {
+			r.clientDefs = append(r.clientDefs, &ClientDefinition{
+				Name:      client.Name(),
+				Meta:      r.inv.Clients[client.Client].Meta,
+				Resources: client.Resources,
+			})
+		}
+		return nil
+	}
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-	r.clientDefs = make([]*ClientDefinition, 0, len(clientList))
+	var (
+		start  = time.Now()
+		builds = make([]ClientBuild, len(clientList))
+		sem    = make(chan struct{}, concurrency)
+		wg     sync.WaitGroup
+	)
+	slog.Info(fmt.Sprintf("building %d clients...", len(clientList)), "concurrency", concurrency)
+	for i, client := range clientList {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			builds[i] = r.buildClient(ctx, client)
+		}()
+	}
+	wg.Wait()
+	r.buildReport = BuildReport{Start: start, Clients: builds}
 
-	var anyBuilt bool
-	slog.Info(fmt.Sprintf("building %d clients...", len(clientList)))
-	for _, client := range clientList {
-		image, err := r.builder.BuildClientImage(ctx, client)
-		if err != nil {
+	r.clientDefs = make([]*ClientDefinition, 0, len(clientList))
+	r.replayClients = nil
+	for i, client := range clientList {
+		if builds[i].Error != "" {
 			continue
 		}
-		anyBuilt = true
-		version, err := r.builder.ReadFile(ctx, image, "/version.txt")
-		if err != nil {
-			slog.Warn("can't read version info of "+client.Client, "image", image, "err", err)
-		}
+		filtered := client
+		filtered.BuildArgs = filterBuildArgs(client.BuildArgs)
+		r.replayClients = append(r.replayClients, ReplayClient{
+			Client:     filtered,
+			Image:      builds[i].Image,
+			ImageID:    builds[i].ImageID,
+			Dockerfile: client.Dockerfile(),
+			Version:    builds[i].Version,
+		})
 		r.clientDefs = append(r.clientDefs, &ClientDefinition{
-			Name:    client.Name(),
-			Version: strings.TrimSpace(string(version)),
-			Image:   image,
-			Meta:    r.inv.Clients[client.Client].Meta,
+			Name:      client.Name(),
+			Version:   builds[i].Version,
+			Image:     builds[i].Image,
+			Meta:      r.inv.Clients[client.Client].Meta,
+			Resources: client.Resources,
 		})
 	}
-	if !anyBuilt {
+	if len(r.clientDefs) == 0 {
 		return errors.New("all clients failed to build")
 	}
+	if failed := r.buildReport.Failed(); opts.Strict && len(failed) > 0 {
+		return fmt.Errorf("clients failed to build: %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
+// buildClient builds the image of a single client.
+func (r *Runner) buildClient(ctx context.Context, client ClientDesignator) ClientBuild {
+	build := ClientBuild{Client: client.Name()}
+	start := time.Now()
+	prevID, _ := r.builder.ImageID(ctx, client.ImageTag())
+	image, err := r.builder.BuildClientImage(ctx, client)
+	build.Image = image
+	build.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		build.Error = err.Error()
+		return build
+	}
+	if build.ImageID, err = r.builder.ImageID(ctx, image); err != nil {
+		slog.Warn("can't get image ID of "+client.Client, "image", image, "err", err)
+	}
+	build.CacheHit = prevID != "" && prevID == build.ImageID
+
+	version, err := r.builder.ReadFile(ctx, image, "/version.txt")
+	if err != nil {
+		slog.Warn("can't read version info of "+client.Client, "image", image, "err", err)
+	}
+	build.Version = strings.TrimSpace(string(version))
+	return build
+}
+
 // buildSimulators builds simulator images.
 func (r *Runner) buildSimulators(ctx context.Context, simList []string, buildArgs map[string]string) error {
 	r.simImages = make(map[string]string)
+	r.replaySims = nil
 
 	slog.Info(fmt.Sprintf("building %d simulators...", len(simList)))
 	for _, sim := range simList {
@@ -95,6 +191,17 @@ func (r *Runner) buildSimulators(ctx context.Context, simList []string, buildArg
 			return err
 		}
 		r.simImages[sim] = image
+		id, err := r.builder.ImageID(ctx, image)
+		if err != nil {
+			slog.Warn("can't get image ID of simulator "+sim, "image", image, "err", err)
+		}
+		r.replaySims = append(r.replaySims, ReplaySimulator{
+			Name:       sim,
+			Image:      image,
+			ImageID:    id,
+			Dockerfile: "Dockerfile",
+			BuildArgs:  filterBuildArgs(buildArgs),
+		})
 	}
 	return nil
 }
@@ -103,10 +210,79 @@ func (r *Runner) Run(ctx context.Context, sim string, env SimEnv, hiveInfo HiveI
 	if err := createWorkspace(env.LogDir); err != nil {
 		return SimResult{}, err
 	}
-	writeInstanceInfo(env.LogDir)
+	r.writeInstanceInfo(env)
+	r.initClientLimit(env)
 	return r.run(ctx, sim, env, hiveInfo)
 }
 
+// RunAll runs the given simulators. Up to env.SimConcurrency simulators run at the same
+// time. Results are returned in the order of simList.
+//
+// When a simulation fails to run, no further simulations are started and the first
+// error is returned after all running simulations have finished.
+func (r *Runner) RunAll(ctx context.Context, simList []string, env SimEnv, hiveInfo HiveInfo) ([]SimResult, error) {
+	if err := createWorkspace(env.LogDir); err != nil {
+		return nil, err
+	}
+	r.writeInstanceInfo(env)
+	r.initClientLimit(env)
+
+	concurrency := env.SimConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		results  = make([]SimResult, len(simList))
+		errs     = make([]error, len(simList))
+		sem      = make(chan struct{}, concurrency)
+		failed   = make(chan struct{})
+		failOnce sync.Once
+		wg       sync.WaitGroup
+	)
+loop:
+	for i, sim := range simList {
+		select {
+		case sem <- struct{}{}:
+		case <-failed:
+			break loop
+		}
+		// Don't start another simulation if one has failed while waiting.
+		select {
+		case <-failed:
+			break loop
+		default:
+		}
+		wg.Add(1)
+		go func(i int, sim string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], errs[i] = r.run(ctx, sim, env, hiveInfo)
+			if errs[i] != nil {
+				failOnce.Do(func() { close(failed) })
+				return
+			}
+			slog.Info(fmt.Sprintf("simulation %s finished", sim), "suites", results[i].Suites, "tests", results[i].Tests, "failed", results[i].TestsFailed, "skipped", results[i].TestsSkipped)
+		}(i, sim)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// initClientLimit creates the client container limiter.
+func (r *Runner) initClientLimit(env SimEnv) {
+	if env.ClientLimit > 0 && r.clientSlots == nil {
+		r.clientSlots = make(chan struct{}, env.ClientLimit)
+	}
+}
+
 // RunDevMode starts simulator development mode. In this mode, the simulator is not
 // launched and the API server runs on the local network instead of listening for requests
 // on the docker network.
@@ -125,6 +301,7 @@ func (r *Runner) RunDevMode(ctx context.Context, env SimEnv, endpoint string, hi
 		if err := tm.Terminate(); err != nil {
 			slog.Error("could not terminate test manager", "error", err)
 		}
+		r.addKept(tm)
 	}()
 
 	slog.Debug("starting simulator API proxy")
@@ -158,8 +335,16 @@ HIVE_SIMULATOR=http://%v
 }
 
 // run runs one simulation.
-func (r *Runner) run(ctx context.Context, sim string, env SimEnv, hiveInfo HiveInfo) (SimResult, error) {
+func (r *Runner) run(ctx context.Context, sim string, env SimEnv, hiveInfo HiveInfo) (result SimResult, err error) {
 	slog.Info(fmt.Sprintf("running simulation: %s", sim))
+	env.Events.Send(Event{Type: EventSimulationStart, Simulator: sim})
+	defer func() {
+		ev := Event{Type: EventSimulationEnd, Simulator: sim, SimResult: &result}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		env.Events.Send(ev)
+	}()
 
 	clientDefs := make([]*ClientDefinition, 0)
 	if env.ClientList == nil {
@@ -183,17 +368,23 @@ func (r *Runner) run(ctx context.Context, sim string, env SimEnv, hiveInfo HiveI
 
 	// Start the simulation API.
 	tm := NewTestManager(env, r.container, clientDefs, hiveInfo)
+	tm.simulator = sim
+	tm.clientSlots = r.clientSlots
 	defer func() {
 		if err := tm.Terminate(); err != nil {
 			slog.Error("could not terminate test manager", "error", err)
 		}
+		r.addKept(tm)
 	}()
 
-	// Set hive instance info for container labeling.
-	r.container.SetHiveInstanceInfo(tm.hiveInstanceID, tm.hiveVersion)
-
+	// Set hive instance info for container labeling, and start the API server.
+	// This is done under the lock because the backend is shared between all
+	// concurrently running simulations.
 	slog.Debug("starting simulator API server")
+	r.serveMu.Lock()
+	r.container.SetHiveInstanceInfo(tm.hiveInstanceID, tm.hiveVersion)
 	server, err := r.container.ServeAPI(ctx, tm.API())
+	r.serveMu.Unlock()
 	if err != nil {
 		slog.Error("can't start API server", "err", err)
 		return SimResult{}, err
@@ -215,11 +406,18 @@ func (r *Runner) run(ctx context.Context, sim string, env SimEnv, hiveInfo HiveI
 			"HIVE_PARALLELISM":  strconv.Itoa(env.SimParallelism),
 			"HIVE_LOGLEVEL":     strconv.Itoa(env.SimLogLevel),
 			"HIVE_TEST_PATTERN": env.SimTestPattern,
+			"HIVE_SHARD":        env.SimShard,
 			"HIVE_RANDOM_SEED":  strconv.Itoa(env.SimRandomSeed),
+			"HIVE_RETRIES":      strconv.Itoa(env.SimRetries),
+			"HIVE_TEST_TIMEOUT": env.SimTestTimeout.String(),
+			"HIVE_RECORD_RPC":   strconv.FormatBool(env.SimRecordRPC),
 		},
 		Labels: simLabels,
 		Name:   containerName,
 	}
+	if env.ListTests {
+		opts.Env["HIVE_DOCS_MODE"] = "catalog"
+	}
 	containerID, err := r.container.CreateContainer(ctx, r.simImages[sim], opts)
 	if err != nil {
 		return SimResult{}, err
@@ -268,13 +466,19 @@ func (r *Runner) run(ctx context.Context, sim string, env SimEnv, hiveInfo HiveI
 		err = errSimInterrupt
 	}
 
+	if env.ListTests {
+		result.Catalog = tm.Catalog()
+	}
+
 	// Count the results.
-	var result SimResult
 	for _, suite := range tm.Results() {
 		var suiteFailCounted bool
 		result.Suites++
 		for _, test := range suite.TestCases {
 			result.Tests++
+			if test.SummaryResult.Skipped {
+				result.TestsSkipped++
+			}
 			if !test.SummaryResult.Pass {
 				result.TestsFailed++
 				if !suiteFailCounted {
@@ -315,7 +519,9 @@ func createWorkspace(logdir string) error {
 	return nil
 }
 
-func writeInstanceInfo(logdir string) {
+// writeInstanceInfo writes hive.json, which contains information about hive and the
+// replay manifest of the run.
+func (r *Runner) writeInstanceInfo(env SimEnv) {
 	var obj HiveInstance
 
 	// Legacy fields for backward compatibility
@@ -327,9 +533,10 @@ func writeInstanceInfo(logdir string) {
 
 	// Enhanced version information
 	obj.HiveVersion = GetHiveVersion()
+	obj.Replay = r.replayManifest(env)
 
 	enc, _ := json.Marshal(&obj)
-	err := os.WriteFile(filepath.Join(logdir, "hive.json"), enc, 0644)
+	err := os.WriteFile(filepath.Join(env.LogDir, "hive.json"), enc, 0644)
 	if err != nil {
 		slog.Warn("can't write hive.json", "err", err)
 	}
@@ -2,16 +2,21 @@ package libhive_test
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ethereum/hive/hivesim"
 	"github.com/ethereum/hive/internal/fakes"
 	"github.com/ethereum/hive/internal/libhive"
+	"github.com/ethereum/hive/internal/simapi"
 )
 
 func TestRunner(t *testing.T) {
@@ -49,7 +54,7 @@ func TestRunner(t *testing.T) {
 		ctx       = context.Background()
 		buildArgs = map[string]string{"SomeArg": "SomeValue"}
 	)
-	if err := runner.Build(ctx, allClients, simList, buildArgs); err != nil {
+	if err := runner.Build(ctx, allClients, simList, buildArgs, libhive.BuildOptions{}); err != nil {
 		t.Fatal("Build() failed:", err)
 	}
 	if _, err := runner.Run(context.Background(), "sim-1", simOpt, libhive.HiveInfo{}); err != nil {
@@ -60,6 +65,460 @@ func TestRunner(t *testing.T) {
 	t.Logf("hive.json content: %s", content)
 }
 
+// This test checks that RunAll runs simulators concurrently, and that the
+// client limit applies across all simulators.
+func TestRunnerConcurrency(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		clients    = make(map[string]bool)
+		maxClients int
+		simStarted sync.WaitGroup
+	)
+	simStarted.Add(2)
+
+	inv := makeTestInventory()
+	inv.AddSimulator("sim-2")
+	b := fakes.NewBuilder(&fakes.BuilderHooks{})
+	cb := fakes.NewContainerBackend(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			if !strings.Contains(image, "/simulator/") {
+				mu.Lock()
+				clients[containerID] = true
+				if len(clients) > maxClients {
+					maxClients = len(clients)
+				}
+				mu.Unlock()
+				return new(libhive.ContainerInfo), nil
+			}
+
+			// Wait for the other simulator to start.
+			simStarted.Done()
+			waitC := make(chan struct{})
+			go func() { simStarted.Wait(); close(waitC) }()
+			select {
+			case <-waitC:
+			case <-time.After(5 * time.Second):
+				t.Error("simulators did not run concurrently")
+			}
+			runTestWithClient(t, hivesim.NewAt(opt.Env["HIVE_SIMULATOR"]))
+			return new(libhive.ContainerInfo), nil
+		},
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			delete(clients, containerID)
+			mu.Unlock()
+			return nil
+		},
+	})
+
+	var (
+		runner  = libhive.NewRunner(inv, b, cb)
+		simList = []string{"sim-1", "sim-2"}
+		simOpt  = libhive.SimEnv{LogDir: t.TempDir(), SimConcurrency: 2, ClientLimit: 1}
+		ctx     = context.Background()
+	)
+	if err := runner.Build(ctx, []libhive.ClientDesignator{{Client: "client-1"}}, simList, nil, libhive.BuildOptions{}); err != nil {
+		t.Fatal("Build() failed:", err)
+	}
+	results, err := runner.RunAll(ctx, simList, simOpt, libhive.HiveInfo{})
+	if err != nil {
+		t.Fatal("RunAll() failed:", err)
+	}
+	wantResults := []libhive.SimResult{{Suites: 1, Tests: 1}, {Suites: 1, Tests: 1}}
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("wrong results %+v", results)
+	}
+	if maxClients != 1 {
+		t.Errorf("wrong max number of running clients %d, want 1", maxClients)
+	}
+}
+
+// This test checks that client images are built concurrently, and that the build
+// report contains the results of all clients.
+func TestRunnerBuildClients(t *testing.T) {
+	var (
+		allClients = []libhive.ClientDesignator{{Client: "client-1"}, {Client: "client-2"}, {Client: "client-3"}}
+		started    sync.WaitGroup
+	)
+	started.Add(2)
+	b := fakes.NewBuilder(&fakes.BuilderHooks{
+		BuildClientImage: func(ctx context.Context, client libhive.ClientDesignator) (string, error) {
+			if client.Client == "client-3" {
+				return "", errors.New("build failed")
+			}
+			// Wait for the other build to start.
+			started.Done()
+			waitC := make(chan struct{})
+			go func() { started.Wait(); close(waitC) }()
+			select {
+			case <-waitC:
+			case <-time.After(5 * time.Second):
+				t.Error("clients were not built concurrently")
+			}
+			return client.ImageTag(), nil
+		},
+		ImageID: func(ctx context.Context, image string) (string, error) {
+			return "sha256:" + image, nil
+		},
+	})
+	cb := fakes.NewContainerBackend(nil)
+	inv := makeTestInventory()
+	ctx := context.Background()
+
+	runner := libhive.NewRunner(inv, b, cb)
+	if err := runner.Build(ctx, allClients, nil, nil, libhive.BuildOptions{Concurrency: 2}); err != nil {
+		t.Fatal("Build() failed:", err)
+	}
+	report := runner.BuildReport()
+	if report.Start.IsZero() {
+		t.Error("build report has no start time")
+	}
+	if len(report.Clients) != 3 {
+		t.Fatalf("wrong number of builds in report: %d", len(report.Clients))
+	}
+	for i, build := range report.Clients[:2] {
+		if build.Client != allClients[i].Name() || build.Error != "" || !build.CacheHit {
+			t.Errorf("wrong build result %d: %+v", i, build)
+		}
+	}
+	if failed := report.Failed(); !reflect.DeepEqual(failed, []string{"client-3"}) {
+		t.Errorf("wrong failed clients %v", failed)
+	}
+
+	// In strict mode, the failed build is an error.
+	started.Add(2)
+	runner = libhive.NewRunner(inv, b, cb)
+	err := runner.Build(ctx, allClients, nil, nil, libhive.BuildOptions{Concurrency: 2, Strict: true})
+	if err == nil {
+		t.Fatal("no error for failed build in strict mode")
+	}
+}
+
+// This test checks that build reports of different runs are written to
+// different files.
+func TestBuildReportFile(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		start   = time.Unix(1700000000, 0)
+		reports = []libhive.BuildReport{
+			{Start: start, Clients: []libhive.ClientBuild{{Client: "client-1", ImageID: "sha256:1"}}},
+			{Start: start.Add(time.Hour), Clients: []libhive.ClientBuild{{Client: "client-1", ImageID: "sha256:2"}}},
+		}
+	)
+	for _, r := range reports {
+		if err := r.WriteFile(dir); err != nil {
+			t.Fatal("WriteFile failed:", err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"build-1700000000.json", "build-1700003600.json"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("wrong report files %v, want %v", names, want)
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, want[1]))
+	if !strings.Contains(string(content), `"imageID": "sha256:2"`) {
+		t.Errorf("report does not contain image ID:\n%s", content)
+	}
+	if ts, ok := libhive.ParseBuildReportFileName(want[0]); !ok || !ts.Equal(start) {
+		t.Errorf("wrong start time parsed from file name: %v", ts)
+	}
+	if _, ok := libhive.ParseBuildReportFileName("1700000000-abcd.json"); ok {
+		t.Error("suite file name parsed as build report")
+	}
+}
+
+// This test checks that the images of a run are recorded in hive.json, and that
+// a replayed run uses the recorded images.
+func TestRunnerReplay(t *testing.T) {
+	var (
+		clients = []libhive.ClientDesignator{
+			{Client: "client-1", BuildArgs: map[string]string{"tag": "v1", "GITHUB_TOKEN": "secret"}},
+			{Client: "client-2"},
+		}
+		inv    = makeTestInventory()
+		ctx    = context.Background()
+		env    = libhive.SimEnv{LogDir: t.TempDir(), SimRandomSeed: 42, SimParallelism: 2}
+		images = make(map[string]bool) // exists
+		built  []string
+		mu     sync.Mutex
+	)
+	b := fakes.NewBuilder(&fakes.BuilderHooks{
+		BuildClientImage: func(ctx context.Context, client libhive.ClientDesignator) (string, error) {
+			built = append(built, client.Name())
+			images["id-"+client.ImageTag()] = true
+			return client.ImageTag(), nil
+		},
+		ImageID: func(ctx context.Context, image string) (string, error) {
+			if strings.HasPrefix(image, "id-") {
+				if images[image] {
+					return image, nil
+				}
+				return "", nil
+			}
+			return "id-" + image, nil
+		},
+	})
+	var startedImages []string
+	cb := fakes.NewContainerBackend(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			mu.Lock()
+			startedImages = append(startedImages, image)
+			mu.Unlock()
+			if strings.Contains(image, "/simulator/") {
+				runTestWithClient(t, hivesim.NewAt(opt.Env["HIVE_SIMULATOR"]))
+			}
+			return new(libhive.ContainerInfo), nil
+		},
+	})
+
+	runner := libhive.NewRunner(inv, b, cb)
+	if err := runner.Build(ctx, clients, []string{"sim-1"}, nil, libhive.BuildOptions{}); err != nil {
+		t.Fatal("Build() failed:", err)
+	}
+	if _, err := runner.Run(ctx, "sim-1", env, libhive.HiveInfo{}); err != nil {
+		t.Fatal("Run() failed:", err)
+	}
+
+	// Check the manifest.
+	m, err := libhive.LoadReplayManifest(filepath.Join(env.LogDir, "hive.json"))
+	if err != nil {
+		t.Fatal("can't load replay manifest:", err)
+	}
+	if len(m.Clients) != 2 || len(m.Simulators) != 1 {
+		t.Fatalf("wrong manifest: %+v", m)
+	}
+	c := m.Clients[0]
+	if c.ImageID != "id-"+clients[0].ImageTag() || c.Dockerfile != "Dockerfile" {
+		t.Errorf("wrong client in manifest: %+v", c)
+	}
+	if !reflect.DeepEqual(c.Client.BuildArgs, map[string]string{"tag": "v1"}) {
+		t.Errorf("wrong build args in manifest: %v", c.Client.BuildArgs)
+	}
+	if m.Simulators[0].ImageID != "id-fakebuild/simulator/sim-1:latest" {
+		t.Errorf("wrong simulator in manifest: %+v", m.Simulators[0])
+	}
+	if m.SimRandomSeed != 42 || m.SimParallelism != 2 {
+		t.Errorf("wrong settings in manifest: %+v", m)
+	}
+
+	// Replay with one missing image. It should be rebuilt.
+	delete(images, "id-"+clients[1].ImageTag())
+	built = nil
+	startedImages = nil
+	var replayEnv libhive.SimEnv
+	m.ApplyEnv(&replayEnv)
+	replayEnv.LogDir = t.TempDir()
+	runner = libhive.NewRunner(inv, b, cb)
+	if err := runner.Replay(ctx, m); err != nil {
+		t.Fatal("Replay() failed:", err)
+	}
+	if _, err := runner.Run(ctx, "sim-1", replayEnv, libhive.HiveInfo{}); err != nil {
+		t.Fatal("Run() failed:", err)
+	}
+	if !reflect.DeepEqual(built, []string{"client-2"}) {
+		t.Errorf("wrong clients rebuilt: %v", built)
+	}
+	wantStarted := []string{"id-fakebuild/simulator/sim-1:latest", "id-" + clients[0].ImageTag()}
+	if !reflect.DeepEqual(startedImages, wantStarted) {
+		t.Errorf("wrong images started: %v", startedImages)
+	}
+}
+
+// runTestWithClient runs a test suite containing a single test, which starts a client.
+// This test checks that clients and networks of failed tests are kept running
+// with KeepFailed.
+func TestRunnerKeepFailed(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		deleted  []string
+		removed  []string
+		paused   []*libhive.FailedClient
+		clientID string
+	)
+	inv := makeTestInventory()
+	b := fakes.NewBuilder(&fakes.BuilderHooks{})
+	cb := fakes.NewContainerBackend(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			if !strings.Contains(image, "/simulator/") {
+				return new(libhive.ContainerInfo), nil
+			}
+			sim := hivesim.NewAt(opt.Env["HIVE_SIMULATOR"])
+			suite, _ := sim.StartSuite(&simapi.TestRequest{Name: "suite"}, "")
+			if err := sim.CreateNetwork(suite, "net1"); err != nil {
+				t.Error("CreateNetwork failed:", err)
+			}
+			test, _ := sim.StartTest(suite, hivesim.TestStartInfo{Name: "test"})
+			id, _, err := sim.StartClientWithOptions(suite, test, "client-1")
+			if err != nil {
+				t.Error("StartClient failed:", err)
+			}
+			mu.Lock()
+			clientID = id
+			mu.Unlock()
+			sim.EndTest(suite, test, hivesim.TestResult{Pass: false})
+			sim.EndSuite(suite)
+			return new(libhive.ContainerInfo), nil
+		},
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, containerID)
+			return nil
+		},
+		RemoveNetwork: func(networkID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			removed = append(removed, networkID)
+			return nil
+		},
+	})
+
+	var (
+		runner = libhive.NewRunner(inv, b, cb)
+		simOpt = libhive.SimEnv{
+			LogDir:     t.TempDir(),
+			KeepFailed: true,
+			PauseOnFailure: func(clients []*libhive.FailedClient) {
+				mu.Lock()
+				defer mu.Unlock()
+				paused = append(paused, clients...)
+			},
+		}
+		ctx = context.Background()
+	)
+	if err := runner.Build(ctx, []libhive.ClientDesignator{{Client: "client-1"}}, []string{"sim-1"}, nil, libhive.BuildOptions{}); err != nil {
+		t.Fatal("Build() failed:", err)
+	}
+	if _, err := runner.RunAll(ctx, []string{"sim-1"}, simOpt, libhive.HiveInfo{}); err != nil {
+		t.Fatal("RunAll() failed:", err)
+	}
+
+	mu.Lock()
+	if len(paused) != 1 || paused[0].ID != clientID || paused[0].Test != "test" {
+		t.Errorf("wrong clients passed to PauseOnFailure: %+v", paused)
+	}
+	if slices.Contains(deleted, clientID) {
+		t.Error("client of failed test was deleted")
+	}
+	if len(removed) != 0 {
+		t.Errorf("networks removed: %q", removed)
+	}
+	mu.Unlock()
+	kept := runner.KeptClients()
+	if len(kept) != 1 || kept[0].ID != clientID {
+		t.Fatalf("wrong kept clients: %+v", kept)
+	}
+	if kept[0].Shell != "fake-shell "+clientID {
+		t.Errorf("wrong shell command %q", kept[0].Shell)
+	}
+
+	runner.RemoveKeptClients()
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Contains(deleted, clientID) {
+		t.Error("kept client not deleted")
+	}
+	if len(removed) != 1 {
+		t.Errorf("wrong networks removed: %q", removed)
+	}
+}
+
+// This test checks that the runner collects the test catalog of a simulator when
+// listing tests, without building client images or running tests.
+func TestRunnerListTests(t *testing.T) {
+	inv := makeTestInventory()
+	inv.AddClient("client-1", &libhive.InventoryClient{Meta: libhive.ClientMetadata{Roles: []string{"eth1"}}})
+	b := fakes.NewBuilder(&fakes.BuilderHooks{
+		BuildClientImage: func(ctx context.Context, client libhive.ClientDesignator) (string, error) {
+			t.Error("client image built while listing tests:", client.Client)
+			return client.ImageTag(), nil
+		},
+	})
+	cb := fakes.NewContainerBackend(&fakes.BackendHooks{
+		StartContainer: func(image, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			if !strings.Contains(image, "/simulator/") {
+				t.Error("client started while listing tests")
+				return new(libhive.ContainerInfo), nil
+			}
+			t.Setenv("HIVE_SIMULATOR", opt.Env["HIVE_SIMULATOR"])
+			t.Setenv("HIVE_DOCS_MODE", opt.Env["HIVE_DOCS_MODE"])
+			suite := hivesim.Suite{Name: "suite", Description: "the suite"}
+			suite.Add(hivesim.TestSpec{Name: "plain", Category: "basic", Run: func(t *hivesim.T) {}})
+			suite.Add(hivesim.ClientTestSpec{Name: "CLIENT sync", Role: "eth1", Run: func(t *hivesim.T, c *hivesim.Client) {}})
+			suite.Add(hivesim.TestSpec{Name: "parent", AlwaysRun: true, Run: func(t *hivesim.T) {
+				t.Run(hivesim.TestSpec{Name: "child", Run: func(t *hivesim.T) {}})
+			}})
+			if err := hivesim.RunSuite(hivesim.New(), suite); err != nil {
+				t.Error("RunSuite failed:", err)
+			}
+			return new(libhive.ContainerInfo), nil
+		},
+	})
+
+	var (
+		runner  = libhive.NewRunner(inv, b, cb)
+		clients = []libhive.ClientDesignator{{Client: "client-1"}, {Client: "client-2"}}
+		simOpt  = libhive.SimEnv{LogDir: t.TempDir(), ListTests: true}
+		ctx     = context.Background()
+	)
+	if err := runner.Build(ctx, clients, []string{"sim-1"}, nil, libhive.BuildOptions{SkipClientImages: true}); err != nil {
+		t.Fatal("Build() failed:", err)
+	}
+	result, err := runner.Run(ctx, "sim-1", simOpt, libhive.HiveInfo{})
+	if err != nil {
+		t.Fatal("Run() failed:", err)
+	}
+	want := &simapi.TestCatalog{
+		Simulator: "sim-1",
+		Suites: []simapi.CatalogSuite{{
+			Name:        "suite",
+			Description: "the suite",
+			Tests: []simapi.CatalogTest{
+				{Name: "plain", Category: "basic"},
+				{Name: "client-1 sync", Role: "eth1"},
+				{Name: "parent"},
+				{Name: "child", Parent: "parent"},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(result.Catalog, want) {
+		t.Errorf("wrong catalog %+v", result.Catalog)
+	}
+	if result.Tests != 0 {
+		t.Errorf("tests were recorded as results: %d", result.Tests)
+	}
+}
+
+func runTestWithClient(t *testing.T, sim *hivesim.Simulation) {
+	suite, err := sim.StartSuite(&simapi.TestRequest{Name: "suite"}, "")
+	if err != nil {
+		t.Error("StartSuite failed:", err)
+		return
+	}
+	test, err := sim.StartTest(suite, hivesim.TestStartInfo{Name: "test"})
+	if err != nil {
+		t.Error("StartTest failed:", err)
+		return
+	}
+	if _, _, err := sim.StartClientWithOptions(suite, test, "client-1"); err != nil {
+		t.Error("StartClient failed:", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := sim.EndTest(suite, test, hivesim.TestResult{Pass: true}); err != nil {
+		t.Error("EndTest failed:", err)
+	}
+	if err := sim.EndSuite(suite); err != nil {
+		t.Error("EndSuite failed:", err)
+	}
+}
+
 func makeTestInventory() libhive.Inventory {
 	var inv libhive.Inventory
 	inv.AddClient("client-1", nil)
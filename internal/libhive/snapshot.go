@@ -0,0 +1,86 @@
+package libhive
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// clientSnapshot is a saved state of a client container.
+type clientSnapshot struct {
+	image  string
+	client *ClientDefinition
+}
+
+// SnapshotClient saves the state of a running client container. New clients can be
+// started from the snapshot until the test suite ends. It returns the snapshot ID.
+func (manager *TestManager) SnapshotClient(ctx context.Context, testSuite TestSuiteID, test TestID, nodeID string) (string, error) {
+	if _, ok := manager.IsTestSuiteRunning(testSuite); !ok {
+		return "", ErrNoSuchTestSuite
+	}
+	node, err := manager.GetNodeInfo(testSuite, test, nodeID)
+	if err != nil {
+		return "", err
+	}
+	var client *ClientDefinition
+	for _, def := range manager.clientDefs {
+		if def.Name == node.Name {
+			client = def
+		}
+	}
+	if client == nil {
+		return "", fmt.Errorf("unknown client type %q", node.Name)
+	}
+
+	manager.snapshotMutex.Lock()
+	manager.snapshotCounter++
+	id := fmt.Sprintf("snapshot-%d", manager.snapshotCounter)
+	manager.snapshotMutex.Unlock()
+
+	// The image has the labels of the hive instance, so it can be removed by
+	// 'hive --cleanup' when hive exits before the suite ends.
+	labels := NewBaseLabels(manager.hiveInstanceID, manager.hiveVersion)
+	labels[LabelHiveType] = ContainerTypeSnapshot
+	labels[LabelHiveTestSuite] = testSuite.String()
+	labels[LabelHiveClientName] = client.Name
+	name := fmt.Sprintf("%s-%s", manager.hiveInstanceID, id)
+	image, err := manager.backend.SnapshotContainer(ctx, node.ID, name, labels)
+	if err != nil {
+		return "", err
+	}
+
+	manager.snapshotMutex.Lock()
+	defer manager.snapshotMutex.Unlock()
+	if manager.snapshots[testSuite] == nil {
+		manager.snapshots[testSuite] = make(map[string]*clientSnapshot)
+	}
+	manager.snapshots[testSuite][id] = &clientSnapshot{image: image, client: client}
+	return id, nil
+}
+
+// getSnapshot returns a snapshot of the given suite.
+func (manager *TestManager) getSnapshot(testSuite TestSuiteID, id string) (*clientSnapshot, error) {
+	manager.snapshotMutex.Lock()
+	defer manager.snapshotMutex.Unlock()
+
+	snap, ok := manager.snapshots[testSuite][id]
+	if !ok {
+		return nil, ErrNoSuchSnapshot
+	}
+	return snap, nil
+}
+
+// removeSnapshots deletes all snapshots of a test suite.
+func (manager *TestManager) removeSnapshots(testSuite TestSuiteID) {
+	manager.snapshotMutex.Lock()
+	snapshots := manager.snapshots[testSuite]
+	delete(manager.snapshots, testSuite)
+	manager.snapshotMutex.Unlock()
+
+	for id, snap := range snapshots {
+		slog.Info("removing client snapshot", "id", id, "image", snap.image)
+		if err := manager.backend.DeleteSnapshot(snap.image); err != nil {
+			slog.Error("could not remove snapshot", "id", id, "err", err)
+		}
+	}
+}
@@ -1,22 +1,27 @@
 package libhive
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/ethereum/hive/internal/simapi"
 )
 
 var (
 	ErrNoSuchNode               = errors.New("no such node")
 	ErrNoSuchTestSuite          = errors.New("no such test suite")
 	ErrNoSuchTestCase           = errors.New("no such test case")
+	ErrNoSuchSnapshot           = errors.New("no such snapshot")
 	ErrMissingClientType        = errors.New("missing client type")
 	ErrNoAvailableClients       = errors.New("no available clients")
 	ErrTestSuiteRunning         = errors.New("test suite still has running tests")
@@ -35,12 +40,22 @@ type SimEnv struct {
 	SimParallelism int
 	SimRandomSeed  int
 	SimTestPattern string
+	SimShard       string // "i/n", selects a part of the tests (interpreted by simulators)
+	SimRetries     int
 	SimBuildArgs   []string
 
 	// This is the time limit for the simulation run.
 	// There is no default limit.
 	SimDurationLimit time.Duration
 
+	// This is the default time limit of a single test. Simulators can set other
+	// limits for individual tests. Zero means there is no default limit.
+	SimTestTimeout time.Duration
+
+	// This enables recording of client RPC traffic for all tests. Simulators using
+	// the hivesim library send RPC requests through the recording proxy of hive.
+	SimRecordRPC bool
+
 	// These are the clients which are made available to the simulator.
 	// If unset (i.e. nil), all built clients are used.
 	ClientList []ClientDesignator
@@ -48,14 +63,49 @@ type SimEnv struct {
 	// This configures the amount of time the simulation waits
 	// for the client to open port 8545 after launching the container.
 	ClientStartTimeout time.Duration
+
+	// These are the formats in which suite results are exported, in addition
+	// to the JSON suite file. See ParseResultFormats.
+	ResultFormats []string
+
+	// This holds the results of a previous run. Tests which passed in that run
+	// are skipped, and their results are added to the suites of this run.
+	Resume *ResumeState
+
+	// This is the number of simulators run at the same time by Runner.RunAll.
+	// Values below one mean simulators run one after the other.
+	SimConcurrency int
+
+	// This is the maximum number of client containers running at the same time,
+	// across all simulators. Zero means there is no limit.
+	ClientLimit int
+
+	// This receives progress events of the simulation run. It may be nil.
+	Events *EventFeed
+
+	// KeepFailed makes hive keep the client containers and networks of failed tests.
+	// They are removed by Runner.RemoveKeptClients.
+	KeepFailed bool
+
+	// PauseOnFailure is called when a test fails, before its clients are stopped.
+	// The test does not end until the function returns. It may be nil.
+	PauseOnFailure func([]*FailedClient)
+
+	// ListTests makes simulators collect their tests without running them. The
+	// collected tests are returned in SimResult.Catalog.
+	ListTests bool
 }
 
 // SimResult summarizes the results of a simulation run.
 type SimResult struct {
-	Suites       int
-	SuitesFailed int
-	Tests        int
-	TestsFailed  int
+	Suites       int `json:"suites"`
+	SuitesFailed int `json:"suitesFailed"`
+	Tests        int `json:"tests"`
+	TestsFailed  int `json:"testsFailed"`
+	TestsSkipped int `json:"testsSkipped"`
+
+	// Catalog holds the tests of the simulator when SimEnv.ListTests is set.
+	Catalog *simapi.TestCatalog `json:"catalog,omitempty"`
 }
 
 // HiveInfo contains information about the hive instance running the simulation.
@@ -65,6 +115,10 @@ type HiveInfo struct {
 	ClientFilePath string             `json:"clientFilePath,omitempty"`
 	Commit         string             `json:"commit"`
 	Date           string             `json:"date"`
+
+	// CompletedTests contains the names of tests which passed in a resumed run,
+	// by suite name. Simulators skip these tests.
+	CompletedTests map[string][]string `json:"completedTests,omitempty"`
 }
 
 // TestManager collects test results during a simulation run.
@@ -74,8 +128,10 @@ type TestManager struct {
 	clientDefs []*ClientDefinition
 	hiveInfo   HiveInfo
 
+	simulator      string
 	simContainerID string
 	simLogFile     string
+	catalog        *simapi.TestCatalog // protected by testSuiteMutex
 
 	// Hive instance information for labeling
 	hiveInstanceID string
@@ -86,6 +142,27 @@ type TestManager struct {
 	networks     map[TestSuiteID]map[string]string
 	networkMutex sync.RWMutex
 
+	// containers with network conditions, by suite
+	netemNodes map[TestSuiteID]map[string]struct{}
+
+	// client snapshots of a test suite, by snapshot ID
+	snapshots       map[TestSuiteID]map[string]*clientSnapshot
+	snapshotCounter uint32
+	snapshotMutex   sync.Mutex
+
+	// clients and networks of failed tests which are kept running
+	keptClients  []*FailedClient
+	keptNetworks []string
+	keptSuites   map[TestSuiteID]bool
+	keptMutex    sync.Mutex
+
+	// clientSlots limits the number of running client containers.
+	// It is shared between all test managers of a Runner.
+	clientSlots chan struct{}
+
+	// rpc relays and records client RPC traffic of the simulator.
+	rpc *rpcRecorder
+
 	testCaseMutex     sync.RWMutex
 	testSuiteMutex    sync.RWMutex
 	runningTestSuites map[TestSuiteID]*TestSuite
@@ -103,16 +180,8 @@ func filterClientDesignators(clients []ClientDesignator) []ClientDesignator {
 			Client:        client.Client,
 			Nametag:       client.Nametag,
 			DockerfileExt: client.DockerfileExt,
-			BuildArgs:     make(map[string]string),
+			BuildArgs:     filterBuildArgs(client.BuildArgs),
 		}
-
-		// Filter build args
-		for key, value := range client.BuildArgs {
-			if !excludedBuildArgs[key] {
-				filteredClient.BuildArgs[key] = value
-			}
-		}
-
 		filtered[i] = filteredClient
 	}
 	return filtered
@@ -137,6 +206,10 @@ func NewTestManager(config SimEnv, b ContainerBackend, clients []*ClientDefiniti
 		runningTestCases:  make(map[TestID]*TestCase),
 		results:           make(map[TestSuiteID]*TestSuite),
 		networks:          make(map[TestSuiteID]map[string]string),
+		netemNodes:        make(map[TestSuiteID]map[string]struct{}),
+		snapshots:         make(map[TestSuiteID]map[string]*clientSnapshot),
+		keptSuites:        make(map[TestSuiteID]bool),
+		rpc:               newRPCRecorder(b),
 	}
 }
 
@@ -147,6 +220,46 @@ func (manager *TestManager) SetSimContainerInfo(id, logFile string) {
 	manager.simLogFile = logFile
 }
 
+// SetCatalog stores the test catalog sent by the simulator.
+func (manager *TestManager) SetCatalog(catalog *simapi.TestCatalog) {
+	catalog.Simulator = manager.simulator
+	manager.testSuiteMutex.Lock()
+	defer manager.testSuiteMutex.Unlock()
+	manager.catalog = catalog
+}
+
+// Catalog returns the test catalog of the simulator. If the simulator has not sent
+// a catalog, the catalog is empty.
+func (manager *TestManager) Catalog() *simapi.TestCatalog {
+	manager.testSuiteMutex.RLock()
+	defer manager.testSuiteMutex.RUnlock()
+	if manager.catalog == nil {
+		return &simapi.TestCatalog{Simulator: manager.simulator, Suites: []simapi.CatalogSuite{}}
+	}
+	return manager.catalog
+}
+
+// emit publishes an event of the simulation.
+func (manager *TestManager) emit(ev Event) {
+	ev.Simulator = manager.simulator
+	manager.config.Events.Send(ev)
+}
+
+// acquireClientSlot waits until a client container may be started. The returned
+// function must be called when the container has stopped.
+func (manager *TestManager) acquireClientSlot(ctx context.Context) (release func(), err error) {
+	if manager.clientSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case manager.clientSlots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-manager.clientSlots }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // Results returns the results for all suites that have already ended.
 func (manager *TestManager) Results() map[TestSuiteID]*TestSuite {
 	manager.testSuiteMutex.RLock()
@@ -259,6 +372,9 @@ func (manager *TestManager) CreateNetwork(testSuite TestSuiteID, name string) er
 	if !ok {
 		return ErrNoSuchTestSuite
 	}
+	if name == networkConditionsName {
+		return fmt.Errorf("network name %q is reserved", name)
+	}
 
 	// add network to network map
 	manager.networkMutex.Lock()
@@ -300,6 +416,8 @@ func (manager *TestManager) RemoveNetwork(testSuite TestSuiteID, network string)
 
 // PruneNetworks removes all networks created by the given test suite.
 func (manager *TestManager) PruneNetworks(testSuite TestSuiteID) []error {
+	manager.clearSuiteNetworkConditions(testSuite)
+
 	var errs []error
 	for name := range manager.networks[testSuite] {
 		slog.Info("removing docker network", "name", name)
@@ -414,12 +532,16 @@ func (manager *TestManager) doEndSuite(testSuite TestSuiteID) error {
 		return ErrNoSuchTestSuite
 	}
 	// Check the suite has no running test cases.
+	manager.testCaseMutex.RLock()
 	for k := range suite.TestCases {
 		_, ok := manager.runningTestCases[k]
 		if ok {
+			manager.testCaseMutex.RUnlock()
 			return ErrTestSuiteRunning
 		}
 	}
+	manager.testCaseMutex.RUnlock()
+	manager.mergeResumedTests(suite)
 	if suite.testDetailsFile != nil {
 		suite.testDetailsFile.Close()
 	}
@@ -448,19 +570,26 @@ func (manager *TestManager) doEndSuite(testSuite TestSuiteID) error {
 
 	// Write the result.
 	if manager.config.LogDir != "" {
-		err := writeSuiteFile(suite, manager.config.LogDir)
+		suiteFile, err := writeSuiteFile(suite, manager.config.LogDir)
 		if err != nil {
 			return err
 		}
+		manager.exportSuite(suite, suiteFile)
 	}
+	manager.emit(suiteEvent(EventSuiteEnd, testSuite, suite))
 	// remove the test suite's left-over docker networks.
-	if errs := manager.PruneNetworks(testSuite); len(errs) > 0 {
+	if manager.hasKeptClients(testSuite) {
+		manager.keepNetworks(testSuite)
+	} else if errs := manager.PruneNetworks(testSuite); len(errs) > 0 {
 		for _, err := range errs {
 			slog.Error("could not remove network", "err", err)
 		}
 	}
+	manager.removeSnapshots(testSuite)
 	// Move the suite to results.
+	manager.testCaseMutex.Lock()
 	delete(manager.runningTestSuites, testSuite)
+	manager.testCaseMutex.Unlock()
 	manager.results[testSuite] = suite
 	return nil
 }
@@ -490,7 +619,7 @@ func (manager *TestManager) StartTestSuite(name string, description string) (Tes
 		testLogFile = file
 	}
 
-	manager.runningTestSuites[newSuiteID] = &TestSuite{
+	suite := &TestSuite{
 		ID:              newSuiteID,
 		Name:            name,
 		Description:     description,
@@ -500,12 +629,24 @@ func (manager *TestManager) StartTestSuite(name string, description string) (Tes
 		TestDetailsLog:  testLogPath,
 		testDetailsFile: testLogFile,
 	}
+	// Tests of other suites may be running, so the suite is added with testCaseMutex
+	// held as well.
+	manager.testCaseMutex.Lock()
+	manager.runningTestSuites[newSuiteID] = suite
+	manager.testCaseMutex.Unlock()
 	manager.testSuiteCounter++
+	manager.emit(suiteEvent(EventSuiteStart, newSuiteID, suite))
 	return newSuiteID, nil
 }
 
 // StartTest starts a new test case, returning the testcase id as a context identifier
 func (manager *TestManager) StartTest(testSuiteID TestSuiteID, name string, description string) (TestID, error) {
+	return manager.StartSubtest(testSuiteID, 0, name, description)
+}
+
+// StartSubtest starts a new test case as a subtest of a running test. If parent is
+// zero, the test is a top-level test of the suite.
+func (manager *TestManager) StartSubtest(testSuiteID TestSuiteID, parent TestID, name string, description string) (TestID, error) {
 	manager.testCaseMutex.Lock()
 	defer manager.testCaseMutex.Unlock()
 
@@ -514,6 +655,13 @@ func (manager *TestManager) StartTest(testSuiteID TestSuiteID, name string, desc
 	if !ok {
 		return 0, ErrNoSuchTestSuite
 	}
+	var parentCase *TestCase
+	if parent != 0 {
+		parentCase, ok = manager.runningTestCases[parent]
+		if !ok || testSuite.TestCases[parent] != parentCase {
+			return 0, ErrNoSuchTestCase
+		}
+	}
 	// increment the testcasecounter
 	manager.testCaseCounter++
 	var newCaseID = TestID(manager.testCaseCounter)
@@ -522,11 +670,16 @@ func (manager *TestManager) StartTest(testSuiteID TestSuiteID, name string, desc
 		Name:        name,
 		Description: description,
 		Start:       time.Now(),
+		Parent:      parent,
+	}
+	if parentCase != nil {
+		parentCase.subtests = append(parentCase.subtests, newCaseID)
 	}
 	// add the test case to the test suite
 	testSuite.TestCases[newCaseID] = newTestCase
 	// and to the general map of id:testcases
 	manager.runningTestCases[newCaseID] = newTestCase
+	manager.emit(testEvent(EventTestStart, testSuiteID, newCaseID, newTestCase))
 
 	return newCaseID, nil
 }
@@ -562,40 +715,144 @@ func (manager *TestManager) EndTest(suiteID TestSuiteID, testID TestID, result *
 
 	// Add the results to the test case
 	testCase.End = time.Now()
+	if testCase.timer != nil {
+		testCase.timer.Stop()
+	}
+	testSuite.rollUpSubtests(testCase, result)
+	testCase.subtests = nil
+	if !result.Pass && manager.config.KeepFailed {
+		manager.keepClients(testSuite, testCase)
+	}
+	manager.endAttempt(testSuite, testCase, testCase.Name, result)
+	if len(testCase.Attempts) > 0 && result.Pass {
+		result.Flaky = true
+	}
+	testCase.SummaryResult = *result
+
+	// Delete from running, if it's still there.
+	delete(manager.runningTestCases, testID)
+
+	ev := testEvent(EventTestEnd, suiteID, testID, testCase)
+	ev.Result = new(TestResult)
+	*ev.Result = testCase.SummaryResult
+	manager.emit(ev)
+	return nil
+}
+
+// RetryTest ends a failed attempt of a test case. The clients of the attempt are
+// stopped, and the test case keeps running for the next attempt.
+func (manager *TestManager) RetryTest(suiteID TestSuiteID, testID TestID, result *TestResult) error {
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+
+	testSuite, ok := manager.runningTestSuites[suiteID]
+	if !ok {
+		return ErrNoSuchTestCase
+	}
+	testCase, ok := manager.runningTestCases[testID]
+	if !ok {
+		return ErrNoSuchTestCase
+	}
+	if result == nil {
+		return ErrNoSummaryResult
+	}
+
+	attempt := &TestAttempt{
+		Start:        testCase.Start,
+		End:          time.Now(),
+		ClientInfo:   testCase.ClientInfo,
+		Measurements: testCase.Measurements,
+	}
+	if n := len(testCase.Attempts); n > 0 {
+		attempt.Start = testCase.Attempts[n-1].End
+	}
+	name := fmt.Sprintf("%s (attempt %d)", testCase.Name, len(testCase.Attempts)+1)
+	testSuite.rollUpSubtests(testCase, result)
+	testCase.subtests = nil
+	attempt.Subtests = testSuite.removeSubtests(testID)
+	manager.endAttempt(testSuite, testCase, name, result)
+	attempt.Result = *result
+	testCase.Attempts = append(testCase.Attempts, attempt)
+	testCase.ClientInfo = nil
+	testCase.Measurements = nil
+	if testCase.timer != nil {
+		// The time limit applies to each attempt.
+		testCase.timer.Reset(testCase.timeout)
+	}
+
+	ev := testEvent(EventTestRetry, suiteID, testID, testCase)
+	ev.Result = new(TestResult)
+	*ev.Result = attempt.Result
+	manager.emit(ev)
+	return nil
+}
+
+// RecordMeasurement adds a measurement to a running test case. A measurement with
+// the same name as an earlier one replaces it.
+func (manager *TestManager) RecordMeasurement(testID TestID, m simapi.Measurement) error {
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+
+	testCase, ok := manager.runningTestCases[testID]
+	if !ok {
+		return ErrNoSuchTestCase
+	}
+	for i := range testCase.Measurements {
+		if testCase.Measurements[i].Name == m.Name {
+			testCase.Measurements[i] = m
+			return nil
+		}
+	}
+	testCase.Measurements = append(testCase.Measurements, m)
+	return nil
+}
+
+// endAttempt stores the test log and stops the clients of a test case.
+// This must be called with testCaseMutex held.
+func (manager *TestManager) endAttempt(testSuite *TestSuite, testCase *TestCase, name string, result *TestResult) {
+	if !result.Pass {
+		result.Skipped = false // a test which failed before skipping counts as failed
+	}
+	for _, v := range testCase.ClientInfo {
+		v.recordCrash(result)
+	}
 	if result.Details != "" && testSuite.testDetailsFile != nil {
-		offsets := manager.writeTestDetails(testSuite, testCase, result.Details)
+		offsets := testSuite.writeTestDetails(name, result.Details)
 		result.Details = ""
 		result.LogOffsets = offsets
 	}
-	testCase.SummaryResult = *result
 
-	// Capture log end offsets for all clients before stopping them.
+	// Capture log end offsets and resource usage for all clients before stopping them.
 	// This enables log filtering when a client serves multiple tests.
 	for _, v := range testCase.ClientInfo {
 		if v.LogOffsets != nil && manager.config.LogDir != "" {
 			logFilePath := filepath.Join(manager.config.LogDir, filepath.FromSlash(v.LogFile))
 			v.LogOffsets.End = logFileSize(logFilePath)
 		}
+		v.recordUsage()
 	}
 
-	// Stop running clients.
+	// Stop running clients, and remove the containers of clients stopped during the test.
 	for _, v := range testCase.ClientInfo {
-		if v.wait != nil {
+		switch {
+		case v.wait != nil:
+			v.state.stopping = true
 			manager.backend.DeleteContainer(v.ID)
 			v.wait()
 			v.wait = nil
+		case v.stopped:
+			manager.backend.DeleteContainer(v.ID)
 		}
+		v.stopped = false
 	}
-
-	// Delete from running, if it's still there.
-	delete(manager.runningTestCases, testID)
-	return nil
 }
 
-func (manager *TestManager) writeTestDetails(suite *TestSuite, testCase *TestCase, text string) *TestLogOffsets {
+// writeTestDetails appends the log of a test to the details file of the suite, and
+// returns the offsets of the log in the file.
+func (suite *TestSuite) writeTestDetails(name string, text string) *TestLogOffsets {
 	var (
 		begin   = suite.testLogOffset
-		header  = "-- " + testCase.Name + "\n"
+		header  = "-- " + name + "\n"
 		footer  = "\n\n"
 		offsets TestLogOffsets
 	)
@@ -633,7 +890,8 @@ func (manager *TestManager) RegisterNode(testID TestID, nodeID string, nodeInfo
 	return nil
 }
 
-// StopNode stops a client container.
+// StopNode stops a client container. The container is removed when the test ends,
+// so files can be downloaded from the stopped client until then.
 func (manager *TestManager) StopNode(testID TestID, nodeID string) error {
 	manager.testCaseMutex.Lock()
 	defer manager.testCaseMutex.Unlock()
@@ -648,11 +906,14 @@ func (manager *TestManager) StopNode(testID TestID, nodeID string) error {
 	}
 	// Stop the container.
 	if nodeInfo.wait != nil {
-		if err := manager.backend.DeleteContainer(nodeInfo.ID); err != nil {
+		nodeInfo.recordUsage()
+		nodeInfo.state.stopping = true
+		if err := manager.backend.StopContainer(nodeInfo.ID); err != nil {
 			return fmt.Errorf("unable to stop client: %v", err)
 		}
 		nodeInfo.wait()
 		nodeInfo.wait = nil
+		nodeInfo.stopped = true
 	}
 	return nil
 }
@@ -709,10 +970,21 @@ var excludedBuildArgs = map[string]bool{
 	"TOKEN":        true, // Generic tokens
 }
 
-func writeSuiteFile(s *TestSuite, logdir string) error {
+// filterBuildArgs returns a copy of build args without sensitive values.
+func filterBuildArgs(args map[string]string) map[string]string {
+	filtered := make(map[string]string, len(args))
+	for key, value := range args {
+		if !excludedBuildArgs[key] {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+func writeSuiteFile(s *TestSuite, logdir string) (string, error) {
 	suiteData, err := json.Marshal(s)
 	if err != nil {
-		return err
+		return "", err
 	}
 	// Randomize the name, but make it so that it's ordered by date - makes cleanups easier
 	b := make([]byte, 16)
@@ -720,5 +992,29 @@ func writeSuiteFile(s *TestSuite, logdir string) error {
 	suiteFileName := fmt.Sprintf("%v-%x.json", time.Now().Unix(), b)
 	suiteFile := filepath.Join(logdir, suiteFileName)
 	// Write it.
-	return os.WriteFile(suiteFile, suiteData, 0644)
+	return suiteFileName, os.WriteFile(suiteFile, suiteData, 0644)
+}
+
+// exportSuite writes the suite result in the configured export formats.
+// The exported files are placed next to the suite file.
+func (manager *TestManager) exportSuite(suite *TestSuite, suiteFile string) {
+	fsys := os.DirFS(manager.config.LogDir)
+	for _, format := range manager.config.ResultFormats {
+		file := filepath.Join(manager.config.LogDir, ExportFileName(suiteFile, format))
+		if err := writeExportFile(file, format, suite, fsys); err != nil {
+			slog.Error("could not export suite result", "suite", suite.Name, "format", format, "err", err)
+		}
+	}
+}
+
+func writeExportFile(file, format string, suite *TestSuite, fsys fs.FS) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := ExportSuite(f, format, suite, fsys); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
@@ -10,7 +10,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/ethereum/hive/hivesim"
 	"github.com/ethereum/hive/internal/fakes"
 	"github.com/ethereum/hive/internal/libhive"
 	"github.com/ethereum/hive/internal/simapi"
@@ -193,3 +195,99 @@ func registerMultiTestNodeHTTP(t *testing.T, baseURL string, suiteID libhive.Tes
 		t.Fatalf("registerMultiTestNode returned status %d", resp.StatusCode)
 	}
 }
+
+func TestTestTimeout(t *testing.T) {
+	backend := fakes.NewContainerBackend(nil)
+	env := libhive.SimEnv{SimTestTimeout: 50 * time.Millisecond}
+	tm := libhive.NewTestManager(env, backend, nil, libhive.HiveInfo{})
+	srv := httptest.NewServer(tm.API())
+	defer srv.Close()
+
+	sim := hivesim.NewAt(srv.URL)
+	suite, err := sim.StartSuite(&simapi.TestRequest{Name: "suite"}, "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	defaultTest, err := sim.StartTest(suite, hivesim.TestStartInfo{Name: "default timeout"})
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	noTimeoutTest, err := sim.StartTest(suite, hivesim.TestStartInfo{Name: "no timeout", Timeout: -1})
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	// Wait for hive to end the test.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, running := tm.IsTestRunning(libhive.TestID(defaultTest)); !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("test was not ended")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, running := tm.IsTestRunning(libhive.TestID(noTimeoutTest)); !running {
+		t.Fatal("test without timeout was ended")
+	}
+
+	// Ending the timed out test again fails.
+	if err := sim.EndTest(suite, defaultTest, hivesim.TestResult{Pass: true}); err == nil {
+		t.Error("no error for ending timed out test")
+	}
+	sim.EndTest(suite, noTimeoutTest, hivesim.TestResult{Pass: true})
+	if err := sim.EndSuite(suite); err != nil {
+		t.Fatal("can't end suite:", err)
+	}
+
+	result := tm.Results()[libhive.TestSuiteID(suite)].TestCases[libhive.TestID(defaultTest)].SummaryResult
+	if result.Pass || !result.Timeout {
+		t.Errorf("wrong result of timed out test: %+v", result)
+	}
+	if result.Details != "test timed out after 50ms\n" {
+		t.Errorf("wrong details: %q", result.Details)
+	}
+}
+
+// This test checks that subtests can only be started while their parent is running,
+// and that the parent fails when a subtest has failed.
+func TestStartSubtest(t *testing.T) {
+	tm := libhive.NewTestManager(libhive.SimEnv{}, fakes.NewContainerBackend(nil), nil, libhive.HiveInfo{})
+	suiteID, err := tm.StartTestSuite("suite", "")
+	if err != nil {
+		t.Fatal("StartTestSuite:", err)
+	}
+	parentID, err := tm.StartTest(suiteID, "parent", "")
+	if err != nil {
+		t.Fatal("StartTest:", err)
+	}
+	subID, err := tm.StartSubtest(suiteID, parentID, "sub", "")
+	if err != nil {
+		t.Fatal("StartSubtest:", err)
+	}
+	if _, err := tm.StartSubtest(suiteID, 99, "sub2", ""); err != libhive.ErrNoSuchTestCase {
+		t.Fatal("StartSubtest with unknown parent returned wrong error:", err)
+	}
+	if err := tm.EndTest(suiteID, subID, &libhive.TestResult{Details: "sub failed\n"}); err != nil {
+		t.Fatal("EndTest (sub):", err)
+	}
+	if err := tm.EndTest(suiteID, parentID, &libhive.TestResult{Pass: true}); err != nil {
+		t.Fatal("EndTest (parent):", err)
+	}
+	if _, err := tm.StartSubtest(suiteID, parentID, "late", ""); err != libhive.ErrNoSuchTestCase {
+		t.Fatal("StartSubtest with ended parent returned wrong error:", err)
+	}
+	if err := tm.EndTestSuite(suiteID); err != nil {
+		t.Fatal("EndTestSuite:", err)
+	}
+
+	tests := tm.Results()[suiteID].TestCases
+	if tests[subID].Parent != parentID {
+		t.Errorf("wrong parent %d, want %d", tests[subID].Parent, parentID)
+	}
+	want := libhive.TestResult{Details: "1 of 1 subtests failed:\n  sub\n"}
+	if got := tests[parentID].SummaryResult; got != want {
+		t.Errorf("wrong parent result %+v, want %+v", got, want)
+	}
+}
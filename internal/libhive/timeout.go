@@ -0,0 +1,40 @@
+package libhive
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// startTestTimer applies the time limit of a test case. If timeout is zero, the
+// default limit of the simulation is used. A negative timeout means the simulator
+// enforces the limit itself.
+func (manager *TestManager) startTestTimer(suiteID TestSuiteID, testID TestID, timeout time.Duration) {
+	if timeout == 0 {
+		timeout = manager.config.SimTestTimeout
+	}
+	if timeout <= 0 {
+		return
+	}
+
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+	if testCase, ok := manager.runningTestCases[testID]; ok {
+		testCase.timeout = timeout
+		testCase.timer = time.AfterFunc(timeout, func() {
+			manager.timeoutTest(suiteID, testID, timeout)
+		})
+	}
+}
+
+// timeoutTest ends a test case which has exceeded its time limit.
+func (manager *TestManager) timeoutTest(suiteID TestSuiteID, testID TestID, timeout time.Duration) {
+	result := &TestResult{
+		Pass:    false,
+		Timeout: true,
+		Details: fmt.Sprintf("test timed out after %v\n", timeout),
+	}
+	if err := manager.EndTest(suiteID, testID, result); err == nil {
+		slog.Warn("test timed out", "suite", suiteID, "test", testID, "timeout", timeout)
+	}
+}
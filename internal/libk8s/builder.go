@@ -0,0 +1,62 @@
+package libk8s
+
+import (
+	"context"
+	"io/fs"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// ImagePusher publishes locally built images to a registry.
+type ImagePusher interface {
+	PushImage(ctx context.Context, image, registry string) error
+}
+
+// Builder wraps an image builder, pushing all built images to the registry
+// used by the cluster.
+type Builder struct {
+	libhive.Builder
+	pusher   ImagePusher
+	registry string
+}
+
+// NewBuilder creates a pushing builder. The image names returned by the builder are
+// the names of the local images. They are mapped to the registry by the container
+// backend when creating pods.
+func NewBuilder(b libhive.Builder, pusher ImagePusher, registry string) *Builder {
+	return &Builder{Builder: b, pusher: pusher, registry: registry}
+}
+
+// BuildClientImage builds a client image and pushes it.
+func (b *Builder) BuildClientImage(ctx context.Context, client libhive.ClientDesignator) (string, error) {
+	image, err := b.Builder.BuildClientImage(ctx, client)
+	if err != nil {
+		return image, err
+	}
+	return image, b.pusher.PushImage(ctx, image, b.registry)
+}
+
+// BuildSimulatorImage builds a simulator image and pushes it.
+func (b *Builder) BuildSimulatorImage(ctx context.Context, name string, buildArgs map[string]string) (string, error) {
+	image, err := b.Builder.BuildSimulatorImage(ctx, name, buildArgs)
+	if err != nil {
+		return image, err
+	}
+	return image, b.pusher.PushImage(ctx, image, b.registry)
+}
+
+// BuildImage builds an image and pushes it. Nothing is pushed if the build fails.
+func (b *Builder) BuildImage(ctx context.Context, name string, fsys fs.FS) error {
+	if err := b.Builder.BuildImage(ctx, name, fsys); err != nil {
+		return err
+	}
+	return b.pusher.PushImage(ctx, name, b.registry)
+}
+
+// registryImage returns the name of an image in the registry.
+func registryImage(registry, image string) string {
+	if registry == "" {
+		return image
+	}
+	return registry + "/" + image
+}
@@ -0,0 +1,766 @@
+package libk8s
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/hive/internal/libdocker"
+	"github.com/ethereum/hive/internal/libhive"
+	"github.com/ethereum/hive/internal/simapi"
+)
+
+const (
+	labelType          = "hive.ethereum.org/type"
+	labelInstance      = "hive.ethereum.org/instance"
+	labelNetworkPrefix = "hive.ethereum.org/net-"
+	annotationName     = "hive.ethereum.org/name"
+
+	mainContainer = "main"
+	initContainer = "hive-init"
+	filesVolume   = "hive-files"
+	filesDir      = "/hive-files"
+	startMarker   = filesDir + "/.hive-start"
+
+	bridgeNetworkID = "bridge"
+	isolationPolicy = "hive-isolation"
+
+	pollInterval = 250 * time.Millisecond
+)
+
+// ContainerBackend runs hive containers as pods.
+type ContainerBackend struct {
+	api       *apiClient
+	config    *Config
+	logger    *slog.Logger
+	namespace string
+
+	// Running API proxies.
+	proxies libdocker.ProxySet
+
+	// Hive instance information for labeling
+	hiveInstanceID string
+	hiveVersion    string
+}
+
+// Connect creates the container backend and checks that the API server is reachable.
+// It also sets up the network policies for the default network.
+func Connect(ctx context.Context, cluster *Cluster, cfg *Config) (*ContainerBackend, error) {
+	b := NewContainerBackend(cluster, cfg)
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if err := b.api.do(ctx, http.MethodGet, "/version", nil, &version); err != nil {
+		return nil, fmt.Errorf("can't connect to kubernetes: %v", err)
+	}
+	b.logger.Debug("kubernetes API server online", "server", cluster.Server, "version", version.GitVersion, "namespace", b.namespace)
+
+	if err := b.createBasePolicies(ctx); err != nil {
+		return nil, fmt.Errorf("can't create network policies: %v", err)
+	}
+	return b, nil
+}
+
+func NewContainerBackend(cluster *Cluster, cfg *Config) *ContainerBackend {
+	b := &ContainerBackend{api: newAPIClient(cluster), config: cfg, logger: cfg.Logger}
+	if b.logger == nil {
+		b.logger = slog.Default()
+	}
+	b.namespace = cfg.Namespace
+	if b.namespace == "" {
+		b.namespace = cluster.Namespace
+	}
+	if b.namespace == "" {
+		b.namespace = "default"
+	}
+	return b
+}
+
+// SetHiveInstanceInfo sets the hive instance information for container labeling.
+func (b *ContainerBackend) SetHiveInstanceInfo(instanceID, version string) {
+	b.hiveInstanceID = instanceID
+	b.hiveVersion = version
+}
+
+// GetDockerClient returns nil because there is no Docker daemon backing the containers.
+func (b *ContainerBackend) GetDockerClient() interface{} {
+	return nil
+}
+
+// image returns the name of an image in the cluster registry.
+func (b *ContainerBackend) image(name string) string {
+	return registryImage(b.config.Registry, name)
+}
+
+func (b *ContainerBackend) pullPolicy() string {
+	if b.config.Registry != "" {
+		return "Always"
+	}
+	return "IfNotPresent"
+}
+
+func (b *ContainerBackend) podPath(name string) string {
+	p := "/api/v1/namespaces/" + b.namespace + "/pods"
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+func (b *ContainerBackend) policyPath(name string) string {
+	p := "/apis/networking.k8s.io/v1/namespaces/" + b.namespace + "/networkpolicies"
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+// CreateContainer creates a pod. The main container of the pod does not run until
+// StartContainer is called.
+func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string, opt libhive.ContainerOptions) (string, error) {
+	name, err := newPodName()
+	if err != nil {
+		return "", err
+	}
+
+	vars := make([]envVar, 0, len(opt.Env))
+	for key, val := range opt.Env {
+		vars = append(vars, envVar{Name: key, Value: val})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+
+	// Uploaded files are placed into a shared volume by the init container,
+	// and mounted into the main container at their destination path.
+	var mounts []volumeMount
+	for _, file := range sortedFiles(opt.Files) {
+		p := path.Clean("/" + file)
+		mounts = append(mounts, volumeMount{Name: filesVolume, MountPath: p, SubPath: p[1:]})
+	}
+
+	var (
+		noServiceLinks = false
+		noToken        = false
+		gracePeriod    = int64(1)
+	)
+	p := &pod{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata: objectMeta{
+			Name:        name,
+			Labels:      b.podLabels(opt.Labels),
+			Annotations: map[string]string{annotationName: opt.Name},
+		},
+		Spec: podSpec{
+			RestartPolicy:                 "Never",
+			EnableServiceLinks:            &noServiceLinks,
+			AutomountServiceAccountToken:  &noToken,
+			TerminationGracePeriodSeconds: &gracePeriod,
+			Volumes:                       []volume{{Name: filesVolume, EmptyDir: &struct{}{}}},
+			InitContainers: []container{{
+				Name:            initContainer,
+				Image:           b.image(hiveproxyTag),
+				ImagePullPolicy: b.pullPolicy(),
+				Command:         []string{"sh", "-c", "until [ -f " + startMarker + " ]; do sleep 0.1; done"},
+				VolumeMounts:    []volumeMount{{Name: filesVolume, MountPath: filesDir}},
+			}},
+			Containers: []container{{
+				Name:            mainContainer,
+				Image:           b.image(imageName),
+				ImagePullPolicy: b.pullPolicy(),
+				Env:             vars,
+				VolumeMounts:    mounts,
+				Stdin:           opt.Input != nil,
+				StdinOnce:       opt.Input != nil,
+				Resources:       b.containerResources(opt.Resources),
+			}},
+		},
+	}
+	for k, v := range opt.Labels {
+		p.Metadata.Annotations[k] = v
+	}
+	if err := b.api.do(ctx, http.MethodPost, b.podPath(""), p, nil); err != nil {
+		return "", err
+	}
+	logger := b.logger.With("image", imageName, "container", name[:8])
+
+	// Wait for the init container, then upload files into the shared volume.
+	_, err = b.waitPod(ctx, name, func(p *pod) (bool, error) {
+		return containerStarted(p, initContainer)
+	})
+	if err == nil {
+		err = b.uploadFiles(ctx, name, opt.Files)
+	}
+	if err != nil {
+		logger.Error("container setup failed", "err", err)
+		b.DeleteContainer(name)
+		return "", err
+	}
+	logger.Debug("container created")
+	return name, nil
+}
+
+// podLabels creates the Kubernetes labels of a pod. Hive labels are stored as
+// annotations because their values are not valid label values.
+func (b *ContainerBackend) podLabels(hiveLabels map[string]string) map[string]string {
+	labels := map[string]string{
+		labelType:                            "other",
+		labelNetworkPrefix + bridgeNetworkID: "true",
+	}
+	if t := hiveLabels[libhive.LabelHiveType]; t != "" {
+		labels[labelType] = t
+	}
+	if id := hiveLabels[libhive.LabelHiveInstance]; id != "" && len(id) <= 63 {
+		labels[labelInstance] = id
+	}
+	return labels
+}
+
+// containerResources converts resource limits to the container resources of the pod spec.
+// CPU shares are converted to a CPU request, using the Docker convention of 1024 shares
+// per CPU.
+func (b *ContainerBackend) containerResources(r simapi.Resources) *resources {
+	res := &resources{Limits: make(map[string]string), Requests: make(map[string]string)}
+	if r.CPUs > 0 {
+		res.Limits["cpu"] = fmt.Sprintf("%dm", int64(r.CPUs*1000))
+	}
+	if r.CPUShares > 0 {
+		res.Requests["cpu"] = fmt.Sprintf("%dm", r.CPUShares*1000/1024)
+	}
+	if r.Memory > 0 {
+		res.Limits["memory"] = strconv.FormatInt(r.Memory, 10)
+	}
+	if r.Pids > 0 {
+		b.logger.Warn("process limits are not supported on Kubernetes", "pids", r.Pids)
+	}
+	if len(res.Limits) == 0 && len(res.Requests) == 0 {
+		return nil
+	}
+	return res
+}
+
+// StartContainer starts the main container of a pod.
+func (b *ContainerBackend) StartContainer(ctx context.Context, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+	proxy := b.proxies.Live()
+	if opt.CheckLive != 0 && proxy == nil {
+		panic("attempt to start container with CheckLive, but proxy is not running")
+	}
+	if opt.Output != nil && opt.LogFile != "" {
+		return nil, fmt.Errorf("can't use LogFile and Output options at the same time")
+	}
+
+	info := &libhive.ContainerInfo{ID: containerID, LogFile: opt.LogFile}
+	logger := b.logger.With("container", containerID[:8])
+
+	// Release the init container and wait for the main container to run.
+	var startTime = time.Now()
+	p, err := b.startPod(ctx, containerID)
+	if err != nil {
+		b.DeleteContainer(containerID)
+		return nil, fmt.Errorf("container did not start: %v", err)
+	}
+	info.IP = p.Status.PodIP
+
+	// Attach to the container output. This goroutine relays the output
+	// and waits for the container to end.
+	relay, err := b.openOutput(logger, containerID, opt)
+	if err != nil {
+		b.DeleteContainer(containerID)
+		return nil, err
+	}
+	containerExit := make(chan struct{})
+	go func() {
+		defer close(containerExit)
+		err := relay()
+		logger.Debug("container output closed", "err", err)
+		b.waitTerminated(containerID)
+		logger.Debug("container exited")
+	}()
+	info.Wait = func() { <-containerExit }
+
+	if info.IP == "" && p.containerState(mainContainer).Terminated == nil {
+		b.DeleteContainer(containerID)
+		info.Wait()
+		info.Wait = nil
+		return info, fmt.Errorf("container has no IP address")
+	}
+
+	// Set up the port check if requested.
+	hasStarted := make(chan struct{})
+	if opt.CheckLive != 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		addr := &net.TCPAddr{IP: net.ParseIP(info.IP), Port: int(opt.CheckLive)}
+		go func() {
+			err := proxy.CheckLive(ctx, addr)
+			if err == nil {
+				close(hasStarted)
+			}
+		}()
+	} else {
+		close(hasStarted)
+	}
+
+	// Wait for events.
+	var checkErr error
+	select {
+	case <-hasStarted:
+		logger.Debug("container online", "time", time.Since(startTime))
+	case <-containerExit:
+		checkErr = errors.New("terminated unexpectedly")
+	case <-ctx.Done():
+		checkErr = errors.New("timed out waiting for container startup")
+	}
+	if checkErr != nil {
+		b.DeleteContainer(containerID)
+		info.Wait()
+		info.Wait = nil
+	}
+	return info, checkErr
+}
+
+// startPod releases the init container of a pod and waits until the main
+// container is running.
+func (b *ContainerBackend) startPod(ctx context.Context, name string) (*pod, error) {
+	code, err := b.exec(ctx, name, initContainer, []string{"touch", startMarker}, streamIO{})
+	if err != nil {
+		return nil, err
+	}
+	if code != 0 {
+		return nil, fmt.Errorf("init container exited with code %d", code)
+	}
+	return b.waitPod(ctx, name, func(p *pod) (bool, error) {
+		return containerStarted(p, mainContainer)
+	})
+}
+
+// openOutput attaches to the main container of a pod, or requests its log for
+// writing into the log file. The returned function relays the output until the
+// stream ends.
+func (b *ContainerBackend) openOutput(logger *slog.Logger, name string, opt libhive.ContainerOptions) (func() error, error) {
+	var (
+		prefixer io.WriteCloser
+		closers  []io.Closer
+	)
+	closeAll := func() {
+		for _, c := range closers {
+			if err := c.Close(); err != nil {
+				logger.Error("failed to close fd", "err", err)
+			}
+		}
+	}
+	if b.config.ContainerOutput != nil {
+		prefixer = libdocker.NewLinePrefixWriter(b.config.ContainerOutput, fmt.Sprintf("[%s] ", name[:8]))
+		closers = append(closers, prefixer)
+	}
+
+	var relay func() error
+	switch {
+	case opt.Output != nil:
+		closers = append(closers, opt.Output)
+		sio := streamIO{stdout: opt.Output}
+		if prefixer != nil {
+			sio.stderr = prefixer
+		}
+		q := url.Values{"container": {mainContainer}, "stdout": {"true"}, "stderr": {"true"}}
+		if opt.Input != nil {
+			closers = append(closers, opt.Input)
+			sio.stdin = opt.Input
+			q.Set("stdin", "true")
+		}
+		logger.Debug("attaching to container", "stdin", opt.Input != nil)
+		s, err := b.api.dialStream(context.Background(), b.podPath(name)+"/attach", q)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		relay = func() error {
+			_, err := s.run(sio)
+			return err
+		}
+
+	case opt.LogFile != "":
+		// Redirect container output to logfile.
+		if err := os.MkdirAll(filepath.Dir(opt.LogFile), 0755); err != nil {
+			closeAll()
+			return nil, err
+		}
+		log, err := os.OpenFile(opt.LogFile, os.O_WRONLY|os.O_CREATE|os.O_SYNC|os.O_TRUNC, 0644)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		closers = append(closers, log)
+		var out io.Writer = log
+		if prefixer != nil {
+			out = io.MultiWriter(log, prefixer)
+		}
+		q := url.Values{"container": {mainContainer}, "follow": {"true"}}
+		resp, err := b.api.request(context.Background(), http.MethodGet, b.podPath(name)+"/log", q, nil, "")
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		closers = append(closers, resp.Body)
+		relay = func() error {
+			_, err := io.Copy(out, resp.Body)
+			return err
+		}
+
+	default:
+		relay = func() error { return nil }
+	}
+
+	return func() error {
+		defer closeAll()
+		return relay()
+	}, nil
+}
+
+// waitTerminated blocks until the main container of a pod has stopped, or the pod is deleted.
+func (b *ContainerBackend) waitTerminated(name string) {
+	for {
+		var p pod
+		err := b.api.do(context.Background(), http.MethodGet, b.podPath(name), nil, &p)
+		if isNotFound(err) {
+			return
+		}
+		if err == nil && (p.containerState(mainContainer).Terminated != nil || p.Status.Phase == "Failed" || p.Status.Phase == "Succeeded") {
+			return
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// waitPod polls the pod until the condition is met.
+func (b *ContainerBackend) waitPod(ctx context.Context, name string, cond func(*pod) (bool, error)) (*pod, error) {
+	for {
+		var p pod
+		if err := b.api.do(ctx, http.MethodGet, b.podPath(name), nil, &p); err != nil {
+			return nil, err
+		}
+		ok, err := cond(&p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &p, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// containerStarted reports whether the named container of a pod has started. It returns
+// an error if the container can't be started.
+func containerStarted(p *pod, name string) (bool, error) {
+	if p.Status.Phase == "Failed" {
+		return false, fmt.Errorf("pod failed")
+	}
+	state := p.containerState(name)
+	switch {
+	case state.Running != nil, state.Terminated != nil:
+		return true, nil
+	case state.Waiting != nil:
+		switch state.Waiting.Reason {
+		case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError", "CreateContainerError":
+			return false, fmt.Errorf("%s: %s", state.Waiting.Reason, state.Waiting.Message)
+		}
+	}
+	return false, nil
+}
+
+// DeleteContainer removes the given pod. If the pod is running, it is stopped.
+func (b *ContainerBackend) DeleteContainer(containerID string) error {
+	b.logger.Debug("removing container", "container", containerID[:8])
+	err := b.api.do(context.Background(), http.MethodDelete, b.podPath(containerID)+"?gracePeriodSeconds=0", nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		b.logger.Error("can't remove container", "container", containerID[:8], "err", err)
+	}
+	return err
+}
+
+// StopContainer removes the pod of a container. Pods can't be stopped without
+// removing them, so files of stopped clients can't be downloaded on Kubernetes.
+func (b *ContainerBackend) StopContainer(containerID string) error {
+	return b.DeleteContainer(containerID)
+}
+
+var errPauseUnsupported = errors.New("pausing containers is not supported on kubernetes")
+
+// PauseContainer is not supported by Kubernetes.
+func (b *ContainerBackend) PauseContainer(containerID string) error {
+	return errPauseUnsupported
+}
+
+// UnpauseContainer is not supported by Kubernetes.
+func (b *ContainerBackend) UnpauseContainer(containerID string) error {
+	return errPauseUnsupported
+}
+
+var errSnapshotUnsupported = errors.New("client snapshots are not supported on kubernetes")
+
+// SnapshotContainer is not supported by Kubernetes.
+func (b *ContainerBackend) SnapshotContainer(ctx context.Context, containerID string, name string, labels map[string]string) (string, error) {
+	return "", errSnapshotUnsupported
+}
+
+// DeleteSnapshot is not supported by Kubernetes.
+func (b *ContainerBackend) DeleteSnapshot(image string) error {
+	return errSnapshotUnsupported
+}
+
+var errDownloadUnsupported = errors.New("downloading files from clients is not supported on kubernetes")
+
+// DownloadFiles is not supported by Kubernetes.
+func (b *ContainerBackend) DownloadFiles(ctx context.Context, containerID string, path string) (io.ReadCloser, error) {
+	return nil, errDownloadUnsupported
+}
+
+var errNetworkScriptUnsupported = errors.New("network conditions are not supported on kubernetes")
+
+// RunNetworkScript is not supported by Kubernetes.
+func (b *ContainerBackend) RunNetworkScript(ctx context.Context, containerID string, script string, labels map[string]string) (*libhive.ExecInfo, error) {
+	return nil, errNetworkScriptUnsupported
+}
+
+// ShellCommand returns the command for opening a shell in the main container of a pod.
+func (b *ContainerBackend) ShellCommand(containerID string) string {
+	return fmt.Sprintf("kubectl exec -it -n %s %s -c %s -- sh", b.namespace, containerID, mainContainer)
+}
+
+// RunProgram runs a command in the main container of a pod.
+func (b *ContainerBackend) RunProgram(ctx context.Context, containerID string, cmd []string) (*libhive.ExecInfo, error) {
+	outputBuf := new(bytes.Buffer)
+	errBuf := new(bytes.Buffer)
+	code, err := b.exec(ctx, containerID, mainContainer, cmd, streamIO{stdout: outputBuf, stderr: errBuf})
+	if err != nil {
+		return nil, fmt.Errorf("can't run exec %v: %v", cmd, err)
+	}
+	return &libhive.ExecInfo{
+		Stdout:   outputBuf.String(),
+		Stderr:   errBuf.String(),
+		ExitCode: code,
+	}, nil
+}
+
+// exec runs a command in a container and returns its exit code.
+func (b *ContainerBackend) exec(ctx context.Context, podName, containerName string, cmd []string, sio streamIO) (int, error) {
+	q := url.Values{"container": {containerName}, "command": cmd, "stdout": {"true"}, "stderr": {"true"}}
+	if sio.stdin != nil {
+		q.Set("stdin", "true")
+	}
+	s, err := b.api.dialStream(ctx, b.podPath(podName)+"/exec", q)
+	if err != nil {
+		return 0, err
+	}
+	st, err := s.run(sio)
+	if err != nil {
+		return 0, err
+	}
+	return exitCode(st)
+}
+
+// uploadFiles extracts the given files into the shared volume of a pod.
+func (b *ContainerBackend) uploadFiles(ctx context.Context, name string, files map[string]*multipart.FileHeader) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	// Create the archive.
+	archive := new(bytes.Buffer)
+	tw := tar.NewWriter(archive)
+	for _, filePath := range sortedFiles(files) {
+		fileHeader := files[filePath]
+		header := &tar.Header{Name: path.Clean("/" + filePath)[1:], Mode: 0777, Size: fileHeader.Size}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return err
+		}
+		_, copyErr := io.Copy(tw, file)
+		file.Close()
+		if copyErr != nil {
+			return copyErr
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	// Stream it into the init container. The size is passed along because
+	// not all API server versions can signal the end of input.
+	size := strconv.Itoa(archive.Len())
+	cmd := []string{"sh", "-c", "head -c " + size + " | tar -x -C " + filesDir}
+	errBuf := new(bytes.Buffer)
+	code, err := b.exec(ctx, name, initContainer, cmd, streamIO{stdin: archive, stderr: errBuf})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("file upload failed (exit code %d): %s", code, errBuf.String())
+	}
+	return nil
+}
+
+func sortedFiles(files map[string]*multipart.FileHeader) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// createBasePolicies creates the network policies which isolate hive pods from each
+// other, and the policy of the default network.
+func (b *ContainerBackend) createBasePolicies(ctx context.Context) error {
+	isolation := &networkPolicy{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "NetworkPolicy",
+		Metadata:   objectMeta{Name: isolationPolicy},
+		Spec: networkPolicySpec{
+			PodSelector: labelSelector{MatchExpressions: []labelSelectorReq{{Key: labelType, Operator: "Exists"}}},
+			PolicyTypes: []string{"Ingress"},
+			Ingress:     []networkPolicyRule{},
+		},
+	}
+	err := b.api.do(ctx, http.MethodPost, b.policyPath(""), isolation, nil)
+	if err != nil && !isAlreadyExists(err) {
+		return err
+	}
+	err = b.api.do(ctx, http.MethodPost, b.policyPath(""), networkPolicyFor(bridgeNetworkID), nil)
+	if err != nil && !isAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// networkPolicyFor creates the policy which allows traffic between pods in a network.
+func networkPolicyFor(id string) *networkPolicy {
+	selector := labelSelector{MatchLabels: map[string]string{labelNetworkPrefix + id: "true"}}
+	return &networkPolicy{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "NetworkPolicy",
+		Metadata:   objectMeta{Name: "hive-net-" + id},
+		Spec: networkPolicySpec{
+			PodSelector: selector,
+			PolicyTypes: []string{"Ingress"},
+			Ingress:     []networkPolicyRule{{From: []networkPolicyPeer{{PodSelector: &selector}}}},
+		},
+	}
+}
+
+// networkID derives the ID of a network from its name.
+func networkID(name string) string {
+	if name == "bridge" {
+		return bridgeNetworkID
+	}
+	h := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(h[:6])
+}
+
+// CreateNetwork creates a network policy for the given network.
+func (b *ContainerBackend) CreateNetwork(name string) (string, error) {
+	id := networkID(name)
+	policy := networkPolicyFor(id)
+	policy.Metadata.Annotations = map[string]string{annotationName: name}
+	if err := b.api.do(context.Background(), http.MethodPost, b.policyPath(""), policy, nil); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// NetworkNameToID finds the network ID of network by the given name.
+func (b *ContainerBackend) NetworkNameToID(name string) (string, error) {
+	id := networkID(name)
+	err := b.api.do(context.Background(), http.MethodGet, b.policyPath("hive-net-"+id), nil, nil)
+	if isNotFound(err) {
+		return "", libhive.ErrNetworkNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// RemoveNetwork disconnects all pods from the network and deletes its policy.
+func (b *ContainerBackend) RemoveNetwork(id string) error {
+	var pods podList
+	q := url.Values{"labelSelector": {labelNetworkPrefix + id + "=true"}}
+	if err := b.api.do(context.Background(), http.MethodGet, b.podPath("")+"?"+q.Encode(), nil, &pods); err != nil {
+		return err
+	}
+	for _, p := range pods.Items {
+		if err := b.DisconnectContainer(p.Metadata.Name, id); err != nil {
+			return err
+		}
+	}
+	return b.api.do(context.Background(), http.MethodDelete, b.policyPath("hive-net-"+id), nil, nil)
+}
+
+// ContainerIP finds the IP of a pod in the given network. Pods have a single IP address,
+// which is returned if the pod is connected to the network.
+func (b *ContainerBackend) ContainerIP(containerID, networkID string) (net.IP, error) {
+	var p pod
+	if err := b.api.do(context.Background(), http.MethodGet, b.podPath(containerID), nil, &p); err != nil {
+		return nil, err
+	}
+	if p.Metadata.Labels[labelNetworkPrefix+networkID] != "true" {
+		return nil, fmt.Errorf("network not found")
+	}
+	return net.ParseIP(p.Status.PodIP), nil
+}
+
+// ConnectContainer connects the given pod to a network.
+func (b *ContainerBackend) ConnectContainer(containerID, networkID string) error {
+	return b.setNetworkLabel(containerID, networkID, "true")
+}
+
+// DisconnectContainer disconnects the given pod from a network.
+func (b *ContainerBackend) DisconnectContainer(containerID, networkID string) error {
+	return b.setNetworkLabel(containerID, networkID, nil)
+}
+
+func (b *ContainerBackend) setNetworkLabel(containerID, networkID string, value any) error {
+	patch := map[string]any{
+		"metadata": map[string]any{
+			"labels": map[string]any{labelNetworkPrefix + networkID: value},
+		},
+	}
+	return b.api.do(context.Background(), http.MethodPatch, b.podPath(containerID), patch, nil)
+}
+
+// newPodName creates a random pod name. Like Docker container IDs, the name
+// is hex-encoded, so the first few characters can be used to identify the pod.
+func newPodName() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id[:]), nil
+}
@@ -0,0 +1,316 @@
+// Package libk8s implements the hive container backend for Kubernetes.
+//
+// Clients, simulators and the hiveproxy are created as pods in a single namespace. Hive
+// networks are mapped onto network policies: every network has a pod label, and pods
+// carrying the label may reach each other. Image builds still run on the local Docker
+// daemon, and images are made available to the cluster by pushing them to a registry.
+package libk8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the Kubernetes backend.
+type Config struct {
+	Logger *slog.Logger
+
+	// Namespace is the namespace in which pods and network policies are created.
+	// If empty, the namespace of the kubeconfig context is used.
+	Namespace string
+
+	// Registry is the address of the image registry used by the cluster. Image names
+	// are prefixed with this address when creating pods. If empty, images are expected
+	// to be present on the cluster nodes already.
+	Registry string
+
+	// If set, container output is relayed to this writer.
+	ContainerOutput io.Writer
+}
+
+// Cluster holds the API server connection parameters.
+type Cluster struct {
+	Server    string
+	Token     string
+	Namespace string
+	TLS       *tls.Config
+}
+
+// LoadCluster loads the cluster connection parameters. If kubeconfig is empty and hive
+// runs inside of a pod, the service account of the pod is used. Otherwise the
+// kubeconfig file is read from $KUBECONFIG or ~/.kube/config.
+func LoadCluster(kubeconfig, context string) (*Cluster, error) {
+	if kubeconfig == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return inClusterConfig()
+	}
+	if kubeconfig == "" {
+		kubeconfig = os.Getenv("KUBECONFIG")
+	}
+	if kubeconfig == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		kubeconfig = filepath.Join(home, ".kube", "config")
+	}
+	return loadKubeconfig(kubeconfig, context)
+}
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+func inClusterConfig() (*Cluster, error) {
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	ns, _ := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid service account CA certificate")
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	return &Cluster{
+		Server:    "https://" + host + ":" + port,
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: strings.TrimSpace(string(ns)),
+		TLS:       &tls.Config{RootCAs: pool},
+	}, nil
+}
+
+// kubeconfig is the subset of the kubeconfig file format understood by hive.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+func loadKubeconfig(file, contextName string) (*Cluster, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig %s: %v", file, err)
+	}
+	if contextName == "" {
+		contextName = kc.CurrentContext
+	}
+
+	// Resolve the context.
+	var cluster Cluster
+	var clusterName, userName string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == contextName {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+			cluster.Namespace = c.Context.Namespace
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("context %q not found in kubeconfig %s", contextName, file)
+	}
+
+	// Apply cluster settings.
+	cluster.TLS = new(tls.Config)
+	dir := filepath.Dir(file)
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		cluster.Server = c.Cluster.Server
+		cluster.TLS.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := readDataOrFile(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, dir)
+		if err != nil {
+			return nil, fmt.Errorf("can't load cluster CA: %v", err)
+		}
+		if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("invalid CA certificate for cluster %q", clusterName)
+			}
+			cluster.TLS.RootCAs = pool
+		}
+	}
+	if cluster.Server == "" {
+		return nil, fmt.Errorf("cluster %q not found in kubeconfig %s", clusterName, file)
+	}
+
+	// Apply user credentials.
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		cluster.Token = u.User.Token
+		if u.User.TokenFile != "" {
+			token, err := os.ReadFile(resolvePath(u.User.TokenFile, dir))
+			if err != nil {
+				return nil, err
+			}
+			cluster.Token = strings.TrimSpace(string(token))
+		}
+		cert, err := readDataOrFile(u.User.ClientCertificateData, u.User.ClientCertificate, dir)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client certificate: %v", err)
+		}
+		key, err := readDataOrFile(u.User.ClientKeyData, u.User.ClientKey, dir)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client key: %v", err)
+		}
+		if cert != nil && key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid client certificate: %v", err)
+			}
+			cluster.TLS.Certificates = []tls.Certificate{pair}
+		}
+	}
+	return &cluster, nil
+}
+
+// readDataOrFile returns base64-encoded inline data, or the content of a file.
+func readDataOrFile(data, file, dir string) ([]byte, error) {
+	switch {
+	case data != "":
+		return base64.StdEncoding.DecodeString(data)
+	case file != "":
+		return os.ReadFile(resolvePath(file, dir))
+	default:
+		return nil, nil
+	}
+}
+
+// resolvePath resolves file paths relative to the kubeconfig directory.
+func resolvePath(file, dir string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(dir, file)
+}
+
+// apiClient performs requests against the Kubernetes API server.
+type apiClient struct {
+	server string
+	token  string
+	tls    *tls.Config
+	http   *http.Client
+}
+
+func newAPIClient(c *Cluster) *apiClient {
+	return &apiClient{
+		server: strings.TrimSuffix(c.Server, "/"),
+		token:  c.Token,
+		tls:    c.TLS,
+		http:   &http.Client{Transport: &http.Transport{TLSClientConfig: c.TLS, Proxy: http.ProxyFromEnvironment}},
+	}
+}
+
+// do sends a request with a JSON body and decodes the JSON response into out.
+func (c *apiClient) do(ctx context.Context, method, path string, in, out any) error {
+	contentType := "application/json"
+	if method == http.MethodPatch {
+		contentType = "application/merge-patch+json"
+	}
+	var body io.Reader
+	if in != nil {
+		enc, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(enc)
+	}
+	resp, err := c.request(ctx, method, path, nil, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// request sends a request. Responses with non-2xx status are turned into errors.
+func (c *apiClient) request(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := c.server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+func responseError(resp *http.Response) error {
+	var apiErr apiError
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := json.Unmarshal(data, &apiErr.status); err != nil || apiErr.Code == 0 {
+		apiErr.Code = resp.StatusCode
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return &apiErr
+}
@@ -0,0 +1,640 @@
+package libk8s
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ethereum/hive/hiveproxy"
+	"github.com/ethereum/hive/internal/fakes"
+	"github.com/ethereum/hive/internal/libhive"
+	"github.com/ethereum/hive/internal/simapi"
+	"github.com/gorilla/websocket"
+)
+
+// fakeCluster implements the parts of the Kubernetes API used by the backend.
+type fakeCluster struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	pods     map[string]*fakePod
+	policies map[string]*networkPolicy
+	logText  string
+
+	// proxyAddr is the listening address of the hiveproxy frontend
+	// started by the attach endpoint.
+	proxyAddr chan net.Addr
+}
+
+type fakePod struct {
+	pod
+	files   map[string]string
+	started bool
+	deleted chan struct{}
+}
+
+func newFakeCluster(t *testing.T) *fakeCluster {
+	fc := &fakeCluster{
+		t:         t,
+		pods:      make(map[string]*fakePod),
+		policies:  make(map[string]*networkPolicy),
+		proxyAddr: make(chan net.Addr, 1),
+	}
+	fc.srv = httptest.NewServer(http.HandlerFunc(fc.serve))
+	t.Cleanup(fc.srv.Close)
+	return fc
+}
+
+func (fc *fakeCluster) backend(t *testing.T) *ContainerBackend {
+	cluster := &Cluster{Server: fc.srv.URL, Namespace: "hive"}
+	cb, err := Connect(context.Background(), cluster, &Config{})
+	if err != nil {
+		t.Fatal("connect failed:", err)
+	}
+	return cb
+}
+
+func (fc *fakeCluster) serve(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/version":
+		json.NewEncoder(w).Encode(map[string]string{"gitVersion": "v1.30.0"})
+	case len(path) >= 5 && path[0] == "api" && path[4] == "pods":
+		fc.servePods(w, r, path[5:])
+	case len(path) >= 6 && path[0] == "apis" && path[5] == "networkpolicies":
+		fc.servePolicies(w, r, path[6:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (fc *fakeCluster) servePods(w http.ResponseWriter, r *http.Request, path []string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if len(path) == 0 {
+		switch r.Method {
+		case http.MethodPost:
+			p := &fakePod{files: make(map[string]string), deleted: make(chan struct{})}
+			json.NewDecoder(r.Body).Decode(&p.pod)
+			p.Status.Phase = "Pending"
+			p.Status.PodIP = "127.0.0.1"
+			p.Status.InitContainerStatuses = []containerStatus{{Name: initContainer}}
+			p.Status.InitContainerStatuses[0].State.Running = &struct {
+				StartedAt string `json:"startedAt,omitempty"`
+			}{}
+			fc.pods[p.Metadata.Name] = p
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			var list podList
+			key, _, _ := strings.Cut(r.URL.Query().Get("labelSelector"), "=")
+			for _, p := range fc.pods {
+				if _, ok := p.Metadata.Labels[key]; ok {
+					list.Items = append(list.Items, p.pod)
+				}
+			}
+			json.NewEncoder(w).Encode(&list)
+		}
+		return
+	}
+
+	p := fc.pods[path[0]]
+	if p == nil {
+		fc.notFound(w)
+		return
+	}
+	if len(path) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(&p.pod)
+		case http.MethodPatch:
+			var patch struct {
+				Metadata struct {
+					Labels map[string]*string `json:"labels"`
+				} `json:"metadata"`
+			}
+			json.NewDecoder(r.Body).Decode(&patch)
+			for k, v := range patch.Metadata.Labels {
+				if v == nil {
+					delete(p.Metadata.Labels, k)
+				} else {
+					p.Metadata.Labels[k] = *v
+				}
+			}
+		case http.MethodDelete:
+			delete(fc.pods, path[0])
+			close(p.deleted)
+		}
+		return
+	}
+
+	switch path[1] {
+	case "log":
+		fc.mu.Unlock()
+		io.WriteString(w, fc.logText)
+		w.(http.Flusher).Flush()
+		<-p.deleted
+		fc.mu.Lock()
+	case "exec":
+		fc.mu.Unlock()
+		fc.serveExec(w, r, p)
+		fc.mu.Lock()
+	case "attach":
+		fc.mu.Unlock()
+		fc.serveAttach(w, r, p)
+		fc.mu.Lock()
+	}
+}
+
+func (fc *fakeCluster) notFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(&status{Status: "Failure", Reason: "NotFound", Code: 404})
+}
+
+var upgrader = websocket.Upgrader{Subprotocols: []string{protocolV5}}
+
+func (fc *fakeCluster) serveExec(w http.ResponseWriter, r *http.Request, p *fakePod) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	cmd := r.URL.Query()["command"]
+	result := &status{Status: "Success"}
+	switch {
+	case reflect.DeepEqual(cmd, []string{"touch", startMarker}):
+		fc.mu.Lock()
+		p.started = true
+		p.Status.Phase = "Running"
+		p.Status.ContainerStatuses = []containerStatus{{Name: mainContainer}}
+		p.Status.ContainerStatuses[0].State.Running = &struct {
+			StartedAt string `json:"startedAt,omitempty"`
+		}{}
+		fc.mu.Unlock()
+
+	case len(cmd) == 3 && strings.HasPrefix(cmd[2], "head -c "):
+		size, _ := strconv.Atoi(strings.Fields(cmd[2])[2])
+		var input []byte
+		for len(input) < size {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				fc.t.Error("stdin read error:", err)
+				return
+			}
+			if msg[0] == streamStdin {
+				input = append(input, msg[1:]...)
+			}
+		}
+		tr := tar.NewReader(bytes.NewReader(input))
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			content, _ := io.ReadAll(tr)
+			fc.mu.Lock()
+			p.files[hdr.Name] = string(content)
+			fc.mu.Unlock()
+		}
+
+	case cmd[0] == "echo":
+		conn.WriteMessage(websocket.BinaryMessage, append([]byte{streamStdout}, strings.Join(cmd[1:], " ")+"\n"...))
+		conn.WriteMessage(websocket.BinaryMessage, append([]byte{streamStderr}, "err\n"...))
+
+	default:
+		result = &status{Status: "Failure", Reason: "NonZeroExitCode"}
+		result.Details = &struct {
+			Causes []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"causes"`
+		}{}
+		result.Details.Causes = append(result.Details.Causes, struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		}{"ExitCode", "3"})
+	}
+	enc, _ := json.Marshal(result)
+	conn.WriteMessage(websocket.BinaryMessage, append([]byte{streamError}, enc...))
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// serveAttach runs the hiveproxy frontend on the stdio streams of the attach session.
+func (fc *fakeCluster) serveAttach(w http.ResponseWriter, r *http.Request, p *fakePod) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	stdinR, stdinW := io.Pipe()
+	stdout := &wsWriter{conn: conn}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fc.t.Error(err)
+		return
+	}
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				stdinW.CloseWithError(err)
+				return
+			}
+			if msg[0] == streamStdin {
+				stdinW.Write(msg[1:])
+			}
+		}
+	}()
+	proxy, err := hiveproxy.RunFrontend(stdinR, stdout, l)
+	if err != nil {
+		fc.t.Error("frontend error:", err)
+		return
+	}
+	fc.proxyAddr <- l.Addr()
+	<-p.deleted
+	conn.Close()
+	proxy.Close()
+}
+
+type wsWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (w *wsWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.conn.WriteMessage(websocket.BinaryMessage, append([]byte{streamStdout}, b...))
+	return len(b), err
+}
+
+func (w *wsWriter) Close() error { return nil }
+
+func (fc *fakeCluster) servePolicies(w http.ResponseWriter, r *http.Request, path []string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost:
+		var np networkPolicy
+		json.NewDecoder(r.Body).Decode(&np)
+		if fc.policies[np.Metadata.Name] != nil {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(&status{Status: "Failure", Reason: "AlreadyExists", Code: 409})
+			return
+		}
+		fc.policies[np.Metadata.Name] = &np
+		w.WriteHeader(http.StatusCreated)
+	case len(path) == 1 && fc.policies[path[0]] == nil:
+		fc.notFound(w)
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(fc.policies[path[0]])
+	case r.Method == http.MethodDelete:
+		delete(fc.policies, path[0])
+	}
+}
+
+func (fc *fakeCluster) pod(t *testing.T, name string) *fakePod {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	p := fc.pods[name]
+	if p == nil {
+		t.Fatalf("pod %s does not exist", name)
+	}
+	return p
+}
+
+// formFiles creates file headers for the given files.
+func formFiles(t *testing.T, files map[string]string) map[string]*multipart.FileHeader {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	for name, content := range files {
+		w, _ := mw.CreateFormFile(name, filepath.Base(name))
+		io.WriteString(w, content)
+	}
+	mw.Close()
+	form, err := multipart.NewReader(body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]*multipart.FileHeader)
+	for name, fh := range form.File {
+		result[name] = fh[0]
+	}
+	return result
+}
+
+func TestContainerLifecycle(t *testing.T) {
+	fc := newFakeCluster(t)
+	fc.logText = "client output\n"
+	cb := fc.backend(t)
+
+	if fc.policies[isolationPolicy] == nil || fc.policies["hive-net-bridge"] == nil {
+		t.Fatal("base network policies not created")
+	}
+
+	files := map[string]string{"/genesis.json": "{}", "/blocks/0001.rlp": "block"}
+	opts := libhive.ContainerOptions{
+		Env:    map[string]string{"HIVE_LOGLEVEL": "3", "HIVE_CHAIN_ID": "1"},
+		Files:  formFiles(t, files),
+		Labels: map[string]string{libhive.LabelHiveType: libhive.ContainerTypeClient},
+		Name:   "hive-client-test",
+		Resources: simapi.Resources{
+			CPUs:      1.5,
+			CPUShares: 512,
+			Memory:    1 << 30,
+		},
+	}
+	id, err := cb.CreateContainer(context.Background(), "hive/clients/go-ethereum:latest", opts)
+	if err != nil {
+		t.Fatal("create failed:", err)
+	}
+
+	// Check the pod spec.
+	p := fc.pod(t, id)
+	main := p.Spec.Containers[0]
+	if main.Image != "hive/clients/go-ethereum:latest" || main.ImagePullPolicy != "IfNotPresent" {
+		t.Errorf("wrong image %q (pull policy %s)", main.Image, main.ImagePullPolicy)
+	}
+	wantEnv := []envVar{{"HIVE_CHAIN_ID", "1"}, {"HIVE_LOGLEVEL", "3"}}
+	if !reflect.DeepEqual(main.Env, wantEnv) {
+		t.Errorf("wrong env: %v", main.Env)
+	}
+	wantResources := &resources{
+		Limits:   map[string]string{"cpu": "1500m", "memory": "1073741824"},
+		Requests: map[string]string{"cpu": "500m"},
+	}
+	if !reflect.DeepEqual(main.Resources, wantResources) {
+		t.Errorf("wrong resources: %+v", main.Resources)
+	}
+	wantMounts := []volumeMount{
+		{Name: filesVolume, MountPath: "/blocks/0001.rlp", SubPath: "blocks/0001.rlp"},
+		{Name: filesVolume, MountPath: "/genesis.json", SubPath: "genesis.json"},
+	}
+	if !reflect.DeepEqual(main.VolumeMounts, wantMounts) {
+		t.Errorf("wrong volume mounts: %v", main.VolumeMounts)
+	}
+	if p.Metadata.Labels[labelType] != "client" || p.Metadata.Labels[labelNetworkPrefix+"bridge"] != "true" {
+		t.Errorf("wrong pod labels: %v", p.Metadata.Labels)
+	}
+	if p.Metadata.Annotations[annotationName] != "hive-client-test" {
+		t.Errorf("wrong pod annotations: %v", p.Metadata.Annotations)
+	}
+	wantFiles := map[string]string{"genesis.json": "{}", "blocks/0001.rlp": "block"}
+	if !reflect.DeepEqual(p.files, wantFiles) {
+		t.Errorf("wrong uploaded files: %v", p.files)
+	}
+	if p.started {
+		t.Fatal("pod started before StartContainer")
+	}
+
+	// Start it.
+	opts.LogFile = filepath.Join(t.TempDir(), "client.log")
+	info, err := cb.StartContainer(context.Background(), id, opts)
+	if err != nil {
+		t.Fatal("start failed:", err)
+	}
+	if info.ID != id || info.IP != "127.0.0.1" {
+		t.Errorf("wrong container info: %+v", info)
+	}
+	if !fc.pod(t, id).started {
+		t.Error("pod was not released")
+	}
+
+	// Delete it.
+	if err := cb.DeleteContainer(id); err != nil {
+		t.Fatal("delete failed:", err)
+	}
+	info.Wait()
+	log, _ := os.ReadFile(opts.LogFile)
+	if string(log) != fc.logText {
+		t.Errorf("wrong log file content: %q", log)
+	}
+}
+
+func TestRunProgram(t *testing.T) {
+	fc := newFakeCluster(t)
+	cb := fc.backend(t)
+	id, err := cb.CreateContainer(context.Background(), "image", libhive.ContainerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := cb.RunProgram(context.Background(), id, []string{"echo", "hello", "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &libhive.ExecInfo{Stdout: "hello world\n", Stderr: "err\n", ExitCode: 0}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("wrong exec info %+v", info)
+	}
+
+	info, err = cb.RunProgram(context.Background(), id, []string{"false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ExitCode != 3 {
+		t.Errorf("wrong exit code %d", info.ExitCode)
+	}
+}
+
+func TestNetworks(t *testing.T) {
+	fc := newFakeCluster(t)
+	cb := fc.backend(t)
+	id, err := cb.CreateContainer(context.Background(), "image", libhive.ContainerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bridgeID, err := cb.NetworkNameToID("bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip, err := cb.ContainerIP(id, bridgeID); err != nil || ip.String() != "127.0.0.1" {
+		t.Fatalf("wrong bridge IP %v (err %v)", ip, err)
+	}
+
+	// Create a network and connect the pod.
+	netID, err := cb.CreateNetwork("hive_1_1_network1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id2, err := cb.NetworkNameToID("hive_1_1_network1"); err != nil || id2 != netID {
+		t.Fatalf("wrong network ID %q (err %v)", id2, err)
+	}
+	if _, err := cb.ContainerIP(id, netID); err == nil {
+		t.Fatal("pod has IP in network before connecting")
+	}
+	if err := cb.ConnectContainer(id, netID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cb.ContainerIP(id, netID); err != nil {
+		t.Fatal("no IP after connecting:", err)
+	}
+	policy := fc.policies["hive-net-"+netID]
+	label := labelNetworkPrefix + netID
+	if policy.Spec.PodSelector.MatchLabels[label] != "true" || policy.Spec.Ingress[0].From[0].PodSelector.MatchLabels[label] != "true" {
+		t.Errorf("wrong network policy: %+v", policy.Spec)
+	}
+
+	// Removing the network disconnects the pod.
+	if err := cb.RemoveNetwork(netID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fc.pod(t, id).Metadata.Labels[label]; ok {
+		t.Error("pod still connected after network removal")
+	}
+	if _, err := cb.NetworkNameToID("hive_1_1_network1"); err != libhive.ErrNetworkNotFound {
+		t.Errorf("wrong error for removed network: %v", err)
+	}
+}
+
+func TestServeAPI(t *testing.T) {
+	fc := newFakeCluster(t)
+	cb := fc.backend(t)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello from %s", r.URL.Path)
+	})
+	srv, err := cb.ServeAPI(context.Background(), h)
+	if err != nil {
+		t.Fatal("ServeAPI failed:", err)
+	}
+	defer srv.Close()
+
+	// Send a request through the proxy frontend.
+	addr := <-fc.proxyAddr
+	resp, err := http.Get("http://" + addr.String() + "/testsuite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello from /testsuite" {
+		t.Fatalf("wrong response: %q", body)
+	}
+
+	// Start a container with port check.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	opts := libhive.ContainerOptions{CheckLive: uint16(l.Addr().(*net.TCPAddr).Port)}
+	id, err := cb.CreateContainer(context.Background(), "image", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	info, err := cb.StartContainer(ctx, id, opts)
+	if err != nil {
+		t.Fatal("start with CheckLive failed:", err)
+	}
+	cb.DeleteContainer(id)
+	info.Wait()
+}
+
+func TestLoadKubeconfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	os.WriteFile(file, []byte(`
+apiVersion: v1
+kind: Config
+current-context: dev
+contexts:
+- name: dev
+  context:
+    cluster: c1
+    user: u1
+    namespace: hive-tests
+- name: other
+  context:
+    cluster: c2
+    user: u1
+clusters:
+- name: c1
+  cluster:
+    server: https://10.0.0.1:6443
+    insecure-skip-tls-verify: true
+- name: c2
+  cluster:
+    server: https://10.0.0.2:6443
+users:
+- name: u1
+  user:
+    token: secret
+`), 0644)
+
+	c, err := LoadCluster(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server != "https://10.0.0.1:6443" || c.Token != "secret" || c.Namespace != "hive-tests" || !c.TLS.InsecureSkipVerify {
+		t.Errorf("wrong cluster config: %+v", c)
+	}
+	c, err = LoadCluster(file, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server != "https://10.0.0.2:6443" || c.Namespace != "" {
+		t.Errorf("wrong cluster config for context 'other': %+v", c)
+	}
+	if _, err := LoadCluster(file, "missing"); err == nil {
+		t.Error("expected error for missing context")
+	}
+}
+
+// pushRecorder is an ImagePusher which records the pushed images.
+type pushRecorder []string
+
+func (p *pushRecorder) PushImage(ctx context.Context, image, registry string) error {
+	*p = append(*p, registry+"/"+image)
+	return nil
+}
+
+func TestBuilderPush(t *testing.T) {
+	buildErr := errors.New("build failed")
+	var pushed pushRecorder
+	b := NewBuilder(fakes.NewBuilder(&fakes.BuilderHooks{
+		BuildImage: func(ctx context.Context, name string, fsys fs.FS) error {
+			if name == "hive/broken" {
+				return buildErr
+			}
+			return nil
+		},
+	}), &pushed, "registry.local")
+
+	if err := b.BuildImage(context.Background(), "hive/broken", fstest.MapFS{}); err != buildErr {
+		t.Fatalf("wrong error %v, want %v", err, buildErr)
+	}
+	if len(pushed) != 0 {
+		t.Fatalf("image pushed after failed build: %v", pushed)
+	}
+	if err := b.BuildImage(context.Background(), "hive/ok", fstest.MapFS{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"registry.local/hive/ok"}; !reflect.DeepEqual([]string(pushed), want) {
+		t.Fatalf("wrong pushed images %v, want %v", pushed, want)
+	}
+}
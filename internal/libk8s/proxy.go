@@ -0,0 +1,138 @@
+package libk8s
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/ethereum/hive/hiveproxy"
+	"github.com/ethereum/hive/internal/libdocker"
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+const hiveproxyTag = "hive/hiveproxy"
+
+// Build builds the hiveproxy image. The image is also used for the init
+// containers of all pods.
+func (cb *ContainerBackend) Build(ctx context.Context, b libhive.Builder) error {
+	err := b.BuildImage(ctx, hiveproxyTag, hiveproxy.Source)
+	if err == nil {
+		return nil
+	}
+	if !libdocker.ImageAlreadyExists(err) {
+		return err
+	}
+	// The image was built by another hive process at the same time. It still
+	// needs to be pushed to the registry of the cluster.
+	if pb, ok := b.(*Builder); ok {
+		return pb.pusher.PushImage(ctx, hiveproxyTag, pb.registry)
+	}
+	return nil
+}
+
+// ServeAPI starts the API server. The hiveproxy runs in a pod, and its stdio
+// streams are relayed through the attach endpoint of the API server.
+func (cb *ContainerBackend) ServeAPI(ctx context.Context, h http.Handler) (libhive.APIServer, error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	// Create labels for hiveproxy container.
+	proxyLabels := libhive.NewBaseLabels(cb.hiveInstanceID, cb.hiveVersion)
+	proxyLabels[libhive.LabelHiveType] = libhive.ContainerTypeProxy
+
+	// Generate container name.
+	containerName := libhive.GenerateProxyContainerName()
+
+	opts := libhive.ContainerOptions{Output: outW, Input: inR, Labels: proxyLabels, Name: containerName}
+	id, err := cb.CreateContainer(ctx, hiveproxyTag, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Launch the proxy server before starting the container.
+	var (
+		proxy     *hiveproxy.Proxy
+		proxyErrC = make(chan error, 1)
+	)
+	go func() {
+		var err error
+		proxy, err = hiveproxy.RunBackend(outR, inW, h)
+		if err != nil {
+			slog.Error("proxy backend startup failed", "err", err)
+		}
+		proxyErrC <- err
+	}()
+
+	// Now start the container.
+	info, err := cb.StartContainer(ctx, id, opts)
+	if err != nil {
+		cb.DeleteContainer(id)
+		return nil, err
+	}
+
+	// Proxy server should come up.
+	if err := <-proxyErrC; err != nil {
+		cb.DeleteContainer(id)
+		return nil, err
+	}
+
+	srv := &proxyContainer{
+		cb:              cb,
+		containerID:     id,
+		containerIP:     net.ParseIP(info.IP),
+		containerWait:   info.Wait,
+		containerStdin:  inR,
+		containerStdout: outW,
+		proxy:           proxy,
+	}
+
+	// Register proxy in ContainerBackend, so it can be used for CheckLive.
+	cb.proxies.Add(proxy)
+	slog.Info("hiveproxy started", "container", id[:8], "addr", srv.Addr())
+	return srv, nil
+}
+
+type proxyContainer struct {
+	cb *ContainerBackend
+
+	containerID     string
+	containerIP     net.IP
+	containerStdin  *io.PipeReader
+	containerStdout *io.PipeWriter
+	containerWait   func()
+	proxy           *hiveproxy.Proxy
+
+	stopping sync.Once
+	stopErr  error
+}
+
+// Addr returns the listening address of the proxy server.
+func (c *proxyContainer) Addr() net.Addr {
+	return &net.TCPAddr{IP: c.containerIP, Port: 8081}
+}
+
+// Close terminates the proxy pod.
+func (c *proxyContainer) Close() error {
+	c.stopping.Do(func() {
+		// Unregister proxy in backend.
+		c.cb.proxies.Remove(c.proxy)
+
+		// Stop the container.
+		c.containerStdin.Close()
+		c.containerStdout.Close()
+		c.stopErr = c.cb.DeleteContainer(c.containerID)
+		c.containerWait()
+
+		// Stop the local HTTP receiver.
+		c.proxy.Close()
+	})
+	return c.stopErr
+}
+
+// DialContainer opens a TCP connection to a container through the API proxy.
+func (cb *ContainerBackend) DialContainer(ctx context.Context, addr string) (net.Conn, error) {
+	return cb.proxies.Dial(ctx, addr)
+}
@@ -0,0 +1,161 @@
+package libk8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Channel numbers of the Kubernetes streaming protocol.
+const (
+	streamStdin  = 0
+	streamStdout = 1
+	streamStderr = 2
+	streamError  = 3
+	streamClose  = 255
+)
+
+const (
+	protocolV4 = "v4.channel.k8s.io"
+	protocolV5 = "v5.channel.k8s.io"
+)
+
+// streamIO holds the local endpoints of a stream. Any of the fields can be nil.
+type streamIO struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// stream is a websocket connection to the exec or attach endpoint of a pod.
+type stream struct {
+	conn     *websocket.Conn
+	protocol string
+	writeMu  sync.Mutex
+}
+
+// dialStream opens a streaming connection to the given pod subresource.
+func (c *apiClient) dialStream(ctx context.Context, path string, query url.Values) (*stream, error) {
+	u, err := url.Parse(c.server + path)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	u.RawQuery = query.Encode()
+
+	dialer := websocket.Dialer{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: c.tls,
+		Subprotocols:    []string{protocolV5, protocolV4},
+	}
+	header := make(http.Header)
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+	conn, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			defer resp.Body.Close()
+			return nil, responseError(resp)
+		}
+		return nil, err
+	}
+	return &stream{conn: conn, protocol: conn.Subprotocol()}, nil
+}
+
+// run relays the streams until the remote side closes the connection. The returned
+// status is the result sent by the server on the error channel, if any.
+func (s *stream) run(sio streamIO) (*status, error) {
+	defer s.conn.Close()
+
+	if sio.stdin != nil {
+		go s.copyStdin(sio.stdin)
+	}
+
+	var result *status
+	for {
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) || errors.Is(err, io.EOF) {
+				return result, nil
+			}
+			return result, err
+		}
+		if len(msg) < 2 {
+			continue // initial channel announcement
+		}
+		var w io.Writer
+		switch msg[0] {
+		case streamStdout:
+			w = sio.stdout
+		case streamStderr:
+			w = sio.stderr
+		case streamError:
+			result = new(status)
+			if err := json.Unmarshal(msg[1:], result); err != nil {
+				return nil, fmt.Errorf("invalid stream status: %v", err)
+			}
+		}
+		if w != nil {
+			if _, err := w.Write(msg[1:]); err != nil {
+				return result, err
+			}
+		}
+	}
+}
+
+// copyStdin sends stdin data to the remote side.
+func (s *stream) copyStdin(r io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf[1:])
+		if n > 0 {
+			buf[0] = streamStdin
+			if s.write(buf[:n+1]) != nil {
+				return
+			}
+		}
+		if err != nil {
+			// Signal end of input. This is only supported by protocol v5.
+			if s.protocol == protocolV5 {
+				s.write([]byte{streamClose, streamStdin})
+			}
+			return
+		}
+	}
+}
+
+func (s *stream) write(msg []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteMessage(websocket.BinaryMessage, msg)
+}
+
+// exitCode interprets the stream result status of a command execution.
+func exitCode(st *status) (int, error) {
+	if st == nil || st.Status == "Success" {
+		return 0, nil
+	}
+	if st.Details != nil {
+		for _, cause := range st.Details.Causes {
+			if cause.Reason == "ExitCode" {
+				return strconv.Atoi(strings.TrimSpace(cause.Message))
+			}
+		}
+	}
+	return 0, errors.New(st.Message)
+}
@@ -0,0 +1,178 @@
+package libk8s
+
+import (
+	"fmt"
+)
+
+// This file contains the subset of the Kubernetes API object definitions
+// used by the backend.
+
+type objectMeta struct {
+	Name        string            `json:"name,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type pod struct {
+	APIVersion string     `json:"apiVersion,omitempty"`
+	Kind       string     `json:"kind,omitempty"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       podSpec    `json:"spec"`
+	Status     podStatus  `json:"status,omitempty"`
+}
+
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+type podSpec struct {
+	InitContainers                []container `json:"initContainers,omitempty"`
+	Containers                    []container `json:"containers"`
+	Volumes                       []volume    `json:"volumes,omitempty"`
+	RestartPolicy                 string      `json:"restartPolicy,omitempty"`
+	EnableServiceLinks            *bool       `json:"enableServiceLinks,omitempty"`
+	AutomountServiceAccountToken  *bool       `json:"automountServiceAccountToken,omitempty"`
+	TerminationGracePeriodSeconds *int64      `json:"terminationGracePeriodSeconds,omitempty"`
+}
+
+type container struct {
+	Name            string        `json:"name"`
+	Image           string        `json:"image"`
+	ImagePullPolicy string        `json:"imagePullPolicy,omitempty"`
+	Command         []string      `json:"command,omitempty"`
+	Env             []envVar      `json:"env,omitempty"`
+	VolumeMounts    []volumeMount `json:"volumeMounts,omitempty"`
+	Stdin           bool          `json:"stdin,omitempty"`
+	StdinOnce       bool          `json:"stdinOnce,omitempty"`
+	Resources       *resources    `json:"resources,omitempty"`
+}
+
+type resources struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+type envVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type volume struct {
+	Name     string    `json:"name"`
+	EmptyDir *struct{} `json:"emptyDir,omitempty"`
+}
+
+type volumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	SubPath   string `json:"subPath,omitempty"`
+}
+
+type podStatus struct {
+	Phase                 string            `json:"phase,omitempty"`
+	PodIP                 string            `json:"podIP,omitempty"`
+	InitContainerStatuses []containerStatus `json:"initContainerStatuses,omitempty"`
+	ContainerStatuses     []containerStatus `json:"containerStatuses,omitempty"`
+}
+
+type containerStatus struct {
+	Name  string         `json:"name"`
+	State containerState `json:"state"`
+}
+
+type containerState struct {
+	Waiting *struct {
+		Reason  string `json:"reason,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"waiting,omitempty"`
+	Running *struct {
+		StartedAt string `json:"startedAt,omitempty"`
+	} `json:"running,omitempty"`
+	Terminated *struct {
+		ExitCode int    `json:"exitCode"`
+		Reason   string `json:"reason,omitempty"`
+	} `json:"terminated,omitempty"`
+}
+
+// containerState returns the state of the named container.
+func (p *pod) containerState(name string) containerState {
+	for _, s := range p.Status.InitContainerStatuses {
+		if s.Name == name {
+			return s.State
+		}
+	}
+	for _, s := range p.Status.ContainerStatuses {
+		if s.Name == name {
+			return s.State
+		}
+	}
+	return containerState{}
+}
+
+type networkPolicy struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Metadata   objectMeta        `json:"metadata"`
+	Spec       networkPolicySpec `json:"spec"`
+}
+
+type networkPolicySpec struct {
+	PodSelector labelSelector       `json:"podSelector"`
+	PolicyTypes []string            `json:"policyTypes"`
+	Ingress     []networkPolicyRule `json:"ingress"`
+}
+
+type networkPolicyRule struct {
+	From []networkPolicyPeer `json:"from,omitempty"`
+}
+
+type networkPolicyPeer struct {
+	PodSelector *labelSelector `json:"podSelector,omitempty"`
+}
+
+type labelSelector struct {
+	MatchLabels      map[string]string  `json:"matchLabels,omitempty"`
+	MatchExpressions []labelSelectorReq `json:"matchExpressions,omitempty"`
+}
+
+type labelSelectorReq struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+}
+
+// status is the error object returned by the API server.
+type status struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	Code    int    `json:"code"`
+	Details *struct {
+		Causes []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"causes"`
+	} `json:"details,omitempty"`
+}
+
+// apiError is returned for API requests that did not succeed.
+type apiError struct {
+	status
+}
+
+func (err *apiError) Error() string {
+	if err.Message != "" {
+		return fmt.Sprintf("kubernetes API error %d: %s", err.Code, err.Message)
+	}
+	return fmt.Sprintf("kubernetes API error %d (%s)", err.Code, err.Reason)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.Code == 404
+}
+
+func isAlreadyExists(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.Code == 409
+}
@@ -0,0 +1,73 @@
+// Package libpodman implements the hive container backend for Podman.
+//
+// Podman serves a Docker-compatible REST API on its service socket, so this package
+// reuses the Docker backend implementation and only adjusts for the behavioral
+// differences between the two engines.
+package libpodman
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/hive/internal/libdocker"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// apiVersion is the Docker API version spoken by the Podman compatibility layer.
+const apiVersion = "1.41"
+
+// defaultNetwork is the name of the Podman default network, which corresponds
+// to the "bridge" network of Docker.
+//
+// Rootless Podman does not attach containers to a network by default, so containers
+// are explicitly created in this network to ensure they can reach each other.
+const defaultNetwork = "podman"
+
+// Connect creates the image builder and container backend for the Podman service
+// at the given endpoint. If endpoint is empty, the default service socket is used.
+//
+// The Podman service must be running for this to work. It can be started using
+// 'systemctl --user start podman.socket' or 'podman system service'.
+func Connect(endpoint string, cfg *libdocker.Config) (*libdocker.Builder, *libdocker.ContainerBackend, error) {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if endpoint == "" {
+		endpoint = DefaultEndpoint()
+	}
+	client, err := docker.NewVersionedClient(endpoint, apiVersion)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't connect to podman: %v", err)
+	}
+	env, err := client.Version()
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't get podman version (is the podman service running at %s?): %v", endpoint, err)
+	}
+	logger.Debug("podman service online", "endpoint", endpoint, "version", env.Get("Version"))
+
+	config := *cfg
+	config.DefaultNetwork = defaultNetwork
+	config.CLI = "podman"
+	builder, err := libdocker.CreateBuilder(client, &config)
+	if err != nil {
+		return nil, nil, err
+	}
+	backend := libdocker.NewContainerBackend(client, &config)
+	return builder, backend, nil
+}
+
+// DefaultEndpoint returns the API endpoint of the Podman service. The CONTAINER_HOST
+// environment variable takes precedence. Otherwise, the rootless service socket is used
+// if XDG_RUNTIME_DIR is set, and the system-wide socket is used when running as root.
+func DefaultEndpoint() string {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Geteuid() != 0 {
+		return "unix://" + filepath.Join(dir, "podman", "podman.sock")
+	}
+	return "unix:///run/podman/podman.sock"
+}
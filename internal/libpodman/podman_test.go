@@ -0,0 +1,34 @@
+package libpodman
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/hive/internal/backendtest"
+	"github.com/ethereum/hive/internal/libdocker"
+)
+
+func TestBackend(t *testing.T) {
+	builder, backend, err := Connect("", &libdocker.Config{})
+	if err != nil {
+		t.Skip("podman is not available:", err)
+	}
+	backendtest.Run(t, builder, backend)
+}
+
+func TestDefaultEndpoint(t *testing.T) {
+	t.Setenv("CONTAINER_HOST", "unix:///tmp/podman.sock")
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	if ep := DefaultEndpoint(); ep != "unix:///tmp/podman.sock" {
+		t.Fatalf("wrong endpoint with CONTAINER_HOST set: %q", ep)
+	}
+
+	t.Setenv("CONTAINER_HOST", "")
+	want := "unix:///run/user/1000/podman/podman.sock"
+	if os.Geteuid() == 0 {
+		want = "unix:///run/podman/podman.sock"
+	}
+	if ep := DefaultEndpoint(); ep != want {
+		t.Fatalf("wrong endpoint: %q, want %q", ep, want)
+	}
+}
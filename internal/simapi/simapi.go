@@ -7,6 +7,43 @@ type TestRequest struct {
 	Location    string `json:"location"`
 	Category    string `json:"category"`
 	Description string `json:"description"`
+
+	// Timeout is the time limit of the test in milliseconds. If zero, the default
+	// limit of the run applies. If negative, hive does not end the test, and the
+	// simulator is expected to enforce the limit.
+	Timeout int64 `json:"timeout,omitempty"`
+
+	// Parent is the ID of the test which runs this test as a subtest.
+	Parent uint32 `json:"parent,omitempty"`
+}
+
+// TestCatalog lists the suites and tests of a simulator. Simulators send it when
+// running in catalog mode, where tests are collected without running them.
+type TestCatalog struct {
+	Simulator string         `json:"simulator"`
+	Suites    []CatalogSuite `json:"suites"`
+}
+
+// CatalogSuite is a test suite in a TestCatalog.
+type CatalogSuite struct {
+	Name        string        `json:"name"`
+	DisplayName string        `json:"displayName,omitempty"`
+	Category    string        `json:"category,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Tests       []CatalogTest `json:"tests"`
+}
+
+// CatalogTest is a test in a TestCatalog.
+type CatalogTest struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Description string `json:"description,omitempty"`
+	Role        string `json:"role,omitempty"`   // client role required by the test
+	Parent      string `json:"parent,omitempty"` // name of the parent test
+
+	// Capabilities are the client capabilities required by the test.
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 // NodeConfig contains the launch parameters for a client container.
@@ -14,6 +51,17 @@ type NodeConfig struct {
 	Client      string            `json:"client"`
 	Networks    []string          `json:"networks"`
 	Environment map[string]string `json:"environment"`
+	Resources   *Resources        `json:"resources,omitempty"`
+	Snapshot    string            `json:"snapshot,omitempty"` // snapshot ID to start from
+}
+
+// Resources contains the resource limits of a client container.
+// Zero values mean there is no limit.
+type Resources struct {
+	CPUs      float64 `json:"cpus,omitempty" yaml:"cpus,omitempty"`            // CPU quota, in number of CPUs
+	CPUShares int64   `json:"cpuShares,omitempty" yaml:"cpu_shares,omitempty"` // relative CPU weight
+	Memory    int64   `json:"memory,omitempty" yaml:"memory,omitempty"`        // memory limit in bytes
+	Pids      int64   `json:"pids,omitempty" yaml:"pids,omitempty"`            // max number of processes
 }
 
 // StartNodeResponse is returned by the client startup endpoint.
@@ -22,12 +70,39 @@ type StartNodeResponse struct {
 	IP string `json:"ip"` // IP address in bridge network
 }
 
+// SnapshotResponse is returned by the client snapshot endpoint.
+type SnapshotResponse struct {
+	ID string `json:"id"` // Snapshot ID.
+}
+
 // NodeResponse is the description of a running client as returned by the API.
 type NodeResponse struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	State string `json:"state"` // NodeRunning, NodeExited or NodeStopped
+
+	// Exit status of a client which has crashed, i.e. State is NodeExited.
+	ExitCode  int  `json:"exitCode,omitempty"`
+	OOMKilled bool `json:"oomKilled,omitempty"`
 }
 
+// Client states.
+const (
+	NodeRunning = "running" // the client is running
+	NodeExited  = "exited"  // the client has stopped by itself while the test was running
+	NodeStopped = "stopped" // the client was stopped by hive
+)
+
+// Response headers of the client log endpoint.
+const (
+	// LogOffsetHeader contains the byte offset in the log file at which the response
+	// body starts.
+	LogOffsetHeader = "Hive-Log-Offset"
+	// LogEndHeader contains the byte offset in the log file at which the response body
+	// ends. It is not set when the log is followed.
+	LogEndHeader = "Hive-Log-End"
+)
+
 type ExecRequest struct {
 	Command []string `json:"command"`
 }
@@ -35,3 +110,33 @@ type ExecRequest struct {
 type Error struct {
 	Error string `json:"error"`
 }
+
+// Measurement is a numeric value recorded by a test, e.g. the time taken to sync.
+type Measurement struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"` // e.g. "s" or "blocks/s"
+}
+
+// NetworkConditions configures faults of the network traffic sent by a client.
+type NetworkConditions struct {
+	All   LinkConditions   `json:"all"`             // applies to all sent traffic
+	Peers []PeerConditions `json:"peers,omitempty"` // traffic sent to specific nodes
+}
+
+// PeerConditions configures faults of the traffic sent to another node.
+type PeerConditions struct {
+	Node string `json:"node"` // container ID of the destination
+	LinkConditions
+
+	// Partition drops all traffic sent to the node.
+	Partition bool `json:"partition,omitempty"`
+}
+
+// LinkConditions are the properties of a network link.
+type LinkConditions struct {
+	Latency   uint32  `json:"latency,omitempty"`   // added delay in milliseconds
+	Jitter    uint32  `json:"jitter,omitempty"`    // delay variation in milliseconds
+	Loss      float64 `json:"loss,omitempty"`      // packet loss in percent
+	Bandwidth uint64  `json:"bandwidth,omitempty"` // rate limit in kbit/s
+}